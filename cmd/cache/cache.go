@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/cmd/create"
+	"github.com/swxctx/xmodel/mysql"
+	"github.com/swxctx/xmodel/redis"
+	"gopkg.in/yaml.v3"
+)
+
+// Config cache command config, read from a yaml file
+type Config struct {
+	Mysql *mysql.Config `yaml:"mysql"`
+	Redis *redis.Config `yaml:"redis"`
+	// the number of rows per query and per redis pipeline, default is mysql max_batch_rows
+	BatchSize int `yaml:"batch_size"`
+	// the maximum number of rows to warm per second of each table, 0 means no limit
+	RowsPerSecond int `yaml:"rows_per_second"`
+	// the maximum fraction of the expiration added to each TTL at random, e.g. 0.1
+	Jitter float64 `yaml:"jitter"`
+	// the tables to warm up
+	Tables []*TableConfig `yaml:"tables"`
+}
+
+// TableConfig the table to warm up
+type TableConfig struct {
+	Name string `yaml:"name"`
+	// the cache expiration registered by the application, e.g. '24h'
+	Expiration string `yaml:"expiration"`
+	// the optional condition of the rows to warm, e.g. 'status=?'
+	Where string        `yaml:"where"`
+	Args  []interface{} `yaml:"args"`
+	// the fields of the unique keys to cache besides the primary key, e.g. [[email]]
+	UniqueKeys [][]string `yaml:"unique_keys"`
+}
+
+// ReadConfig reads the yaml config file.
+func ReadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err = yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	if cfg.Mysql == nil || cfg.Redis == nil {
+		return nil, fmt.Errorf("%s: mysql and redis are required", path)
+	}
+	return &cfg, nil
+}
+
+// Warm warms up the caches of the tables in the config file, or only the named tables if any.
+// NOTE:
+//  The rows are cached in the same format as the structs generated by 'xmodel tpl'.
+func Warm(configFile string, tables ...string) {
+	cfg, err := ReadConfig(configFile)
+	if err != nil {
+		xlog.Fatalf("[XModel] read config: %s", err.Error())
+	}
+	cfg.Mysql.NoCache = false
+	db, err := mysql.Connect(cfg.Mysql, cfg.Redis)
+	if err != nil {
+		xlog.Fatalf("[XModel] connect: %s", err.Error())
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	for _, tb := range cfg.Tables {
+		if len(tables) > 0 && !slices.Contains(tables, tb.Name) {
+			continue
+		}
+		expiration, err := time.ParseDuration(tb.Expiration)
+		if err != nil || expiration <= 0 {
+			xlog.Fatalf("[XModel] table %s: invalid expiration: %q", tb.Name, tb.Expiration)
+		}
+		structType, err := tableStruct(db, tb.Name)
+		if err != nil {
+			xlog.Fatalf("[XModel] table %s: %s", tb.Name, err.Error())
+		}
+		c, err := db.RegCacheableType(tb.Name, structType, expiration)
+		if err != nil {
+			xlog.Fatalf("[XModel] table %s: %s", tb.Name, err.Error())
+		}
+		progress, err := c.Warm(ctx, tb.Where, tb.Args, &mysql.WarmOptions{
+			BatchSize:     cfg.BatchSize,
+			UniqueKeys:    tb.UniqueKeys,
+			RowsPerSecond: cfg.RowsPerSecond,
+			Jitter:        cfg.Jitter,
+			OnProgress:    printProgress,
+		})
+		if err != nil {
+			xlog.Fatalf("[XModel] warm %s: %s", tb.Name, err.Error())
+		}
+		xlog.Infof("[XModel] warmed %s: %d rows, %d keys in %s", tb.Name, progress.Rows, progress.Keys, progress.Elapsed)
+	}
+}
+
+func printProgress(p mysql.WarmProgress) {
+	xlog.Infof("[XModel] warming %s: %d rows, %d keys, %s", p.Table, p.Rows, p.Keys, p.Elapsed)
+}
+
+// the field types of the generated structs
+var goTypes = map[string]reflect.Type{
+	"int64":                       reflect.TypeOf(int64(0)),
+	"bool":                        reflect.TypeOf(false),
+	"int32":                       reflect.TypeOf(int32(0)),
+	"float64":                     reflect.TypeOf(float64(0)),
+	"string":                      reflect.TypeOf(""),
+	"time.Time":                   reflect.TypeOf(time.Time{}),
+	"[]byte":                      reflect.TypeOf([]byte(nil)),
+	"mysql.Set":                   reflect.TypeOf(mysql.Set(nil)),
+	"mysql.Decimal":               reflect.TypeOf(mysql.Decimal("")),
+	"mysql.JSON[interface{}]":     reflect.TypeOf(mysql.JSON[interface{}]{}),
+	"mysql.NullJSON[interface{}]": reflect.TypeOf(mysql.NullJSON[interface{}]{}),
+}
+
+// tableStruct builds the *struct type of the table at runtime, as 'xmodel tpl' generates.
+func tableStruct(db *mysql.DB, tableName string) (reflect.Type, error) {
+	rows, err := db.Query("desc `" + tableName + "`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var fields []reflect.StructField
+	for rows.Next() {
+		var (
+			name, modelType, null, key string
+			discard                    interface{}
+		)
+		if err = rows.Scan(&name, &modelType, &null, &key, &discard, &discard); err != nil {
+			return nil, err
+		}
+		typ, _ := create.GoType(modelType, null == "YES")
+		tag := fmt.Sprintf(`json:"%s"`, name)
+		if key = strings.ToLower(key); key == "pri" || key == "uni" {
+			tag += fmt.Sprintf(` key:"%s"`, key)
+		}
+		fields = append(fields, reflect.StructField{
+			Name: gutil.CamelString(name),
+			Type: goTypes[typ],
+			Tag:  reflect.StructTag(tag),
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("table not found")
+	}
+	return reflect.PtrTo(reflect.StructOf(fields)), nil
+}
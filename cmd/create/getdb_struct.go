@@ -98,9 +98,9 @@ func AddTableStructToTpl(cfg ConnConfig) {
 	var sub = string(b[i:j])
 	var structString string
 	var m = make(map[string]bool)
-	var appendTimePackage bool
+	var appendPackages = make(map[string]bool)
 	for _, tabName := range cfg.Tables {
-		tb, hasTimeImport, err := parseTable(db, tabName)
+		tb, imports, err := parseTable(db, tabName)
 		if err != nil {
 			xlog.Fatalf("[XModel] parse table: %s", err.Error())
 		}
@@ -115,7 +115,9 @@ func AddTableStructToTpl(cfg ConnConfig) {
 		}
 		if !strings.Contains(text, "type "+tb.name+" struct {") {
 			structString += "\n" + tb.String() + "\n"
-			appendTimePackage = appendTimePackage || hasTimeImport
+			for _, imp := range imports {
+				appendPackages[imp] = true
+			}
 		}
 		m[tb.name] = true
 	}
@@ -125,17 +127,16 @@ func AddTableStructToTpl(cfg ConnConfig) {
 			"Added mysql model struct code:\n%s",
 			formatSource([]byte(structString)),
 		)
-		if appendTimePackage {
+		if len(appendPackages) > 0 {
 			tInfo := newTplInfo([]byte(text))
 			tInfo.Parse()
 			for _, v := range tInfo.typeImports {
-				if v == `"time"` {
-					appendTimePackage = false
-					break
-				}
+				delete(appendPackages, v)
 			}
-			if appendTimePackage {
-				text = strings.Replace(text, "package __TPL__\n", "package __TPL__\nimport \"time\"\n", 1)
+			for _, imp := range []string{timeImport, mysqlImport} {
+				if appendPackages[imp] {
+					text = strings.Replace(text, "package __TPL__\n", "package __TPL__\nimport "+imp+"\n", 1)
+				}
 			}
 		}
 	}
@@ -152,7 +153,14 @@ func AddTableStructToTpl(cfg ConnConfig) {
 	xlog.Infof("Added mysql model struct code to project template!")
 }
 
-func parseTable(db *sql.DB, tableName string) (tb *structType, hasTimeImport bool, err error) {
+// the imports of the column types
+const (
+	timeImport  = `"time"`
+	mysqlImport = `"github.com/swxctx/xmodel/mysql"`
+)
+
+// parseTable returns the struct of the table, and the imports of its field types.
+func parseTable(db *sql.DB, tableName string) (tb *structType, imports []string, err error) {
 	row, err := db.Query("desc `" + tableName + "`")
 	if err != nil {
 		return
@@ -166,27 +174,17 @@ func parseTable(db *sql.DB, tableName string) (tb *structType, hasTimeImport boo
 		var (
 			f         = new(field)
 			modelType string
+			null      string
 			key       string
 			discard   interface{}
 		)
-		if err = row.Scan(&f.ModelName, &modelType, &discard, &key, &discard, &discard); err != nil {
+		if err = row.Scan(&f.ModelName, &modelType, &null, &key, &discard, &discard); err != nil {
 			return
 		}
-		if containsAny(modelType, "bigint", "timestamp") {
-			f.Typ = "int64"
-		} else if containsAny(modelType, "tinyint(1)") {
-			f.Typ = "bool"
-		} else if containsAny(modelType, "int") {
-			f.Typ = "int32"
-		} else if containsAny(modelType, "float", "double") {
-			f.Typ = "float64"
-		} else if containsAny(modelType, "char", "text", "decimal") {
-			f.Typ = "string"
-		} else if containsAny(modelType, "time", "date", "year") {
-			f.Typ = "time.Time"
-			hasTimeImport = true
-		} else {
-			f.Typ = "[]byte"
+		var imp string
+		f.Typ, imp = GoType(modelType, null == "YES")
+		if imp != "" {
+			imports = append(imports, imp)
 		}
 		switch k := strings.ToLower(key); k {
 		case "pri", "uni":
@@ -211,6 +209,33 @@ func parseTable(db *sql.DB, tableName string) (tb *structType, hasTimeImport boo
 	return
 }
 
+// GoType returns the field type of the column type in the generated struct, and the import of the field type.
+func GoType(modelType string, nullable bool) (typ string, imp string) {
+	if modelType == "json" {
+		if nullable {
+			return "mysql.NullJSON[interface{}]", mysqlImport
+		}
+		return "mysql.JSON[interface{}]", mysqlImport
+	} else if strings.HasPrefix(modelType, "set(") {
+		return "mysql.Set", mysqlImport
+	} else if strings.HasPrefix(modelType, "decimal") {
+		return "mysql.Decimal", mysqlImport
+	} else if containsAny(modelType, "bigint", "timestamp") {
+		return "int64", ""
+	} else if containsAny(modelType, "tinyint(1)") {
+		return "bool", ""
+	} else if containsAny(modelType, "int") {
+		return "int32", ""
+	} else if containsAny(modelType, "float", "double") {
+		return "float64", ""
+	} else if containsAny(modelType, "char", "text") {
+		return "string", ""
+	} else if containsAny(modelType, "time", "date", "year") {
+		return "time.Time", timeImport
+	}
+	return "[]byte", ""
+}
+
 func isDefaultField(f *field, fieldName string, fieldType string) bool {
 	return f.Name == fieldName && f.Typ == fieldType
 }
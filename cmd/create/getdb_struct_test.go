@@ -0,0 +1,27 @@
+package create
+
+import "testing"
+
+func TestGoType(t *testing.T) {
+	for _, c := range []struct {
+		modelType string
+		nullable  bool
+		typ, imp  string
+	}{
+		{"bigint(20)", false, "int64", ""},
+		{"tinyint(1)", false, "bool", ""},
+		{"int(11) unsigned", false, "int32", ""},
+		{"varchar(64)", false, "string", ""},
+		{"decimal(10,2)", false, "mysql.Decimal", mysqlImport},
+		{"decimal(20,6) unsigned", true, "mysql.Decimal", mysqlImport},
+		{"json", false, "mysql.JSON[interface{}]", mysqlImport},
+		{"json", true, "mysql.NullJSON[interface{}]", mysqlImport},
+		{"set('a','b')", false, "mysql.Set", mysqlImport},
+		{"datetime", false, "time.Time", timeImport},
+		{"blob", false, "[]byte", ""},
+	} {
+		if typ, imp := GoType(c.modelType, c.nullable); typ != c.typ || imp != c.imp {
+			t.Errorf("GoType(%q, %v) = %s, %q, want %s, %q", c.modelType, c.nullable, typ, imp, c.typ, c.imp)
+		}
+	}
+}
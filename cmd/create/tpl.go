@@ -31,7 +31,9 @@ var tplFiles = map[string]string{
 	"model/init.go": `package model
 
 import (
-	"strings"
+	"context"
+	"errors"
+	"time"
 
 	"github.com/swxctx/xmodel/mongo"
 	"github.com/swxctx/xmodel/mysql"
@@ -50,9 +52,12 @@ var (
 
 
 // Init initializes the model packet.
+// NOTE:
+//  The redis client is shared by the handlers, and created once;
+//  The initialized handlers are skipped, so it can be called again after a failure or Close.
 func Init(mysqlConfig *mysql.Config, mongoConfig *mongo.Config, redisConfig *redis.Config) error {
 	var err error
-	if redisConfig != nil {
+	if redisConfig != nil && redisClient == nil {
 		redisClient, err = redis.NewClient(redisConfig)
 		if err != nil {
 			return err
@@ -71,6 +76,23 @@ func Init(mysqlConfig *mysql.Config, mongoConfig *mongo.Config, redisConfig *red
 	return nil
 }
 
+// Close waits for the in-flight cache locks at most 30 seconds, and closes the model packet.
+// NOTE:
+//  The shared redis client is closed after both handlers.
+func Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	errs := []error{
+		mysqlHandler.Close(ctx),
+		mongoHandler.Close(ctx),
+	}
+	if redisClient != nil {
+		errs = append(errs, redisClient.Close())
+		redisClient = nil
+	}
+	return errors.Join(errs...)
+}
+
 // GetMysqlDB returns the mysql DB handler.
 func GetMysqlDB() *mysql.DB {
 	return mysqlHandler.DB
@@ -85,41 +107,6 @@ func GetMongoDB() *mongo.DB {
 func GetRedis() *redis.Client {
 	return redisClient
 }
-
-func index(s string, sub ...string) int {
-	var i, ii = -1, -1
-	for _, ss := range sub {
-		ii = strings.Index(s, ss)
-		if ii != -1 && (ii < i || i == -1) {
-			i = ii
-		}
-	}
-	return i
-}
-
-func insertZeroDeletedTsField(whereCond string) string {
-	whereCond = strings.TrimSpace(whereCond)
-	whereCond = strings.TrimRight(whereCond, ";")
-	i := index(
-		whereCond,
-		"` + "`" + `deleted_ts` + "`" + `",
-		" deleted_ts",
-	)
-	if i != -1 {
-		return whereCond
-	}
-	i = index(
-		whereCond,
-		"ORDER BY", "order by",
-		"GROUP BY", "group by",
-		"OFFSET", "offset",
-		"LIMIT", "limit",
-	)
-	if i == -1 {
-		return whereCond + " AND ` + "`" + `deleted_ts` + "`" + `=0"
-	}
-	return whereCond[:i] + " AND ` + "`" + `deleted_ts` + "`" + `=0 " + whereCond[i:]
-}
 `,
 
 	"args/const.gen.go": `package args
@@ -144,12 +131,11 @@ ${type_define_list}
 const mysqlModelTpl = `package model
 
 import (
-	"time"
-	"database/sql"
+	"context"
 	"unsafe"
 
-	"github.com/swxctx/xlog"
 	"github.com/swxctx/xmodel/mysql"
+	"github.com/swxctx/xmodel/mysql/builder"
 	"github.com/swxctx/xmodel/sqlx"
 
 	"${import_prefix}/args"
@@ -157,6 +143,15 @@ import (
 
 {{.Doc}}type {{.Name}} args.{{.Name}}
 
+// {{.Name}}Col the typed column names of {{.Name}}, used by the query builder.
+var {{.Name}}Col = struct {
+	{{range .Fields}}{{.Name}} builder.Column
+	{{end}}
+}{
+	{{range .Fields}}{{.Name}}: "{{.ModelName}}",
+	{{end}}
+}
+
 // To{{.Name}} converts to *{{.Name}} type.
 func To{{.Name}}(_{{.LowerFirstLetter}} *args.{{.Name}}) *{{.Name}} {
 	return (*{{.Name}})(unsafe.Pointer(_{{.LowerFirstLetter}}))
@@ -182,47 +177,26 @@ func (*{{.Name}}) TableName() string {
 	return "{{.SnakeName}}"
 }
 
-func (_{{.LowerFirstLetter}} *{{.Name}}) isZeroPrimaryKey() bool {
-	{{range .PrimaryFields}}var _{{.ModelName}} {{.Typ}}
-	if _{{$.LowerFirstLetter}}.{{.Name}}!=_{{.ModelName}}{
-		return false
-	}
-	{{end}}return true
-}
-
 var {{.LowerFirstName}}DB, _ = mysqlHandler.RegCacheableDB(new({{.Name}}), args.CacheExpire, ` + "args.{{.Name}}Sql" + `)
+var {{.LowerFirstName}}Table = mysql.NewTable[*{{.Name}}]({{.LowerFirstName}}DB)
 
 // Get{{.Name}}DB returns the {{.Name}} DB handler.
 func Get{{.Name}}DB() *mysql.CacheableDB {
 	return {{.LowerFirstName}}DB
 }
 
+// Get{{.Name}}Table returns the {{.Name}} typed table.
+func Get{{.Name}}Table() *mysql.Table[*{{.Name}}] {
+	return {{.LowerFirstName}}Table
+}
+
 // Insert{{.Name}} insert a {{.Name}} data into database.
 // NOTE:
 //  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
 //  Without cache layer.
 func Insert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, tx ...*sqlx.Tx) ({{if .IsDefaultPrimary}}int64,{{end}}error) {
-	_{{.LowerFirstLetter}}.UpdatedAt = time.Now().Unix()
-	if _{{.LowerFirstLetter}}.CreatedAt == 0 {
-		_{{.LowerFirstLetter}}.CreatedAt = _{{.LowerFirstLetter}}.UpdatedAt
-	}
-	return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}{{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-		var (
-			query string
-			isZeroPrimaryKey=_{{.LowerFirstLetter}}.isZeroPrimaryKey()
-		)
-		if isZeroPrimaryKey {
-			query = "INSERT INTO {{.NameSql}} ({{index .QuerySql 0}})VALUES({{index .QuerySql 1}});"
-		} else {
-			query = "INSERT INTO {{.NameSql}} ({{range .PrimaryFields}}` + "`{{.ModelName}}`," + `{{end}}{{index .QuerySql 0}})VALUES({{range .PrimaryFields}}:{{.ModelName}},{{end}}{{index .QuerySql 1}});"
-		}
-		{{if .IsDefaultPrimary}}r, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		if isZeroPrimaryKey && err==nil {
-			_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}}, err = r.LastInsertId()
-		}
-		{{else}}_, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		{{end}}return err
-	}, tx...)
+	err := {{.LowerFirstName}}Table.Insert(context.Background(), _{{.LowerFirstLetter}}, tx...)
+	return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}err
 }
 
 // Upsert{{.Name}} insert or update the {{.Name}} data by primary key.
@@ -236,56 +210,34 @@ func Insert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, tx ...*sqlx.Tx) ({{if .I
 //  Don't update the primary keys, 'created_at' key and 'deleted_ts' key;
 //  Update all fields except the primary keys, 'created_at' key and 'deleted_ts' key, if _updateFields is empty.
 func Upsert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields []string, tx ...*sqlx.Tx) ({{if .IsDefaultPrimary}}int64,{{end}}error) {
-	if _{{.LowerFirstLetter}}.UpdatedAt == 0 {
-		_{{.LowerFirstLetter}}.UpdatedAt = time.Now().Unix()
-	}
-	if _{{.LowerFirstLetter}}.CreatedAt == 0 {
-		_{{.LowerFirstLetter}}.CreatedAt = _{{.LowerFirstLetter}}.UpdatedAt
-	}
-	err := {{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-		var (
-			query string
-			isZeroPrimaryKey=_{{.LowerFirstLetter}}.isZeroPrimaryKey()
-		)
-		if isZeroPrimaryKey {
-			query = "INSERT INTO {{.NameSql}} ({{index .QuerySql 0}})VALUES({{index .QuerySql 1}})"
-		} else {
-			query = "INSERT INTO {{.NameSql}} ({{range .PrimaryFields}}` + "`{{.ModelName}}`," + `{{end}}{{index .QuerySql 0}})VALUES({{range .PrimaryFields}}:{{.ModelName}},{{end}}{{index .QuerySql 1}})"
-		}
-		query +=" ON DUPLICATE KEY UPDATE "
-		if len(_updateFields) == 0 {
-			query += "{{.UpsertSqlSuffix}}"
-		} else {
-			for _, s := range _updateFields {
-				if s == "updated_at" || s == "created_at" || s == "deleted_ts"{{range .PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
-					continue
-				}
-				query += ` + "\"`\" + s + \"`=VALUES(`\" + s + \"`),\"" + `
-			}
-			if query[len(query)-1] != ',' {
-				return nil
-			}
-			query += ` + "\"`updated_at`=VALUES(`updated_at`),`deleted_ts`=0;\"" + `
-		}
-		{{if .IsDefaultPrimary}}r, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		if isZeroPrimaryKey && err==nil {
-			var rowsAffected int64
-			rowsAffected, err = r.RowsAffected()
-			if rowsAffected == 1 {
-				_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}}, err = r.LastInsertId()
-			}
-		}
-		{{else}}_, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		{{end}}return err
-	}, tx...)
-	if err != nil {
-		return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}err
-	}
-	err = {{.LowerFirstName}}DB.DeleteCache(_{{.LowerFirstLetter}})
-	if err != nil {
-		xlog.Errorf("%s", err.Error())
-	}
-	return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}nil
+	err := {{.LowerFirstName}}Table.Upsert(context.Background(), _{{.LowerFirstLetter}}, _updateFields, tx...)
+	return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}err
+}
+
+// BatchInsert{{.Name}} insert some {{.Name}} data into database in batches.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  With cache layer;
+//  Use multi-row 'INSERT' statements, chunked by the row count and max_allowed_packet;
+//  Automatic fill 'created_at' and 'updated_at' fields;
+//  {{if .IsDefaultPrimary}}Write back the generated primary keys if they are all zero.{{else}}The primary keys must be specified.{{end}}
+func BatchInsert{{.Name}}(_{{.LowerFirstLetter}}s []*{{.Name}}, tx ...*sqlx.Tx) error {
+	_, err := {{.LowerFirstName}}DB.BatchInsert(_{{.LowerFirstLetter}}s, tx...)
+	return err
+}
+
+// BatchUpsert{{.Name}} insert or update some {{.Name}} data in batches.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  With cache layer;
+//  Use multi-row 'INSERT ... ON DUPLICATE KEY UPDATE' statements, chunked by the row count and max_allowed_packet;
+//  _updateFields' members must be db field style (snake format);
+//  Automatic update 'updated_at' field;
+//  Don't update the primary keys, 'created_at' key and 'deleted_ts' key;
+//  Update all fields except the primary keys, 'created_at' key and 'deleted_ts' key, if _updateFields is empty;
+//  The primary keys must be specified.
+func BatchUpsert{{.Name}}(_{{.LowerFirstLetter}}s []*{{.Name}}, _updateFields []string, tx ...*sqlx.Tx) error {
+	return {{.LowerFirstName}}DB.BatchUpsert(_{{.LowerFirstLetter}}s, _updateFields, tx...)
 }
 
 // Update{{.Name}}ByPrimary update the {{.Name}} data in database by primary key.
@@ -297,34 +249,7 @@ func Upsert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields []string,
 //  Don't update the primary keys, 'created_at' key and 'deleted_ts' key;
 //  Update all fields except the primary keys, 'created_at' key and 'deleted_ts' key, if _updateFields is empty.
 func Update{{.Name}}ByPrimary(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields []string, tx ...*sqlx.Tx) error {
-	_{{.LowerFirstLetter}}.UpdatedAt = time.Now().Unix()
-	err := {{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-		query := "UPDATE {{.NameSql}} SET "
-		if len(_updateFields) == 0 {
-			query += "{{.UpdateSql}} WHERE ` + "{{range $.PrimaryFields}}`{{.ModelName}}`=:{{.ModelName}} AND {{end}}`deleted_ts`=0" + ` LIMIT 1;"
-		} else {
-			for _, s := range _updateFields {
-				if s == "updated_at" || s == "created_at" || s == "deleted_ts"{{range .PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
-					continue
-				}
-				query += ` + "\"`\" + s + \"`=:\" + s + \",\"" + `
-			}
-			if query[len(query)-1] != ',' {
-				return nil
-			}
-			query += ` + "\"`updated_at`=:updated_at WHERE {{range .PrimaryFields}}`{{.ModelName}}`=:{{.ModelName}} AND {{end}}`deleted_ts`=0 LIMIT 1;\"" + `
-		}
-		_, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		return err
-	}, tx...)
-	if err != nil {
-		return err
-	}
-	err = {{.LowerFirstName}}DB.DeleteCache(_{{.LowerFirstLetter}})
-	if err != nil {
-		xlog.Errorf("%s", err.Error())
-	}
-	return nil
+	return {{.LowerFirstName}}Table.UpdateByPrimary(context.Background(), _{{.LowerFirstLetter}}, _updateFields, tx...)
 }
 
 {{range .UniqueFields}}
@@ -336,34 +261,7 @@ func Update{{.Name}}ByPrimary(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields [
 //  Don't update the primary keys, 'created_at' key and 'deleted_ts' key;
 //  Update all fields except the primary keys, '{{.ModelName}}' unique key, 'created_at' key and 'deleted_ts' key, if _updateFields is empty.
 func Update{{$.Name}}By{{.Name}}(_{{$.LowerFirstLetter}} *{{$.Name}}, _updateFields []string, tx ...*sqlx.Tx) error {
-	_{{$.LowerFirstLetter}}.UpdatedAt = time.Now().Unix()
-	err := {{$.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-		query := "UPDATE {{$.NameSql}} SET "
-		if len(_updateFields) == 0 {
-			query += "{{$.UpdateSql}} WHERE ` + "`{{.ModelName}}`=:{{.ModelName}} AND `deleted_ts`=0" + ` LIMIT 1;"
-		} else {
-			for _, s := range _updateFields {
-				if s == "updated_at" || s == "created_at" || s == "deleted_ts" || s == "{{.ModelName}}"{{range $.PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
-					continue
-				}
-				query += ` + "\"`\" + s + \"`=:\" + s + \",\"" + `
-			}
-			if query[len(query)-1] != ',' {
-				return nil
-			}
-			query += ` + "\"`updated_at`=:updated_at WHERE `{{.ModelName}}`=:{{.ModelName}} AND `deleted_ts`=0 LIMIT 1;\"" + `
-		}
-		_, err := tx.NamedExec(query, _{{$.LowerFirstLetter}})
-		return err
-	}, tx...)
-	if err != nil {
-		return err
-	}
-	err = {{$.LowerFirstName}}DB.DeleteCache(_{{$.LowerFirstLetter}},"{{.ModelName}}")
-	if err != nil {
-		xlog.Errorf("%s", err.Error())
-	}
-	return nil
+	return {{$.LowerFirstName}}Table.UpdateByUnique(context.Background(), _{{$.LowerFirstLetter}}, "{{.ModelName}}", _updateFields, tx...)
 }
 {{end}}
 
@@ -372,33 +270,9 @@ func Update{{$.Name}}By{{.Name}}(_{{$.LowerFirstLetter}} *{{$.Name}}, _updateFie
 //  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
 //  With cache layer.
 func Delete{{.Name}}ByPrimary({{range .PrimaryFields}}_{{.ModelName}} {{.Typ}}, {{end}}deleteHard bool, tx ...*sqlx.Tx) error {
-	var err error
-	if deleteHard {
-		// Immediately delete from the hard disk.
-		err = {{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-				_, err := tx.Exec("DELETE FROM {{.NameSql}} WHERE {{range .PrimaryFields}}` + "`{{.ModelName}}`=? AND {{end}}`deleted_ts`=0;" + `", {{range .PrimaryFields}}_{{.ModelName}}, {{end}})
-				return err
-			}, tx...)
-
-	}else {
-		// Delay delete from the hard disk.
-		ts := time.Now().Unix()
-		err = {{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-			_, err := tx.Exec("UPDATE {{.NameSql}} SET ` + "`updated_at`=?, `deleted_ts`=?" + ` WHERE {{range .PrimaryFields}}` + "`{{.ModelName}}`=? AND {{end}}`deleted_ts`=0;" + `", ts, ts, {{range .PrimaryFields}}_{{.ModelName}}, {{end}})
-			return err
-		}, tx...)
-	}
-	
-	if err != nil {
-		return err
-	}
-	err = {{.LowerFirstName}}DB.DeleteCache(&{{.Name}}{
+	return {{.LowerFirstName}}Table.DeleteByPrimary(context.Background(), &{{.Name}}{
 		{{range .PrimaryFields}}{{.Name}}:_{{.ModelName}},
-		{{end}} })
-	if err != nil {
-		xlog.Errorf("%s", err.Error())
-	}
-	return nil
+		{{end}} }, deleteHard, tx...)
 }
 
 {{range .UniqueFields}}
@@ -406,33 +280,9 @@ func Delete{{.Name}}ByPrimary({{range .PrimaryFields}}_{{.ModelName}} {{.Typ}},
 // NOTE:
 //  With cache layer.
 func Delete{{$.Name}}By{{.Name}}(_{{.ModelName}} {{.Typ}}, deleteHard bool, tx ...*sqlx.Tx) error {
-	var err error
-	if deleteHard {
-		// Immediately delete from the hard disk.
-		err = {{$.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-				_, err := tx.Exec("DELETE FROM {{$.NameSql}} WHERE ` + "`{{.ModelName}}`=? AND `deleted_ts`=0;" + `", _{{.ModelName}})
-				return err
-			}, tx...)
-
-	}else {
-		// Delay delete from the hard disk.
-		ts := time.Now().Unix()
-		err = {{$.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-			_, err := tx.Exec("UPDATE {{$.NameSql}} SET ` + "`updated_at`=?, `deleted_ts`=?" + ` WHERE ` + "`{{.ModelName}}`=? AND `deleted_ts`=0;" + `", ts, ts, _{{.ModelName}})
-			return err
-		}, tx...)
-	}
-	
-	if err != nil {
-		return err
-	}
-	err = {{$.LowerFirstName}}DB.DeleteCache(&{{$.Name}}{
+	return {{$.LowerFirstName}}Table.DeleteByUnique(context.Background(), &{{$.Name}}{
 		{{.Name}}:_{{.ModelName}},
-		},"{{.ModelName}}")
-	if err != nil {
-		xlog.Errorf("%s", err.Error())
-	}
-	return nil
+		}, "{{.ModelName}}", deleteHard, tx...)
 }
 {{end}}
 
@@ -442,21 +292,9 @@ func Delete{{$.Name}}By{{.Name}}(_{{.ModelName}} {{.Typ}}, deleteHard bool, tx .
 //  With cache layer;
 //  If @return bool=false error=nil, means the data is not exist.
 func Get{{.Name}}ByPrimary({{range .PrimaryFields}}_{{.ModelName}} {{.Typ}}, {{end}}) (*{{.Name}}, bool, error) {
-	var _{{.LowerFirstLetter}} = &{{.Name}}{
+	return {{.LowerFirstName}}Table.GetByPrimary(context.Background(), &{{.Name}}{
 		{{range .PrimaryFields}}{{.Name}}:_{{.ModelName}},
-		{{end}} }
-	err := {{.LowerFirstName}}DB.CacheGet(_{{.LowerFirstLetter}})
-	switch err {
-	case nil:
-		if _{{.LowerFirstLetter}}.CreatedAt == 0 || _{{.LowerFirstLetter}}.DeletedTs != 0{
-			return nil, false, nil
-		}
-		return _{{.LowerFirstLetter}}, true, nil
-	case sql.ErrNoRows:
-		return nil, false, nil
-	default:
-		return nil, false, err
-	}
+		{{end}} })
 }
 
 {{range .UniqueFields}}
@@ -465,21 +303,9 @@ func Get{{.Name}}ByPrimary({{range .PrimaryFields}}_{{.ModelName}} {{.Typ}}, {{e
 //  With cache layer;
 //  If @return bool=false error=nil, means the data is not exist.
 func Get{{$.Name}}By{{.Name}}(_{{.ModelName}} {{.Typ}}) (*{{$.Name}}, bool, error) {
-	var _{{$.LowerFirstLetter}} = &{{$.Name}}{
+	return {{$.LowerFirstName}}Table.GetByUnique(context.Background(), &{{$.Name}}{
 		{{.Name}}:_{{.ModelName}},
-		}
-	err := {{$.LowerFirstName}}DB.CacheGet(_{{$.LowerFirstLetter}},"{{.ModelName}}")
-	switch err {
-	case nil:
-		if _{{$.LowerFirstLetter}}.CreatedAt == 0 || _{{$.LowerFirstLetter}}.DeletedTs != 0{
-			return nil, false, nil
-		}
-		return _{{$.LowerFirstLetter}}, true, nil
-	case sql.ErrNoRows:
-		return nil, false, nil
-	default:
-		return nil, false, err
-	}
+		}, "{{.ModelName}}")
 }
 {{end}}
 
@@ -488,34 +314,55 @@ func Get{{$.Name}}By{{.Name}}(_{{.ModelName}} {{.Typ}}) (*{{$.Name}}, bool, erro
 //  Without cache layer;
 //  If @return bool=false error=nil, means the data is not exist.
 func Get{{.Name}}ByWhere(whereCond string, arg ...interface{}) (*{{.Name}}, bool, error) {
-	var _{{.LowerFirstLetter}} = new({{.Name}})
-	err := {{.LowerFirstName}}DB.Get(_{{.LowerFirstLetter}}, "SELECT {{range .PrimaryFields}}` + "`{{.ModelName}}`," + `{{end}}{{index .QuerySql 0}} FROM {{.NameSql}} WHERE "+insertZeroDeletedTsField(whereCond)+ " LIMIT 1;", arg...)
-	switch err {
-	case nil:
-		return _{{.LowerFirstLetter}}, true, nil
-	case sql.ErrNoRows:
-		return nil, false, nil
-	default:
-		return nil, false, err
-	}
+	return {{.LowerFirstName}}Table.GetWhere(context.Background(), whereCond, arg...)
 }
 
 // Select{{.Name}}ByWhere query some {{.Name}} data from database by WHERE condition.
 // NOTE:
 //  Without cache layer.
 func Select{{.Name}}ByWhere(whereCond string, arg ...interface{}) ([]*{{.Name}}, error) {
-	var objs = new([]*{{.Name}})
-	err := {{.LowerFirstName}}DB.Select(objs, "SELECT {{range .PrimaryFields}}` + "`{{.ModelName}}`," + `{{end}}{{index .QuerySql 0}} FROM {{.NameSql}} WHERE "+insertZeroDeletedTsField(whereCond), arg...)
-	return *objs, err
+	return {{.LowerFirstName}}Table.SelectWhere(context.Background(), whereCond, arg...)
 }
 
 // Count{{.Name}}ByWhere count {{.Name}} data number from database by WHERE condition.
 // NOTE:
 //  Without cache layer.
 func Count{{.Name}}ByWhere(whereCond string, arg ...interface{}) (int64, error) {
-	var count int64
-	err := {{.LowerFirstName}}DB.Get(&count, "SELECT count(*) FROM {{.NameSql}} WHERE "+insertZeroDeletedTsField(whereCond), arg...)
-	return count, err
+	return {{.LowerFirstName}}Table.CountWhere(context.Background(), whereCond, arg...)
+}
+
+// Each{{.Name}}ByWhere streams {{.Name}} data from database by WHERE condition into fn, in batches by primary key.
+// NOTE:
+//  Without cache layer;
+//  whereCond must be a pure condition without ORDER BY, LIMIT, etc.;
+//  Stops and returns the error if fn returns an error or ctx is done.
+func Each{{.Name}}ByWhere(ctx context.Context, fn func(*{{.Name}}) error, whereCond string, arg ...interface{}) error {
+	return {{.LowerFirstName}}Table.EachWhere(ctx, fn, whereCond, arg...)
+}
+
+// Get{{.Name}}ByQuery query a {{.Name}} data from database by the query builder.
+// NOTE:
+//  Without cache layer;
+//  The table, columns, 'deleted_ts' filter and 'LIMIT 1' are set automatically;
+//  If @return bool=false error=nil, means the data is not exist.
+func Get{{.Name}}ByQuery(q *builder.Query) (*{{.Name}}, bool, error) {
+	return {{.LowerFirstName}}Table.GetByQuery(context.Background(), q)
+}
+
+// Select{{.Name}}ByQuery query some {{.Name}} data from database by the query builder.
+// NOTE:
+//  Without cache layer;
+//  The table, columns and 'deleted_ts' filter are set automatically.
+func Select{{.Name}}ByQuery(q *builder.Query) ([]*{{.Name}}, error) {
+	return {{.LowerFirstName}}Table.SelectByQuery(context.Background(), q)
+}
+
+// Count{{.Name}}ByQuery count {{.Name}} data number from database by the query builder.
+// NOTE:
+//  Without cache layer;
+//  The table and 'deleted_ts' filter are set automatically.
+func Count{{.Name}}ByQuery(q *builder.Query) (int64, error) {
+	return {{.LowerFirstName}}Table.CountByQuery(context.Background(), q)
 }
 `
 
@@ -546,14 +393,6 @@ func (*{{.Name}}) TableName() string {
 	return "{{.SnakeName}}"
 }
 
-func (_{{.LowerFirstLetter}} *{{.Name}}) isZeroPrimaryKey() bool {
-	{{range .PrimaryFields}}var _{{.ModelName}} {{.Typ}}
-	if _{{$.LowerFirstLetter}}.{{.Name}}!=_{{.ModelName}}{
-		return false
-	}
-	{{end}}return true
-}
-
 var {{.LowerFirstName}}DB, _ = mongoHandler.RegCacheableDB(new({{.Name}}), args.CacheExpire)
 
 // Get{{.Name}}DB returns the {{.Name}} DB handler.
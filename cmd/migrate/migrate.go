@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/mysql"
+)
+
+// Config migrate command config
+type Config struct {
+	MysqlConfig *mysql.Config
+	// the directory of the numbered .sql files
+	Dir    string
+	DryRun bool
+}
+
+// Run runs the migrate action: 'up', 'down' or 'status'.
+// NOTE:
+//  args of 'down' is the number of migrations to revert, default 1.
+func Run(cfg Config, action string, args ...string) {
+	cfg.MysqlConfig.NoCache = true
+	db, err := mysql.Connect(cfg.MysqlConfig, nil)
+	if err != nil {
+		xlog.Fatalf("[XModel] connect mysql: %s", err.Error())
+	}
+	defer db.Close()
+	if err = db.LoadMigrations(cfg.Dir); err != nil {
+		xlog.Fatalf("[XModel] load migrations: %s", err.Error())
+	}
+
+	ctx := context.Background()
+	switch action {
+	case "", "up":
+		migrations, err := db.Migrate(ctx, cfg.DryRun)
+		printMigrations("applied", cfg.DryRun, migrations)
+		if err != nil {
+			xlog.Fatalf("[XModel] migrate: %s", err.Error())
+		}
+	case "down":
+		n := 1
+		if len(args) > 0 {
+			n, err = strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				xlog.Fatalf("[XModel] invalid rollback number: %s", args[0])
+			}
+		}
+		migrations, err := db.Rollback(ctx, n, cfg.DryRun)
+		printMigrations("reverted", cfg.DryRun, migrations)
+		if err != nil {
+			xlog.Fatalf("[XModel] rollback: %s", err.Error())
+		}
+	case "status":
+		list, err := db.Status(ctx)
+		if err != nil {
+			xlog.Fatalf("[XModel] status: %s", err.Error())
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range list {
+			status, appliedAt := "pending", ""
+			if s.Applied {
+				status = "applied"
+				appliedAt = time.Unix(s.AppliedAt, 0).Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				status += " (modified)"
+			}
+			if s.Missing {
+				status += " (missing)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+		}
+		w.Flush()
+	default:
+		xlog.Fatalf("[XModel] unknown migrate action: %s, want up, down or status", action)
+	}
+}
+
+func printMigrations(done string, dryRun bool, migrations []*mysql.Migration) {
+	if dryRun {
+		done = "to be " + done
+	}
+	if len(migrations) == 0 {
+		xlog.Infof("[XModel] no migration %s", done)
+		return
+	}
+	for _, m := range migrations {
+		xlog.Infof("[XModel] %s: %d_%s", done, m.Version, m.Name)
+	}
+}
@@ -0,0 +1,211 @@
+// Package crypt AES-GCM column encryption, used by the fields tagged `encrypt:"aes"`.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+// the tag values registered by Register
+const (
+	// TagAES randomized encryption, equal values are encrypted differently
+	TagAES = "aes"
+	// TagAESDeterministic deterministic encryption, the field can be used as a lookup key
+	TagAESDeterministic = "aes,deterministic"
+)
+
+// the prefix of the encrypted value, whose format is '$<key id>$<base64 of nonce and sealed data>'
+const prefix = '$'
+
+// ErrNotEncrypted error: the value is not encrypted by this package
+var ErrNotEncrypted = errors.New("crypt: value is not encrypted")
+
+// KeyProvider provides the keys to encrypt and decrypt.
+// NOTE:
+//  The keys must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256;
+//  The key id must not contain '$'.
+type KeyProvider interface {
+	// ActiveKey returns the key to encrypt new values, and its id.
+	ActiveKey() (id string, key []byte, err error)
+	// Key returns the key of id to decrypt values.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys a KeyProvider of fixed keys, key rotation is done by adding a key and changing Active.
+type StaticKeys struct {
+	Active string            // the id of the key to encrypt
+	Keys   map[string][]byte // key: id, value: key
+}
+
+// ActiveKey implements the KeyProvider interface.
+func (s *StaticKeys) ActiveKey() (string, []byte, error) {
+	key, err := s.Key(s.Active)
+	return s.Active, key, err
+}
+
+// Key implements the KeyProvider interface.
+func (s *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("crypt: unknown key id %q", id)
+	}
+	return key, nil
+}
+
+// Options the options of the AES codec.
+type Options struct {
+	// PlaintextPassthrough decodes the values which are not encrypted by this package as they are,
+	// instead of returning ErrNotEncrypted.
+	// Enable it while turning on the encryption of a column holding plaintext rows, until they are re-encrypted.
+	PlaintextPassthrough bool
+}
+
+// AES the AES-GCM sqlx.FieldCodec.
+type AES struct {
+	provider      KeyProvider
+	deterministic bool
+	passthrough   bool
+}
+
+var _ sqlx.FieldCodec = (*AES)(nil)
+
+// NewAES creates an AES-GCM codec.
+// NOTE:
+//  If deterministic is true, the nonce is derived from the key and the value, so that equal values
+//  are encrypted equally with the same key, which reveals the equality of values;
+//  After rotating the active key, lookups by deterministic fields only match the values
+//  encrypted with the new key, so the old rows should be re-encrypted.
+func NewAES(provider KeyProvider, deterministic bool) *AES {
+	return NewAESWithOptions(provider, deterministic, nil)
+}
+
+// NewAESWithOptions creates an AES-GCM codec with the options, see NewAES.
+// NOTE:
+//  opts may be nil for the defaults.
+func NewAESWithOptions(provider KeyProvider, deterministic bool, opts *Options) *AES {
+	a := &AES{
+		provider:      provider,
+		deterministic: deterministic,
+	}
+	if opts != nil {
+		a.passthrough = opts.PlaintextPassthrough
+	}
+	return a
+}
+
+// Register registers the codecs of TagAES and TagAESDeterministic to sqlx.
+func Register(provider KeyProvider) {
+	RegisterWithOptions(provider, nil)
+}
+
+// RegisterWithOptions registers the codecs of TagAES and TagAESDeterministic with the options to sqlx.
+// NOTE:
+//  opts may be nil for the defaults.
+func RegisterWithOptions(provider KeyProvider, opts *Options) {
+	sqlx.RegisterFieldCodec(TagAES, NewAESWithOptions(provider, false, opts))
+	sqlx.RegisterFieldCodec(TagAESDeterministic, NewAESWithOptions(provider, true, opts))
+}
+
+// Deterministic implements the sqlx.FieldCodec interface.
+func (a *AES) Deterministic() bool {
+	return a.deterministic
+}
+
+// Encode implements the sqlx.FieldCodec interface.
+func (a *AES) Encode(plain []byte) ([]byte, error) {
+	id, key, err := a.provider.ActiveKey()
+	if err != nil {
+		return nil, err
+	}
+	if strings.IndexByte(id, prefix) != -1 {
+		return nil, fmt.Errorf("crypt: key id contains '%c': %q", prefix, id)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plain)+gcm.Overhead())
+	if a.deterministic {
+		mac := hmac.New(sha256.New, nonceKey(key))
+		mac.Write(plain)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, []byte(id))
+
+	data := make([]byte, 0, len(id)+2+base64.RawURLEncoding.EncodedLen(len(sealed)))
+	data = append(data, prefix)
+	data = append(data, id...)
+	data = append(data, prefix)
+	return base64.RawURLEncoding.AppendEncode(data, sealed), nil
+}
+
+// Decode implements the sqlx.FieldCodec interface.
+// NOTE:
+//  With PlaintextPassthrough, the value not in the encrypted format is returned as it is,
+//  while the value in the format that fails to decrypt still returns the error.
+func (a *AES) Decode(data []byte) ([]byte, error) {
+	plain, err := a.decode(data)
+	if err == ErrNotEncrypted && a.passthrough {
+		return data, nil
+	}
+	return plain, err
+}
+
+func (a *AES) decode(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != prefix {
+		return nil, ErrNotEncrypted
+	}
+	i := bytes.IndexByte(data[1:], prefix)
+	if i == -1 {
+		return nil, ErrNotEncrypted
+	}
+	id := string(data[1 : i+1])
+	sealed, err := base64.RawURLEncoding.DecodeString(string(data[i+2:]))
+	if err != nil {
+		return nil, ErrNotEncrypted
+	}
+	key, err := a.provider.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrNotEncrypted
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("crypt: decrypt with key %q: %s", id, err.Error())
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: %s", err.Error())
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonceKey derives the HMAC key of the deterministic nonce from the encryption key.
+func nonceKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("xmodel/crypt deterministic nonce"))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,97 @@
+package crypt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+func testKeys() *StaticKeys {
+	return &StaticKeys{
+		Active: "k1",
+		Keys: map[string][]byte{
+			"k1": bytes.Repeat([]byte{1}, 32),
+			"k2": bytes.Repeat([]byte{2}, 16),
+		},
+	}
+}
+
+func TestAES(t *testing.T) {
+	keys := testKeys()
+	random, deterministic := NewAES(keys, false), NewAES(keys, true)
+	plain := []byte("13800000000")
+
+	a, err := random.Encode(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := random.Encode(plain)
+	if bytes.Equal(a, b) || !bytes.HasPrefix(a, []byte("$k1$")) {
+		t.Fatalf("randomized Encode() = %s, %s", a, b)
+	}
+	a, _ = deterministic.Encode(plain)
+	b, _ = deterministic.Encode(plain)
+	if !bytes.Equal(a, b) {
+		t.Fatalf("deterministic Encode() = %s, %s", a, b)
+	}
+
+	// rotation: the old value is still decrypted by its key id
+	keys.Active = "k2"
+	c, _ := random.Encode(plain)
+	for _, data := range [][]byte{a, c} {
+		got, err := random.Decode(data)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("Decode(%s) = %s, %v", data, got, err)
+		}
+	}
+
+	if _, err = random.Decode(plain); err != ErrNotEncrypted {
+		t.Fatalf("Decode(plain) error = %v", err)
+	}
+	c[len(c)-2] ^= 1
+	if _, err = random.Decode(c); err == nil {
+		t.Fatal("Decode(tampered) returns nil error")
+	}
+
+	// the plaintext rows before the encryption is turned on
+	passthrough := NewAESWithOptions(keys, false, &Options{PlaintextPassthrough: true})
+	if got, err := passthrough.Decode(plain); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("Decode(plain) with passthrough = %s, %v", got, err)
+	}
+	if got, err := passthrough.Decode(a); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("Decode(%s) with passthrough = %s, %v", a, got, err)
+	}
+	if _, err = passthrough.Decode(c); err == nil {
+		t.Fatal("Decode(tampered) with passthrough returns nil error")
+	}
+}
+
+func TestBindNamed(t *testing.T) {
+	Register(testKeys())
+	type user struct {
+		Id    int64  `json:"id"`
+		Phone string `json:"phone" encrypt:"aes,deterministic"`
+		Card  []byte `json:"card" encrypt:"aes"`
+	}
+	u := &user{Id: 1, Phone: "13800000000"}
+	_, args, err := sqlx.BindNamed(sqlx.QUESTION, "UPDATE `user` SET `card`=:card WHERE `id`=:id AND `phone`=:phone", u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args[0].([]byte)) != 0 || args[1] != int64(1) {
+		t.Fatalf("BindNamed() args = %v", args)
+	}
+	phone, _ := args[2].(string)
+	plain, err := NewAES(testKeys(), true).Decode([]byte(phone))
+	if err != nil || string(plain) != u.Phone {
+		t.Fatalf("BindNamed() phone = %s, decoded %s, %v", phone, plain, err)
+	}
+
+	type bad struct {
+		Phone string `json:"phone" encrypt:"rot13"`
+	}
+	if _, _, err = sqlx.BindNamed(sqlx.QUESTION, "SELECT :phone", &bad{Phone: "x"}); err == nil {
+		t.Fatal("BindNamed() with unregistered codec returns nil error")
+	}
+}
@@ -3,6 +3,7 @@ module github.com/swxctx/xmodel
 go 1.23
 
 require (
+	github.com/alicebob/miniredis/v2 v2.37.0
 	github.com/go-redis/redis/v7 v7.4.1
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/swxctx/gutil v0.0.0-20241220040728-82b4e476a430
@@ -10,4 +11,5 @@ require (
 	github.com/urfave/cli v1.22.16
 	golang.org/x/crypto v0.31.0
 	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+	gopkg.in/yaml.v3 v3.0.1
 )
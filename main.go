@@ -3,8 +3,11 @@ package main
 import (
 	"os"
 
+	"github.com/swxctx/xmodel/cmd/cache"
 	"github.com/swxctx/xmodel/cmd/create"
 	"github.com/swxctx/xmodel/cmd/info"
+	"github.com/swxctx/xmodel/cmd/migrate"
+	"github.com/swxctx/xmodel/mysql"
 	"github.com/urfave/cli"
 )
 
@@ -105,7 +108,88 @@ func main() {
 		},
 	}
 
-	app.Commands = []cli.Command{newCom, tplCom}
+	// run the versioned sql migrations
+	migrateCom := cli.Command{
+		Name:      "migrate",
+		Usage:     "Run the versioned sql migrations: up, down [n] or status",
+		ArgsUsage: "[up|down [n]|status]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "dir, d",
+				Value: "./migrations",
+				Usage: "The directory of the numbered .sql files",
+			},
+			cli.BoolFlag{
+				Name:  "dry_run",
+				Usage: "Only print the migrations to run",
+			},
+			cli.StringFlag{
+				Name:  "host",
+				Value: "localhost",
+				Usage: "mysql host ip",
+			},
+			cli.IntFlag{
+				Name:  "port",
+				Value: 3306,
+				Usage: "mysql host port",
+			},
+			cli.StringFlag{
+				Name:  "username, user",
+				Value: "root",
+				Usage: "mysql username",
+			},
+			cli.StringFlag{
+				Name:  "password, pwd",
+				Value: "",
+				Usage: "mysql password",
+			},
+			cli.StringFlag{
+				Name:  "db",
+				Value: "test",
+				Usage: "mysql database",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			migrate.Run(migrate.Config{
+				MysqlConfig: &mysql.Config{
+					Host:     c.String("host"),
+					Port:     c.Int("port"),
+					Username: c.String("username"),
+					Password: c.String("password"),
+					Database: c.String("db"),
+				},
+				Dir:    c.String("dir"),
+				DryRun: c.Bool("dry_run"),
+			}, c.Args().First(), c.Args().Tail()...)
+			return nil
+		},
+	}
+
+	// warm up the caches of the tables
+	cacheCom := cli.Command{
+		Name:  "cache",
+		Usage: "Manage the caches of the tables",
+		Subcommands: []cli.Command{
+			{
+				Name:      "warm",
+				Usage:     "Warm up the caches of the tables in the config file, or only the given tables",
+				ArgsUsage: "[table...]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "config, c",
+						Value: "./warm.yaml",
+						Usage: "The yaml config file of mysql, redis and the tables",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					cache.Warm(c.String("config"), c.Args()...)
+					return nil
+				},
+			},
+		},
+	}
+
+	app.Commands = []cli.Command{newCom, tplCom, migrateCom, cacheCom}
 	app.Run(os.Args)
 }
 
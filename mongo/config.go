@@ -3,6 +3,7 @@ package mongo
 import (
 	"time"
 
+	"github.com/swxctx/xmodel/retry"
 	"gopkg.in/mgo.v2"
 )
 
@@ -18,6 +19,8 @@ type Config struct {
 	// PoolLimit defines the per-server socket pool limit. Defaults to 4096.
 	// See Session.SetPoolLimit for details.
 	PoolLimit int `yaml:"pool_limit" json:"pool_limit"`
+	// the retry policy of connecting, and the background health checker.
+	Retry retry.Policy `yaml:"retry" json:"retry"`
 	// NoCache whether to disable cache
 	NoCache bool `yaml:"no_cache" json:"no_cache"`
 }
@@ -1,6 +1,7 @@
 package mongo
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"github.com/swxctx/gutil"
 	"github.com/swxctx/xlog"
 	"github.com/swxctx/xmodel/redis"
+	"github.com/swxctx/xmodel/retry"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -32,6 +34,51 @@ type DB struct {
 	dbConfig     *Config
 	redisConfig  *redis.Config
 	cacheableDBs map[string]*CacheableDB
+	health       retry.Health
+}
+
+// dial connects to mongodb, retries by dbConfig.Retry.
+func dial(dbConfig *Config) (*mgo.Session, error) {
+	var session *mgo.Session
+	err := retry.Do(context.Background(), &dbConfig.Retry, "mongodb", func() (err error) {
+		session, err = mgo.DialWithInfo(dbConfig.Source())
+		return err
+	})
+	return session, err
+}
+
+// startHealthCheck marks the DB healthy, and starts the background health checker if configured.
+func (d *DB) startHealthCheck() {
+	d.health.Set(true)
+	d.health.Start("mongodb", d.dbConfig.Retry.HealthCheckPeriod(), func() error {
+		if d.Session.Ping() == nil {
+			return nil
+		}
+		// discard the broken sockets and reconnect
+		d.Session.Refresh()
+		return d.Session.Ping()
+	})
+}
+
+// Healthy returns whether the database is connected and passed the last health check.
+func (d *DB) Healthy() bool {
+	return d.health.Healthy()
+}
+
+// WaitReady blocks until the database is healthy or ctx is done.
+// NOTE:
+//  With *PreDB, it waits for the initialization too.
+func (d *DB) WaitReady(ctx context.Context) error {
+	return d.health.WaitReady(ctx)
+}
+
+// Close stops the health checker and closes the session.
+func (d *DB) Close() {
+	d.health.Stop()
+	d.health.Set(false)
+	if d.Session != nil {
+		d.Session.Close()
+	}
 }
 
 func (c *CacheableDB) getSession() (*mgo.Session, error) {
@@ -1,18 +1,28 @@
 package mongo
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/swxctx/xmodel/redis"
-	"gopkg.in/mgo.v2"
 )
 
 // PreDB preset *DB
 type PreDB struct {
 	*DB
-	preFuncs map[string]func() error
+	mu       sync.Mutex
+	preFuncs []*preFunc // in registration order
 	inited   bool
+	ownCache bool // the redis client is created by Init
+}
+
+// preFunc the registration of a collection, called at initialization.
+type preFunc struct {
+	tableName string
+	fn        func() error
 }
 
 // NewPreDB creates a unconnected *DB
@@ -21,11 +31,16 @@ func NewPreDB() *PreDB {
 		DB: &DB{
 			cacheableDBs: make(map[string]*CacheableDB),
 		},
-		preFuncs: make(map[string]func() error),
 	}
 }
 
+// Init initialize *DB.
+// NOTE:
+//  Does nothing if it is initialized.
 func (p *PreDB) Init(dbConfig *Config, redisConfig *redis.Config) (err error) {
+	if p.Inited() {
+		return nil
+	}
 	var cache *redis.Client
 	if !dbConfig.NoCache && redisConfig != nil {
 		cache, err = redis.NewClient(redisConfig)
@@ -33,13 +48,30 @@ func (p *PreDB) Init(dbConfig *Config, redisConfig *redis.Config) (err error) {
 			return err
 		}
 	}
-	return p.Init2(dbConfig, cache)
+	if err = p.init(dbConfig, cache, cache != nil); err != nil && cache != nil {
+		cache.Close()
+	}
+	return err
 }
 
-// Init initialize *DB.
+// Init2 initialize *DB.
+// NOTE:
+//  Registers the collections in registration order;
+//  Does nothing if it is initialized;
+//  It can be called again after Close.
 func (p *PreDB) Init2(dbConfig *Config, redisClient *redis.Client) (err error) {
+	return p.init(dbConfig, redisClient, false)
+}
+
+// init initializes *DB, ownCache is whether redisClient is created by Init and closed by Close.
+func (p *PreDB) init(dbConfig *Config, redisClient *redis.Client, ownCache bool) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inited {
+		return nil
+	}
 	// connect to mongodb
-	db, err := mgo.DialWithInfo(dbConfig.Source())
+	db, err := dial(dbConfig)
 	if err != nil {
 		return err
 	}
@@ -48,31 +80,76 @@ func (p *PreDB) Init2(dbConfig *Config, redisClient *redis.Client) (err error) {
 	if !dbConfig.NoCache && redisClient != nil {
 		p.DB.Cache = redisClient
 		p.DB.redisConfig = redisClient.Config()
+		p.ownCache = ownCache
 	}
 
 	for _, preFunc := range p.preFuncs {
-		if err = preFunc(); err != nil {
+		if err = preFunc.fn(); err != nil {
+			p.DB.Close()
+			p.reset()
 			return err
 		}
 	}
 
 	p.inited = true
+	p.DB.startHealthCheck()
 	return nil
 }
 
-// RegCacheableDB registers a cacheable table.
-func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duration) (*CacheableDB, error) {
-	if p.inited {
-		return p.DB.RegCacheableDB(ormStructPtr, cacheExpiration)
+// Inited returns whether the *DB is initialized.
+func (p *PreDB) Inited() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inited
+}
+
+// Close waits for the in-flight cache locks, and closes the session.
+// NOTE:
+//  The redis client is closed only if it is created by Init, the one passed to Init2 is left to the caller;
+//  If ctx is done before the locks are released, it still closes the session and returns ctx.Err();
+//  The registered *CacheableDB are kept, and are available again after re-initialization.
+func (p *PreDB) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.inited {
+		return nil
+	}
+	var errs []error
+	if p.DB.Cache != nil {
+		errs = append(errs, p.DB.Cache.WaitLocks(ctx))
 	}
+	p.DB.Close()
+	if p.DB.Cache != nil && p.ownCache {
+		errs = append(errs, p.DB.Cache.Close())
+	}
+	p.reset()
+	return errors.Join(errs...)
+}
 
+// reset drops the closed clients and the registered collections.
+func (p *PreDB) reset() {
+	p.DB.Session = nil
+	p.DB.Cache = nil
+	p.DB.redisConfig = nil
+	p.ownCache = false
+	p.DB.cacheableDBs = make(map[string]*CacheableDB)
+	p.inited = false
+}
+
+// RegCacheableDB registers a cacheable table.
+// NOTE:
+//  If the *PreDB is not initialized, the table is registered at initialization.
+func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duration) (*CacheableDB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	tableName := ormStructPtr.TableName()
-	if _, ok := p.preFuncs[ormStructPtr.TableName()]; ok {
-		return nil, fmt.Errorf("re-register cacheable table: %s", tableName)
+	for _, f := range p.preFuncs {
+		if f.tableName == tableName {
+			return nil, fmt.Errorf("re-register cacheable table: %s", tableName)
+		}
 	}
 	var cacheableDB = new(CacheableDB)
-
-	var preFunc = func() error {
+	var fn = func() error {
 		_cacheableDB, err := p.DB.RegCacheableDB(ormStructPtr, cacheExpiration)
 		if err == nil {
 			*cacheableDB = *_cacheableDB
@@ -80,6 +157,11 @@ func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Dura
 		}
 		return err
 	}
-	p.preFuncs[tableName] = preFunc
+	if p.inited {
+		if err := fn(); err != nil {
+			return nil, err
+		}
+	}
+	p.preFuncs = append(p.preFuncs, &preFunc{tableName: tableName, fn: fn})
 	return cacheableDB, nil
 }
@@ -0,0 +1,289 @@
+package mysql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+// AuditAction the kind of an audited write.
+type AuditAction string
+
+// the audited actions
+const (
+	AuditInsert     AuditAction = "insert"
+	AuditUpdate     AuditAction = "update"
+	AuditDelete     AuditAction = "delete"
+	AuditSoftDelete AuditAction = "soft_delete"
+	AuditRestore    AuditAction = "restore"
+)
+
+// AuditChange the change of a column.
+type AuditChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditRecord the audit record of a written row.
+// NOTE:
+//  The values of the encoded fields (see sqlx.EncryptTag) are recorded encoded;
+//  Before is nil for an insert, and After is nil for a hard delete.
+type AuditRecord struct {
+	Table      string                 `json:"table"`
+	Action     AuditAction            `json:"action"`
+	PrimaryKey map[string]interface{} `json:"primary_key"`
+	Actor      string                 `json:"actor"`
+	Before     map[string]interface{} `json:"before"`
+	After      map[string]interface{} `json:"after"`
+	Diff       []AuditChange          `json:"diff"` // the changed columns, except the 'updated_at' role
+	CreatedAt  int64                  `json:"created_at"`
+}
+
+// AuditSink receives the audit records.
+// NOTE:
+//  WriteAudit is called in the transaction of the write, returning an error rolls back the write.
+type AuditSink interface {
+	WriteAudit(ctx context.Context, tx *sqlx.Tx, record *AuditRecord) error
+}
+
+// AuditSinkFunc an AuditSink function.
+type AuditSinkFunc func(ctx context.Context, tx *sqlx.Tx, record *AuditRecord) error
+
+// WriteAudit implements the AuditSink interface.
+func (f AuditSinkFunc) WriteAudit(ctx context.Context, tx *sqlx.Tx, record *AuditRecord) error {
+	return f(ctx, tx, record)
+}
+
+// DefaultAuditTable the default table name of TableAuditSink.
+const DefaultAuditTable = "audit_log"
+
+// AuditTableSQL the DDL of the TableAuditSink table, '%s' is the table name.
+const AuditTableSQL = "CREATE TABLE IF NOT EXISTS `%s` (" +
+	"`id` bigint unsigned NOT NULL AUTO_INCREMENT," +
+	"`table_name` varchar(64) NOT NULL," +
+	"`action` varchar(16) NOT NULL," +
+	"`pri_key` varchar(255) NOT NULL," +
+	"`actor` varchar(128) NOT NULL DEFAULT ''," +
+	"`diff` json NOT NULL," +
+	"`before_row` json NULL," +
+	"`after_row` json NULL," +
+	"`created_at` bigint NOT NULL," +
+	"PRIMARY KEY (`id`)," +
+	"KEY `idx_table_pri_key` (`table_name`,`pri_key`)," +
+	"KEY `idx_actor` (`actor`)" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;"
+
+// TableAuditSink writes the audit records into a mysql table, created by AuditTableSQL.
+type TableAuditSink struct {
+	table string
+}
+
+var _ AuditSink = (*TableAuditSink)(nil)
+
+// NewTableAuditSink creates an AuditSink of the table, DefaultAuditTable if tableName is empty.
+func NewTableAuditSink(tableName string) *TableAuditSink {
+	if tableName == "" {
+		tableName = DefaultAuditTable
+	}
+	return &TableAuditSink{table: tableName}
+}
+
+// TableName returns the table name.
+func (s *TableAuditSink) TableName() string {
+	return s.table
+}
+
+// CreateTableSQL returns the DDL of the table.
+func (s *TableAuditSink) CreateTableSQL() string {
+	return fmt.Sprintf(AuditTableSQL, s.table)
+}
+
+// WriteAudit implements the AuditSink interface.
+func (s *TableAuditSink) WriteAudit(ctx context.Context, tx *sqlx.Tx, record *AuditRecord) error {
+	var (
+		values = []interface{}{record.PrimaryKey, record.Diff, record.Before, record.After}
+		args   = make([]interface{}, 0, len(values))
+	)
+	if record.Diff == nil {
+		values[1] = []AuditChange{}
+	}
+	for i, value := range values {
+		if i > 1 && reflect.ValueOf(value).IsNil() {
+			args = append(args, nil)
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("TableAuditSink.WriteAudit(): %s", err.Error())
+		}
+		args = append(args, data)
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO `"+s.table+"` (`table_name`,`action`,`pri_key`,`actor`,`diff`,`before_row`,`after_row`,`created_at`)VALUES(?,?,?,?,?,?,?,?);",
+		record.Table, string(record.Action), args[0], record.Actor, args[1], args[2], args[3], record.CreatedAt)
+	return err
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx with the actor ID, recorded by the audited writes.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor ID set by WithActor, empty if not set.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// EnableAudit records the writes of the table to sink, disables the audit if sink is nil.
+// NOTE:
+//  Call it before the table is used, it can be called before the *PreDB is initialized;
+//  Insert, Upsert, Update*, Delete* of *Table, SoftDelete, Restore, ForceDelete,
+//  BatchInsert and BatchUpsert are audited, so are the generated model functions;
+//  The written rows are locked and read by 'SELECT ... FOR UPDATE' in the transaction of the write
+//  (a new one if tx is not specified), and the records are written in the same transaction;
+//  Writes by hand-written SQL are not audited.
+func (c *CacheableDB) EnableAudit(sink AuditSink) {
+	c.audit = sink
+}
+
+// audited executes the write fn of the rows, and records the audit of the rows in the same transaction.
+// NOTE:
+//  The rows are looked up by uniqueField (or the primary key) before fn, except for AuditInsert,
+//  and by the primary key after fn;
+//  The action of a row is AuditInsert if it did not exist, AuditDelete if it does not exist after fn,
+//  otherwise action.
+func (c *CacheableDB) audited(ctx context.Context, action AuditAction, rows []reflect.Value, uniqueField string, fn func(tx ...*sqlx.Tx) error, tx ...*sqlx.Tx) error {
+	sink := c.audit
+	if sink == nil {
+		return fn(tx...)
+	}
+	return c.DB.TransactCallback(func(_tx *sqlx.Tx) error {
+		befores := make([]reflect.Value, len(rows))
+		if action != AuditInsert {
+			for i, v := range rows {
+				before, err := c.lockRow(ctx, _tx, v, uniqueField)
+				if err != nil {
+					return err
+				}
+				befores[i] = before
+			}
+		}
+		if err := fn(_tx); err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		for i, v := range rows {
+			if befores[i].IsValid() {
+				v = befores[i]
+			}
+			after, err := c.lockRow(ctx, _tx, v, "")
+			if err != nil {
+				return err
+			}
+			record, err := c.auditRecord(action, befores[i], after)
+			if err != nil {
+				return err
+			}
+			if record == nil {
+				continue
+			}
+			record.Actor = ActorFromContext(ctx)
+			record.CreatedAt = now
+			if err = sink.WriteAudit(ctx, _tx, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, tx...)
+}
+
+// lockRow reads and locks the row of the key of structElemValue in tx, returns invalid value if not exist.
+func (c *CacheableDB) lockRow(ctx context.Context, tx *sqlx.Tx, structElemValue reflect.Value, uniqueField string) (reflect.Value, error) {
+	_, where, args, err := c.whereKey(structElemValue.Addr().Interface().(Cacheable), uniqueField)
+	if err != nil {
+		return emptyValue, err
+	}
+	dest := reflect.New(c.structType)
+	err = tx.GetContext(ctx, dest.Interface(), c.queries.selectAll+" WHERE "+strings.Join(where, " AND ")+" LIMIT 1 FOR UPDATE;", args...)
+	if IsNoRows(err) {
+		return emptyValue, nil
+	}
+	if err != nil {
+		return emptyValue, err
+	}
+	return dest.Elem(), nil
+}
+
+// auditRecord returns the audit record of the row before and after the write, nil if nothing changed.
+func (c *CacheableDB) auditRecord(action AuditAction, before, after reflect.Value) (*AuditRecord, error) {
+	record := &AuditRecord{Table: c.tableName, Action: action}
+	key := after
+	switch {
+	case !before.IsValid() && !after.IsValid():
+		return nil, nil
+	case !before.IsValid():
+		record.Action = AuditInsert
+	case !after.IsValid():
+		record.Action = AuditDelete
+		key = before
+	}
+	var err error
+	if before.IsValid() {
+		if record.Before, err = c.auditValues(before); err != nil {
+			return nil, err
+		}
+	}
+	if after.IsValid() {
+		if record.After, err = c.auditValues(after); err != nil {
+			return nil, err
+		}
+	}
+	record.PrimaryKey = make(map[string]interface{}, len(c.priCols))
+	for i, col := range c.priCols {
+		record.PrimaryKey[col] = key.Field(c.priFieldsIndex[i]).Interface()
+	}
+	for _, col := range c.cols {
+		if col == c.roles.UpdatedAt {
+			continue
+		}
+		i := c.fieldsIndexMap[col]
+		var change = AuditChange{Field: col}
+		switch {
+		case !before.IsValid():
+			change.After = record.After[col]
+		case !after.IsValid():
+			change.Before = record.Before[col]
+		case reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()):
+			// compared in plain, the randomized encoded values always differ
+			continue
+		default:
+			change.Before, change.After = record.Before[col], record.After[col]
+		}
+		record.Diff = append(record.Diff, change)
+	}
+	if before.IsValid() && after.IsValid() && len(record.Diff) == 0 {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// auditValues returns the column values of the row, with the fields encoded.
+func (c *CacheableDB) auditValues(structElemValue reflect.Value) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(c.cols))
+	for _, col := range c.cols {
+		value, err := c.fieldValue(structElemValue, c.fieldsIndexMap[col])
+		if err != nil {
+			return nil, err
+		}
+		values[col] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,58 @@
+package mysql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type auditTable struct {
+	Id        int64  `json:"id" key:"pri"`
+	Name      string `json:"name"`
+	Age       int32  `json:"age"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (*auditTable) TableName() string { return "audit_table" }
+
+func TestAuditRecord(t *testing.T) {
+	c := &CacheableDB{
+		tableName:      "audit_table",
+		cols:           []string{"id", "name", "age", "updated_at"},
+		priCols:        []string{"id"},
+		priFieldsIndex: []int{0},
+		structType:     reflect.TypeOf(auditTable{}),
+		fieldsIndexMap: map[string]int{"id": 0, "name": 1, "age": 2, "updated_at": 3},
+		roles:          ColumnRoles{UpdatedAt: "updated_at"},
+	}
+	before := reflect.ValueOf(auditTable{Id: 1, Name: "a", Age: 1, UpdatedAt: 1})
+	after := reflect.ValueOf(auditTable{Id: 1, Name: "b", Age: 1, UpdatedAt: 2})
+
+	r, err := c.auditRecord(AuditUpdate, before, after)
+	if err != nil || r == nil {
+		t.Fatalf("auditRecord(update) = %v, %v", r, err)
+	}
+	want := []AuditChange{{Field: "name", Before: "a", After: "b"}}
+	if r.Action != AuditUpdate || !reflect.DeepEqual(r.Diff, want) || r.PrimaryKey["id"] != int64(1) || r.Before["updated_at"] != int64(1) {
+		t.Fatalf("auditRecord(update) = %+v", r)
+	}
+
+	// only 'updated_at' changed
+	if r, err = c.auditRecord(AuditUpdate, before, reflect.ValueOf(auditTable{Id: 1, Name: "a", Age: 1, UpdatedAt: 2})); r != nil || err != nil {
+		t.Fatalf("auditRecord(no change) = %+v, %v", r, err)
+	}
+
+	if r, err = c.auditRecord(AuditUpdate, emptyValue, after); err != nil || r.Action != AuditInsert || r.Before != nil || len(r.Diff) != 3 {
+		t.Fatalf("auditRecord(upsert insert) = %+v, %v", r, err)
+	}
+	if r, err = c.auditRecord(AuditDelete, before, emptyValue); err != nil || r.Action != AuditDelete || r.After != nil || r.Diff[0].Before != int64(1) {
+		t.Fatalf("auditRecord(delete) = %+v, %v", r, err)
+	}
+	if r, err = c.auditRecord(AuditUpdate, emptyValue, emptyValue); r != nil || err != nil {
+		t.Fatalf("auditRecord(not exist) = %+v, %v", r, err)
+	}
+
+	if actor := ActorFromContext(WithActor(context.Background(), "u1")); actor != "u1" {
+		t.Fatalf("ActorFromContext() = %q", actor)
+	}
+}
@@ -0,0 +1,318 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/redis"
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+const (
+	// defaultMaxBatchRows the default max number of rows per batch statement
+	defaultMaxBatchRows = 1000
+	// defaultMaxAllowedPacket the default max_allowed_packet of mysql server
+	defaultMaxAllowedPacket = 4 << 20
+	// the estimated size of a non-string value in the statement
+	estimatedValueSize = 24
+)
+
+// BatchInsert inserts rows into database in batches, by multi-row 'INSERT ... VALUES (...),(...)'.
+// NOTE:
+//  srcStructSlice must be a []*struct or []struct of the registered type;
+//  Rows are chunked by Config.MaxBatchRows and the server's max_allowed_packet;
+//  All chunks are executed in one transaction if tx is not specified;
+//  Automatic fill 'created_at' and 'updated_at' fields;
+//  If the primary key is a single auto-increment integer which is zero in all rows,
+//  the generated IDs are returned and written back to the rows (requires consecutive
+//  auto-increment values, i.e. innodb_autoinc_lock_mode<=1 or no concurrent inserts);
+//  Deletes the primary key caches of the rows.
+func (c *CacheableDB) BatchInsert(srcStructSlice interface{}, tx ...*sqlx.Tx) ([]int64, error) {
+	return c.batchWrite(srcStructSlice, false, nil, tx...)
+}
+
+// BatchUpsert inserts or updates rows in batches, by multi-row 'INSERT ... ON DUPLICATE KEY UPDATE'.
+// NOTE:
+//  srcStructSlice must be a []*struct or []struct of the registered type;
+//  Rows are chunked by Config.MaxBatchRows and the server's max_allowed_packet;
+//  All chunks are executed in one transaction if tx is not specified;
+//  updateFields' members must be db field style (snake format);
+//  Update all fields except the primary keys and 'created_at' key, if updateFields is empty;
+//  Automatic update 'updated_at' field and reset 'deleted_ts' field to 0;
+//  The primary keys must be specified, a zero auto-increment primary key is refused,
+//  since the updated rows of the unique key conflicts cannot be known to delete their caches;
+//  Deletes the primary key caches of the rows.
+func (c *CacheableDB) BatchUpsert(srcStructSlice interface{}, updateFields []string, tx ...*sqlx.Tx) error {
+	_, err := c.batchWrite(srcStructSlice, true, updateFields, tx...)
+	return err
+}
+
+func (c *CacheableDB) batchWrite(srcStructSlice interface{}, upsert bool, updateFields []string, tx ...*sqlx.Tx) ([]int64, error) {
+	rows, err := c.structSliceElems(srcStructSlice)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	if upsert && c.hasZeroAutoIncrement(rows) {
+		return nil, errors.New("BatchUpsert(): the auto-increment primary key must be specified, use BatchInsert for the new rows")
+	}
+
+	var (
+		now     = time.Now().Unix()
+		omitPri = c.isAutoIncrement(rows)
+		autoID  = omitPri
+		cols    = make([]string, 0, len(c.cols))
+	)
+	for _, col := range c.cols {
+		if omitPri && col == c.priCols[0] {
+			continue
+		}
+		cols = append(cols, col)
+	}
+	for _, v := range rows {
+		c.stampTimestamps(v, now, true)
+	}
+
+	var suffix string
+	if upsert {
+		suffix = c.upsertSuffix(updateFields)
+	}
+	prefix := "INSERT INTO `" + c.tableName + "` (`" + strings.Join(cols, "`,`") + "`)VALUES"
+	placeholder := "(" + strings.Repeat("?,", len(cols)-1) + "?)"
+
+	var (
+		ids        []int64
+		maxRows    = c.DB.maxBatchRows()
+		maxPacket  = c.DB.maxAllowedPacket()
+		batchBytes = len(prefix) + len(suffix)
+	)
+	if autoID {
+		ids = make([]int64, 0, len(rows))
+	}
+	action := AuditInsert
+	if upsert {
+		action = AuditUpdate
+	}
+	err = c.audited(context.Background(), action, rows, "", func(tx ...*sqlx.Tx) error {
+		return c.DB.TransactCallback(func(tx *sqlx.Tx) error {
+			var (
+				start = 0
+				size  = batchBytes
+				args  = make([]interface{}, 0, len(cols)*min(len(rows), maxRows))
+			)
+			flush := func(end int) error {
+				if end == start {
+					return nil
+				}
+				query := prefix + strings.TrimSuffix(strings.Repeat(placeholder+",", end-start), ",") + suffix
+				r, err := tx.Exec(query, args...)
+				if err != nil {
+					return err
+				}
+				if autoID {
+					firstID, err := r.LastInsertId()
+					if err != nil {
+						return err
+					}
+					for i := start; i < end; i++ {
+						id := firstID + int64(i-start)
+						rows[i].Field(c.priFieldsIndex[0]).SetInt(id)
+						ids = append(ids, id)
+					}
+				}
+				start, size, args = end, batchBytes, args[:0]
+				return nil
+			}
+			for i, v := range rows {
+				rowArgs, rowSize, err := c.rowValues(v, cols)
+				if err != nil {
+					return err
+				}
+				if i > start && (i-start >= maxRows || size+rowSize+len(placeholder)+1 > maxPacket) {
+					if err := flush(i); err != nil {
+						return err
+					}
+				}
+				args = append(args, rowArgs...)
+				size += rowSize + len(placeholder) + 1
+			}
+			return flush(len(rows))
+		}, tx...)
+	}, tx...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.bloomAdd(rows)
+	if err = c.deletePriCaches(rows); err != nil {
+		xlog.Errorf("%s", err.Error())
+	}
+	return ids, nil
+}
+
+func (c *CacheableDB) structSliceElems(srcStructSlice interface{}) ([]reflect.Value, error) {
+	v := reflect.ValueOf(srcStructSlice)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("srcStructSlice must be []*struct or []struct type: %T", srcStructSlice)
+	}
+	var rows = make([]reflect.Value, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		if elem.Kind() != reflect.Ptr {
+			elem = elem.Addr()
+		}
+		if typeName := elem.Type().String(); typeName != c.typeName {
+			return nil, fmt.Errorf("unmatch Cacheable: want %s, have %s", c.typeName, typeName)
+		}
+		if elem.IsNil() {
+			return nil, errors.New("srcStructSlice contains nil element")
+		}
+		rows = append(rows, elem.Elem())
+	}
+	return rows, nil
+}
+
+// isAutoIncrement returns whether the primary key of all rows should be generated by mysql.
+func (c *CacheableDB) isAutoIncrement(rows []reflect.Value) bool {
+	if len(c.priFieldsIndex) != 1 {
+		return false
+	}
+	for _, v := range rows {
+		fv := v.Field(c.priFieldsIndex[0])
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if fv.Int() != 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// hasZeroAutoIncrement returns whether the single integer primary key of any row is zero, i.e. generated by mysql.
+func (c *CacheableDB) hasZeroAutoIncrement(rows []reflect.Value) bool {
+	if len(c.priFieldsIndex) != 1 {
+		return false
+	}
+	for _, v := range rows {
+		fv := v.Field(c.priFieldsIndex[0])
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if fv.Int() == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *CacheableDB) rowValues(structElemValue reflect.Value, cols []string) ([]interface{}, int, error) {
+	var (
+		values = make([]interface{}, len(cols))
+		size   int
+		err    error
+	)
+	for i, col := range cols {
+		if values[i], err = c.fieldValue(structElemValue, c.fieldsIndexMap[col]); err != nil {
+			return nil, 0, err
+		}
+		fv := reflect.ValueOf(values[i])
+		switch fv.Kind() {
+		case reflect.String:
+			size += fv.Len()*2 + 2
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() == reflect.Uint8 {
+				size += fv.Len()*2 + 2
+			} else {
+				size += estimatedValueSize * (fv.Len() + 1)
+			}
+		default:
+			size += estimatedValueSize
+		}
+	}
+	return values, size, nil
+}
+
+func (c *CacheableDB) upsertSuffix(updateFields []string) string {
+	var (
+		isPri = make(map[string]bool, len(c.priCols))
+		sets  []string
+	)
+	for _, col := range c.priCols {
+		isPri[col] = true
+	}
+	if len(updateFields) == 0 {
+		updateFields = c.cols
+	}
+	for _, col := range updateFields {
+		if isPri[col] || col == c.roles.CreatedAt || col == c.roles.UpdatedAt || col == c.roles.DeletedTs {
+			continue
+		}
+		if _, ok := c.fieldsIndexMap[col]; !ok {
+			continue
+		}
+		sets = append(sets, "`"+col+"`=VALUES(`"+col+"`)")
+	}
+	if c.roles.UpdatedAt != "" {
+		sets = append(sets, "`"+c.roles.UpdatedAt+"`=VALUES(`"+c.roles.UpdatedAt+"`)")
+	}
+	if c.roles.DeletedTs != "" {
+		sets = append(sets, "`"+c.roles.DeletedTs+"`=0")
+	}
+	if len(sets) == 0 {
+		// keep the row unchanged
+		sets = append(sets, "`"+c.priCols[0]+"`=`"+c.priCols[0]+"`")
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+}
+
+// deletePriCaches deletes the primary key caches of rows in one pipeline.
+func (c *CacheableDB) deletePriCaches(rows []reflect.Value) error {
+	if c.DB.dbConfig.NoCache || len(rows) == 0 {
+		return nil
+	}
+	var keys = make([]string, 0, len(rows))
+	for _, v := range rows {
+		key, err := c.createPrikey(v)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	_, err := c.Cache.Pipelined(func(p redis.Pipeliner) error {
+		for _, key := range keys {
+			p.Del(key)
+		}
+		return nil
+	})
+	return err
+}
+
+func (d *DB) maxBatchRows() int {
+	if d.dbConfig.MaxBatchRows > 0 {
+		return d.dbConfig.MaxBatchRows
+	}
+	return defaultMaxBatchRows
+}
+
+// maxAllowedPacket returns the max_allowed_packet of mysql server, queried only once.
+func (d *DB) maxAllowedPacket() int {
+	d.packetOnce.Do(func() {
+		var n int64
+		if err := d.DB.Get(&n, "SELECT @@max_allowed_packet;"); err != nil || n <= 0 {
+			if err != nil {
+				xlog.Errorf("maxAllowedPacket(): %s", err.Error())
+			}
+			n = defaultMaxAllowedPacket
+		}
+		// reserve space for the packet header
+		d.packetSize = int(n) - 1024
+	})
+	return d.packetSize
+}
@@ -0,0 +1,43 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xmodel/redis"
+	"github.com/swxctx/xmodel/sqlx"
+	"github.com/swxctx/xmodel/sqlx/reflectx"
+)
+
+type batchUser struct {
+	Id    int64  `json:"id" key:"pri"`
+	Email string `json:"email" key:"uni"`
+}
+
+func (*batchUser) TableName() string { return "batch_user" }
+
+func TestBatchUpsertZeroAutoIncrement(t *testing.T) {
+	d := &DB{
+		DB:           &sqlx.DB{Mapper: reflectx.NewMapperFunc("json", gutil.SnakeString)},
+		dbConfig:     &Config{Database: "shop"},
+		Cache:        &redis.Client{},
+		cacheableDBs: make(map[string]*CacheableDB),
+	}
+	c, err := d.RegCacheableDB(&batchUser{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// refused before touching the database
+	for _, rows := range [][]*batchUser{
+		{{Email: "a@b.c"}, {Email: "b@b.c"}},
+		{{Id: 1, Email: "a@b.c"}, {Email: "b@b.c"}},
+	} {
+		if err = c.BatchUpsert(rows, nil); err == nil {
+			t.Fatalf("BatchUpsert() of zero auto-increment primary keys returns nil error: %+v", rows)
+		}
+	}
+	if err = c.BatchUpsert([]*batchUser{}, nil); err != nil {
+		t.Fatalf("BatchUpsert() of no rows = %v", err)
+	}
+}
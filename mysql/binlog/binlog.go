@@ -0,0 +1,366 @@
+// Package binlog decodes the MySQL row-based binary log (v4), and reads it from the binlog files.
+// It does not speak the replication protocol: FileSource only reads the files on the local disk,
+// so a remote server or a replica is followed by syncing its binlog into a local directory with
+// 'mysqlbinlog --read-from-remote-server --raw --stop-never', or by a Source implemented over
+// the replication protocol.
+package binlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// EventType the type of the binlog event.
+type EventType byte
+
+// the binlog event types
+const (
+	UnknownEvent           EventType = 0
+	QueryEvent             EventType = 2
+	StopEvent              EventType = 3
+	RotateEvent            EventType = 4
+	FormatDescriptionEvent EventType = 15
+	XIDEvent               EventType = 16
+	TableMapEvent          EventType = 19
+	WriteRowsEventV1       EventType = 23
+	UpdateRowsEventV1      EventType = 24
+	DeleteRowsEventV1      EventType = 25
+	HeartbeatEvent         EventType = 27
+	WriteRowsEventV2       EventType = 30
+	UpdateRowsEventV2      EventType = 31
+	DeleteRowsEventV2      EventType = 32
+	GTIDEvent              EventType = 33
+	PreviousGTIDsEvent     EventType = 35
+	PartialUpdateRowsEvent EventType = 39
+)
+
+// the checksum algorithms
+const (
+	checksumOff   = 0
+	checksumCRC32 = 1
+)
+
+const (
+	// HeaderSize the size of the v4 event header
+	HeaderSize = 19
+	// checksumSize the size of the CRC32 checksum
+	checksumSize = 4
+)
+
+// ErrChecksum error: the checksum of the event mismatches
+var ErrChecksum = errors.New("binlog: event checksum mismatch")
+
+// EventHeader the header of the binlog event.
+type EventHeader struct {
+	Timestamp uint32
+	Type      EventType
+	ServerID  uint32
+	EventSize uint32
+	LogPos    uint32 // the position of the next event
+	Flags     uint16
+}
+
+// Event a decoded binlog event.
+type Event struct {
+	Header EventHeader
+	// One of *FormatDescription, *Rotate, *Query, *XID, *TableMap and *Rows,
+	// nil for the other event types.
+	Data interface{}
+}
+
+// FormatDescription the FORMAT_DESCRIPTION_EVENT at the beginning of each binlog file.
+type FormatDescription struct {
+	BinlogVersion     uint16
+	ServerVersion     string
+	HeaderLength      byte
+	PostHeaderLengths []byte // index: event type - 1
+	ChecksumAlgorithm byte
+}
+
+// postHeaderLength returns the post header length of the event type, or def if unknown.
+func (f *FormatDescription) postHeaderLength(t EventType, def int) int {
+	if f == nil || int(t) < 1 || int(t) > len(f.PostHeaderLengths) {
+		return def
+	}
+	return int(f.PostHeaderLengths[t-1])
+}
+
+// Rotate the ROTATE_EVENT, the following events are in the NextFile.
+type Rotate struct {
+	Position uint64
+	NextFile string
+}
+
+// Query the QUERY_EVENT, e.g. 'BEGIN' and DDL statements.
+type Query struct {
+	Schema string
+	Query  string
+}
+
+// XID the XID_EVENT, which commits a transaction.
+type XID struct {
+	XID uint64
+}
+
+// Parser decodes the binlog events of a stream in order.
+// NOTE:
+//  The FORMAT_DESCRIPTION_EVENT and TABLE_MAP_EVENT are kept to decode the following events;
+//  It is not safe for concurrent use.
+type Parser struct {
+	format *FormatDescription
+	tables map[uint64]*TableMap
+}
+
+// NewParser creates a binlog event parser.
+func NewParser() *Parser {
+	return &Parser{tables: make(map[uint64]*TableMap)}
+}
+
+// Reset drops the kept table maps, e.g. when switching to another stream.
+func (p *Parser) Reset() {
+	p.format = nil
+	p.tables = make(map[uint64]*TableMap)
+}
+
+// ParseHeader decodes the event header.
+func ParseHeader(data []byte) (EventHeader, error) {
+	if len(data) < HeaderSize {
+		return EventHeader{}, fmt.Errorf("binlog: event header too short: %d", len(data))
+	}
+	h := EventHeader{
+		Timestamp: binary.LittleEndian.Uint32(data),
+		Type:      EventType(data[4]),
+		ServerID:  binary.LittleEndian.Uint32(data[5:]),
+		EventSize: binary.LittleEndian.Uint32(data[9:]),
+		LogPos:    binary.LittleEndian.Uint32(data[13:]),
+		Flags:     binary.LittleEndian.Uint16(data[17:]),
+	}
+	if h.EventSize < HeaderSize {
+		return h, fmt.Errorf("binlog: invalid event size: %d", h.EventSize)
+	}
+	return h, nil
+}
+
+// Parse decodes the whole event data, including the header and the checksum.
+func (p *Parser) Parse(data []byte) (*Event, error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if int(h.EventSize) != len(data) {
+		return nil, fmt.Errorf("binlog: event size %d, have %d bytes", h.EventSize, len(data))
+	}
+	e := &Event{Header: h}
+	if h.Type == FormatDescriptionEvent {
+		f, err := parseFormatDescription(data)
+		if err != nil {
+			return nil, err
+		}
+		p.format = f
+		p.tables = make(map[uint64]*TableMap)
+		e.Data = f
+		return e, nil
+	}
+
+	body := data[HeaderSize:]
+	if p.format != nil && p.format.ChecksumAlgorithm == checksumCRC32 {
+		if len(body) < checksumSize {
+			return nil, ErrChecksum
+		}
+		n := len(data) - checksumSize
+		if crc32.ChecksumIEEE(data[:n]) != binary.LittleEndian.Uint32(data[n:]) {
+			return nil, ErrChecksum
+		}
+		body = body[:len(body)-checksumSize]
+	}
+
+	switch h.Type {
+	case RotateEvent:
+		if len(body) < 8 {
+			return nil, errShort(h.Type)
+		}
+		e.Data = &Rotate{
+			Position: binary.LittleEndian.Uint64(body),
+			NextFile: string(body[8:]),
+		}
+	case QueryEvent:
+		e.Data, err = p.parseQuery(body)
+	case XIDEvent:
+		if len(body) < 8 {
+			return nil, errShort(h.Type)
+		}
+		e.Data = &XID{XID: binary.LittleEndian.Uint64(body)}
+	case TableMapEvent:
+		var t *TableMap
+		if t, err = p.parseTableMap(body); err == nil {
+			p.tables[t.TableID] = t
+			e.Data = t
+		}
+	case WriteRowsEventV1, UpdateRowsEventV1, DeleteRowsEventV1,
+		WriteRowsEventV2, UpdateRowsEventV2, DeleteRowsEventV2:
+		e.Data, err = p.parseRows(h.Type, body)
+	case PartialUpdateRowsEvent:
+		err = errors.New("binlog: PARTIAL_UPDATE_ROWS_EVENT is not supported, set binlog_row_value_options=''")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func errShort(t EventType) error {
+	return fmt.Errorf("binlog: event %d too short", t)
+}
+
+func parseFormatDescription(data []byte) (*FormatDescription, error) {
+	body := data[HeaderSize:]
+	// binlog version (2), server version (50), create timestamp (4), header length (1)
+	if len(body) < 57 {
+		return nil, errShort(FormatDescriptionEvent)
+	}
+	f := &FormatDescription{
+		BinlogVersion: binary.LittleEndian.Uint16(body),
+		ServerVersion: strings.TrimRight(string(body[2:52]), "\x00"),
+		HeaderLength:  body[56],
+	}
+	if f.BinlogVersion != 4 {
+		return nil, fmt.Errorf("binlog: unsupported binlog version %d", f.BinlogVersion)
+	}
+	lengths := body[57:]
+	if versionAtLeast(f.ServerVersion, 5, 6, 1) {
+		// checksum algorithm (1) and checksum (4)
+		if len(lengths) < 1+checksumSize {
+			return nil, errShort(FormatDescriptionEvent)
+		}
+		f.ChecksumAlgorithm = lengths[len(lengths)-1-checksumSize]
+		lengths = lengths[:len(lengths)-1-checksumSize]
+		if f.ChecksumAlgorithm == checksumCRC32 {
+			n := len(data) - checksumSize
+			if crc32.ChecksumIEEE(data[:n]) != binary.LittleEndian.Uint32(data[n:]) {
+				return nil, ErrChecksum
+			}
+		} else if f.ChecksumAlgorithm != checksumOff {
+			return nil, fmt.Errorf("binlog: unsupported checksum algorithm %d", f.ChecksumAlgorithm)
+		}
+	}
+	f.PostHeaderLengths = append([]byte(nil), lengths...)
+	return f, nil
+}
+
+// versionAtLeast returns whether the server version like '8.0.36-log' is at least major.minor.patch.
+func versionAtLeast(version string, major, minor, patch int) bool {
+	if i := strings.IndexFunc(version, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); i != -1 {
+		version = version[:i]
+	}
+	want := []int{major, minor, patch}
+	parts := strings.SplitN(version, ".", 3)
+	for i, w := range want {
+		if i >= len(parts) {
+			return false
+		}
+		n, _ := strconv.Atoi(parts[i])
+		if n != w {
+			return n > w
+		}
+	}
+	return true
+}
+
+func (p *Parser) parseQuery(body []byte) (*Query, error) {
+	n := p.format.postHeaderLength(QueryEvent, 13)
+	if len(body) < n || n < 13 {
+		return nil, errShort(QueryEvent)
+	}
+	schemaLen := int(body[8])
+	statusLen := int(binary.LittleEndian.Uint16(body[11:]))
+	rest := body[n:]
+	if len(rest) < statusLen+schemaLen+1 {
+		return nil, errShort(QueryEvent)
+	}
+	rest = rest[statusLen:]
+	return &Query{
+		Schema: string(rest[:schemaLen]),
+		Query:  string(rest[schemaLen+1:]),
+	}, nil
+}
+
+// tableID decodes the table id of the TABLE_MAP_EVENT and ROWS_EVENT, whose size is 4 if the
+// post header length is 6, otherwise 6.
+func tableID(body []byte, postHeaderLength int) (uint64, int) {
+	if postHeaderLength == 6 {
+		return uint64(binary.LittleEndian.Uint32(body)), 4
+	}
+	return uint64(binary.LittleEndian.Uint32(body)) | uint64(binary.LittleEndian.Uint16(body[4:]))<<32, 6
+}
+
+// reader reads the event body.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errors.New("binlog: unexpected end of event")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uintN(n int) uint64 {
+	b := r.bytes(n)
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+// lenEncInt reads the length-encoded integer.
+func (r *reader) lenEncInt() uint64 {
+	switch b := r.byte(); {
+	case b < 0xfb:
+		return uint64(b)
+	case b == 0xfc:
+		return r.uintN(2)
+	case b == 0xfd:
+		return r.uintN(3)
+	case b == 0xfe:
+		return r.uintN(8)
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("binlog: invalid length-encoded integer 0x%x", b)
+		}
+		return 0
+	}
+}
+
+// bitmap reads the bitmap of n bits, LSB first.
+func (r *reader) bitmap(n int) []bool {
+	b := r.bytes((n + 7) / 8)
+	if b == nil {
+		return nil
+	}
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = b[i/8]&(1<<(i%8)) != 0
+	}
+	return bits
+}
@@ -0,0 +1,88 @@
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Position the position in the binlog files.
+type Position struct {
+	File string `json:"file"`
+	Pos  uint32 `json:"pos"`
+}
+
+// IsZero returns whether the position is not set.
+func (p Position) IsZero() bool {
+	return p.File == ""
+}
+
+// String returns 'file:pos'.
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Pos)
+}
+
+// PositionStore persists the binlog position.
+type PositionStore interface {
+	// Load returns the saved position, zero if it is not saved.
+	Load() (Position, error)
+	// Save saves the position.
+	Save(pos Position) error
+}
+
+// FilePositionStore persists the position as JSON in a local file.
+type FilePositionStore struct {
+	path string
+}
+
+var _ PositionStore = (*FilePositionStore)(nil)
+
+// NewFilePositionStore creates a PositionStore of the file path.
+func NewFilePositionStore(path string) *FilePositionStore {
+	return &FilePositionStore{path: path}
+}
+
+// Load implements the PositionStore interface.
+func (s *FilePositionStore) Load() (Position, error) {
+	var pos Position
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return pos, nil
+	}
+	if err != nil {
+		return pos, err
+	}
+	if err = json.Unmarshal(data, &pos); err != nil {
+		return pos, fmt.Errorf("binlog: position file %s: %s", s.path, err.Error())
+	}
+	return pos, nil
+}
+
+// Save implements the PositionStore interface.
+// NOTE:
+//  The file is replaced atomically by renaming a temporary file.
+func (s *FilePositionStore) Save(pos Position) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,281 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// the column types of the TABLE_MAP_EVENT
+const (
+	TypeDecimal    byte = 0
+	TypeTiny       byte = 1
+	TypeShort      byte = 2
+	TypeLong       byte = 3
+	TypeFloat      byte = 4
+	TypeDouble     byte = 5
+	TypeNull       byte = 6
+	TypeTimestamp  byte = 7
+	TypeLongLong   byte = 8
+	TypeInt24      byte = 9
+	TypeDate       byte = 10
+	TypeTime       byte = 11
+	TypeDateTime   byte = 12
+	TypeYear       byte = 13
+	TypeNewDate    byte = 14
+	TypeVarchar    byte = 15
+	TypeBit        byte = 16
+	TypeTimestamp2 byte = 17
+	TypeDateTime2  byte = 18
+	TypeTime2      byte = 19
+	TypeJSON       byte = 245
+	TypeNewDecimal byte = 246
+	TypeEnum       byte = 247
+	TypeSet        byte = 248
+	TypeTinyBlob   byte = 249
+	TypeMediumBlob byte = 250
+	TypeLongBlob   byte = 251
+	TypeBlob       byte = 252
+	TypeVarString  byte = 253
+	TypeString     byte = 254
+	TypeGeometry   byte = 255
+)
+
+// the optional metadata types of the TABLE_MAP_EVENT
+const (
+	metaSignedness       = 1
+	metaColumnName       = 4
+	metaSimplePrimaryKey = 8
+	metaPrimaryKeyPrefix = 9
+)
+
+// TableMap the TABLE_MAP_EVENT, which describes the table of the following rows events.
+type TableMap struct {
+	TableID     uint64
+	Schema      string
+	Table       string
+	ColumnTypes []byte
+	ColumnMeta  []uint16
+	Nullable    []bool
+	// the optional metadata, see binlog_row_metadata
+	Unsigned    []bool   // nil if unknown (MySQL < 8.0.1)
+	ColumnNames []string // nil unless binlog_row_metadata=FULL
+	PrimaryKey  []int    // the column indexes, nil unless binlog_row_metadata=FULL
+}
+
+// RowsKind the kind of the rows event.
+type RowsKind byte
+
+// the kinds of the rows events
+const (
+	RowsInsert RowsKind = iota + 1
+	RowsUpdate
+	RowsDelete
+)
+
+// Rows the WRITE_ROWS_EVENT, UPDATE_ROWS_EVENT or DELETE_ROWS_EVENT.
+// NOTE:
+//  For RowsUpdate, Rows are the pairs of the before image and the after image;
+//  The values of the columns not present in the image (see binlog_row_image) are nil.
+type Rows struct {
+	Kind  RowsKind
+	Table *TableMap
+	// the columns present in the images, and the after images of RowsUpdate
+	Present      []bool
+	PresentAfter []bool
+	Rows         [][]interface{}
+}
+
+// IsPresent returns whether the column is present in the i-th image of Rows.
+func (r *Rows) IsPresent(i, column int) bool {
+	if r.Kind == RowsUpdate && i%2 == 1 {
+		return r.PresentAfter[column]
+	}
+	return r.Present[column]
+}
+
+func (p *Parser) parseTableMap(body []byte) (*TableMap, error) {
+	n := p.format.postHeaderLength(TableMapEvent, 8)
+	if len(body) < n || n < 6 {
+		return nil, errShort(TableMapEvent)
+	}
+	var (
+		id, _ = tableID(body, n)
+		r     = &reader{data: body[n:]}
+		t     = &TableMap{TableID: id}
+	)
+	t.Schema = string(r.bytes(int(r.byte())))
+	r.byte()
+	t.Table = string(r.bytes(int(r.byte())))
+	r.byte()
+	count := int(r.lenEncInt())
+	t.ColumnTypes = append([]byte(nil), r.bytes(count)...)
+	meta := &reader{data: r.bytes(int(r.lenEncInt()))}
+	t.Nullable = r.bitmap(count)
+	if r.err != nil {
+		return nil, r.err
+	}
+	t.ColumnMeta = make([]uint16, count)
+	for i, typ := range t.ColumnTypes {
+		switch typ {
+		case TypeFloat, TypeDouble, TypeBlob, TypeGeometry, TypeJSON,
+			TypeTimestamp2, TypeDateTime2, TypeTime2:
+			t.ColumnMeta[i] = uint16(meta.byte())
+		case TypeVarchar, TypeVarString, TypeBit:
+			t.ColumnMeta[i] = uint16(meta.uintN(2))
+		case TypeNewDecimal, TypeString, TypeEnum, TypeSet:
+			// big endian: the precision and scale, or the real type and length
+			b := meta.bytes(2)
+			if b != nil {
+				t.ColumnMeta[i] = uint16(b[0])<<8 | uint16(b[1])
+			}
+		}
+	}
+	if meta.err != nil {
+		return nil, meta.err
+	}
+	if err := t.parseOptionalMeta(r); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseOptionalMeta parses the optional metadata fields of the TABLE_MAP_EVENT.
+func (t *TableMap) parseOptionalMeta(r *reader) error {
+	for len(r.data) > 0 && r.err == nil {
+		typ := r.byte()
+		field := &reader{data: r.bytes(int(r.lenEncInt()))}
+		if r.err != nil {
+			break
+		}
+		switch typ {
+		case metaSignedness:
+			// a bit per numeric column, MSB first
+			bits := field.bytes(len(field.data))
+			t.Unsigned = make([]bool, len(t.ColumnTypes))
+			var j int
+			for i, colType := range t.ColumnTypes {
+				if !isNumeric(colType) {
+					continue
+				}
+				if j/8 < len(bits) {
+					t.Unsigned[i] = bits[j/8]&(0x80>>(j%8)) != 0
+				}
+				j++
+			}
+		case metaColumnName:
+			t.ColumnNames = make([]string, 0, len(t.ColumnTypes))
+			for len(field.data) > 0 && field.err == nil {
+				t.ColumnNames = append(t.ColumnNames, string(field.bytes(int(field.lenEncInt()))))
+			}
+		case metaSimplePrimaryKey:
+			for len(field.data) > 0 && field.err == nil {
+				t.PrimaryKey = append(t.PrimaryKey, int(field.lenEncInt()))
+			}
+		case metaPrimaryKeyPrefix:
+			for len(field.data) > 0 && field.err == nil {
+				t.PrimaryKey = append(t.PrimaryKey, int(field.lenEncInt()))
+				field.lenEncInt() // prefix length
+			}
+		}
+		if field.err != nil {
+			return field.err
+		}
+	}
+	return r.err
+}
+
+func isNumeric(colType byte) bool {
+	switch colType {
+	case TypeTiny, TypeShort, TypeInt24, TypeLong, TypeLongLong,
+		TypeFloat, TypeDouble, TypeDecimal, TypeNewDecimal:
+		return true
+	}
+	return false
+}
+
+func (p *Parser) parseRows(typ EventType, body []byte) (*Rows, error) {
+	var (
+		def = 8
+		ev  = &Rows{}
+	)
+	switch typ {
+	case WriteRowsEventV1, WriteRowsEventV2:
+		ev.Kind = RowsInsert
+	case UpdateRowsEventV1, UpdateRowsEventV2:
+		ev.Kind = RowsUpdate
+	default:
+		ev.Kind = RowsDelete
+	}
+	if typ >= WriteRowsEventV2 {
+		def = 10
+	}
+	n := p.format.postHeaderLength(typ, def)
+	if len(body) < n || n < 6 {
+		return nil, errShort(typ)
+	}
+	id, _ := tableID(body, n)
+	t, ok := p.tables[id]
+	if !ok {
+		return nil, fmt.Errorf("binlog: rows event of unknown table id %d", id)
+	}
+	ev.Table = t
+	r := &reader{data: body[n:]}
+	if n == 10 {
+		// the extra data, whose length in the post header includes the 2 bytes of itself
+		r.bytes(int(binary.LittleEndian.Uint16(body[8:])) - 2)
+	}
+	count := int(r.lenEncInt())
+	if count != len(t.ColumnTypes) {
+		return nil, fmt.Errorf("binlog: rows event of %s.%s has %d columns, table map has %d", t.Schema, t.Table, count, len(t.ColumnTypes))
+	}
+	ev.Present = r.bitmap(count)
+	if ev.Kind == RowsUpdate {
+		ev.PresentAfter = r.bitmap(count)
+	}
+	for len(r.data) > 0 && r.err == nil {
+		row, err := t.readRow(r, ev.Present)
+		if err != nil {
+			return nil, err
+		}
+		ev.Rows = append(ev.Rows, row)
+		if ev.Kind == RowsUpdate {
+			if row, err = t.readRow(r, ev.PresentAfter); err != nil {
+				return nil, err
+			}
+			ev.Rows = append(ev.Rows, row)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return ev, nil
+}
+
+// readRow reads a row image of the present columns.
+func (t *TableMap) readRow(r *reader, present []bool) ([]interface{}, error) {
+	var presentCount int
+	for _, ok := range present {
+		if ok {
+			presentCount++
+		}
+	}
+	nulls := r.bitmap(presentCount)
+	row := make([]interface{}, len(t.ColumnTypes))
+	var j int
+	for i, ok := range present {
+		if !ok {
+			continue
+		}
+		isNull := nulls != nil && nulls[j]
+		j++
+		if isNull {
+			continue
+		}
+		v, err := t.readValue(r, i)
+		if err != nil {
+			return nil, fmt.Errorf("binlog: column %d of %s.%s: %s", i, t.Schema, t.Table, err.Error())
+		}
+		row[i] = v
+	}
+	return row, r.err
+}
@@ -0,0 +1,240 @@
+package binlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Source reads the binlog events in order.
+type Source interface {
+	// Seek starts reading at pos, which must be a position returned by Position,
+	// or the beginning of the first binlog if pos is zero.
+	Seek(pos Position) error
+	// Next reads the next event, blocks until it is available or ctx is done.
+	Next(ctx context.Context) (*Event, error)
+	// Position returns the position after the last read event.
+	Position() Position
+	// Close closes the source.
+	Close() error
+}
+
+// ErrClosed error: the source is closed
+var ErrClosed = errors.New("binlog: source is closed")
+
+// the magic number at the beginning of the binlog files
+var fileMagic = []byte{0xfe, 'b', 'i', 'n'}
+
+// defaultPollInterval the default interval of polling the growing binlog file
+const defaultPollInterval = 200 * time.Millisecond
+
+// FileSource reads the binlog files in a directory, and follows them as they grow.
+// NOTE:
+//  The directory may be the server's binlog directory, or the backup synced by
+//  'mysqlbinlog --read-from-remote-server --raw --stop-never';
+//  It cannot connect to a server or a replica stream itself, see the package doc;
+//  Switches to the next file at the ROTATE_EVENT or STOP_EVENT.
+type FileSource struct {
+	dir string
+	// PollInterval the interval of polling the growing binlog file, default is 200ms.
+	PollInterval time.Duration
+
+	parser *Parser
+	file   *os.File
+	name   string
+	offset int64
+	next   string // the next file to read at the end of the current file
+	stop   bool   // the next file is the one after name in the directory
+	closed bool
+}
+
+var _ Source = (*FileSource)(nil)
+
+// NewFileSource creates a Source of the binlog files in dir.
+func NewFileSource(dir string) *FileSource {
+	return &FileSource{
+		dir:          dir,
+		PollInterval: defaultPollInterval,
+		parser:       NewParser(),
+	}
+}
+
+// Seek implements the Source interface.
+func (s *FileSource) Seek(pos Position) error {
+	name := pos.File
+	if name == "" {
+		files, err := s.files()
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("binlog: no binlog file in %s", s.dir)
+		}
+		name = files[0]
+	}
+	if err := s.open(name); err != nil {
+		return err
+	}
+	if int64(pos.Pos) <= s.offset {
+		return nil
+	}
+	// the format description is required to decode the following events
+	e, err := s.read()
+	if err != nil {
+		return err
+	}
+	if e == nil || e.Header.Type != FormatDescriptionEvent {
+		return fmt.Errorf("binlog: %s does not begin with the format description event", name)
+	}
+	s.offset = int64(pos.Pos)
+	return nil
+}
+
+// open opens the binlog file, and positions after the magic number.
+func (s *FileSource) open(name string) error {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return err
+	}
+	magic := make([]byte, len(fileMagic))
+	if _, err = io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, fileMagic) {
+		f.Close()
+		return fmt.Errorf("binlog: %s is not a binlog file", name)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, s.name, s.offset = f, name, int64(len(fileMagic))
+	s.next, s.stop = "", false
+	s.parser.Reset()
+	return nil
+}
+
+// files returns the binlog file names in the directory, e.g. 'binlog.000001', in order.
+func (s *FileSource) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || len(ext) < 2 || strings.Trim(ext[1:], "0123456789") != "" {
+			continue
+		}
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Next implements the Source interface.
+func (s *FileSource) Next(ctx context.Context) (*Event, error) {
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if s.file == nil {
+		if err := s.Seek(Position{}); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		e, err := s.read()
+		if err != nil || e != nil {
+			return e, err
+		}
+		// the end of the file
+		if next, err := s.nextFile(); err != nil {
+			return nil, err
+		} else if next != "" {
+			if _, err = os.Stat(filepath.Join(s.dir, next)); err == nil {
+				if err = s.open(next); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+// nextFile returns the file to read after the current one, empty if the current one is not finished.
+func (s *FileSource) nextFile() (string, error) {
+	if s.next != "" || !s.stop {
+		return s.next, nil
+	}
+	files, err := s.files()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range files {
+		if name > s.name {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// read reads the event at the offset, returns nil if the event is not completely written.
+func (s *FileSource) read() (*Event, error) {
+	header := make([]byte, HeaderSize)
+	if n, err := s.file.ReadAt(header, s.offset); n < HeaderSize {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	h, err := ParseHeader(header)
+	if err != nil {
+		return nil, fmt.Errorf("%s at %s", err.Error(), s.Position())
+	}
+	data := make([]byte, h.EventSize)
+	if n, err := s.file.ReadAt(data, s.offset); n < len(data) {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	e, err := s.parser.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s at %s", err.Error(), s.Position())
+	}
+	s.offset += int64(h.EventSize)
+	switch d := e.Data.(type) {
+	case *Rotate:
+		s.next = d.NextFile
+	default:
+		if h.Type == StopEvent {
+			s.stop = true
+		}
+	}
+	return e, nil
+}
+
+// Position implements the Source interface.
+func (s *FileSource) Position() Position {
+	return Position{File: s.name, Pos: uint32(s.offset)}
+}
+
+// Close implements the Source interface.
+func (s *FileSource) Close() error {
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
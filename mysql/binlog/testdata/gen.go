@@ -0,0 +1,329 @@
+//go:build ignore
+
+// gen writes the binlog files of the tests, run 'go generate' in the binlog package.
+//
+// The events are encoded by hand after the MySQL 8.0 binlog format (binlog_format=ROW,
+// binlog_checksum=CRC32, binlog_row_metadata=FULL for the 'user' table and MINIMAL for 'order_item'),
+// see https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_replication_binlog_event.html,
+// so that they cover the column types and the corner cases (NULLs, negative values, partial images)
+// deterministically, which a recorded binlog does not.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// the timestamp of all the events
+const ts = 1715000000
+
+// the event types
+const (
+	queryEvent             = 2
+	rotateEvent            = 4
+	formatDescriptionEvent = 15
+	xidEvent               = 16
+	tableMapEvent          = 19
+	writeRowsEvent         = 30
+	updateRowsEvent        = 31
+	deleteRowsEvent        = 32
+	gtidEvent              = 33
+	previousGTIDsEvent     = 35
+)
+
+func main() {
+	writeFile1()
+	writeFile2()
+}
+
+// user table: id BIGINT UNSIGNED, name VARCHAR(64), balance DECIMAL(10,2) NULL, created_at DATETIME(3),
+// profile BLOB NULL, age TINYINT UNSIGNED, score DOUBLE, updated TIMESTAMP, code CHAR(4),
+// birthday DATE NULL, dur TIME(2) NULL, flags BIT(10) NULL, status ENUM(...)
+var (
+	userTypes    = []byte{8, 15, 246, 18, 245, 1, 5, 17, 254, 10, 19, 16, 254}
+	userNames    = []string{"id", "name", "balance", "created_at", "profile", "age", "score", "updated", "code", "birthday", "dur", "flags", "status"}
+	userNullable = []bool{false, false, true, false, true, false, false, false, false, true, true, true, false}
+	userMeta     = concat(nil, u16(256), []byte{10, 2}, []byte{3}, []byte{4}, nil, []byte{8}, []byte{0},
+		[]byte{0xfe, 16}, nil, []byte{2}, []byte{2, 1}, []byte{0xf7, 1})
+	// SIGNEDNESS (the 1st column is unsigned), COLUMN_NAME and SIMPLE_PRIMARY_KEY (empty)
+	userOpt  = concat(optField(1, []byte{0xa0}), optField(4, names(userNames)), optField(8, lenEnc(0)))
+	allUser  = repeat(true, 13)
+	noneUser = repeat(false, 13)
+)
+
+func writeFile1() {
+	w := newWriter("binlog.000001")
+	w.formatDescription()
+	w.previousGTIDs()
+
+	w.gtid()
+	w.query("shop", "BEGIN")
+	w.userTableMap()
+	w.rows(writeRowsEvent, 100, 13, allUser, nil, userRow(1, "alice", true), userRow(2, "bob", false, 2, 4, 9, 10, 11))
+	w.xid(11)
+
+	w.gtid()
+	w.query("shop", "BEGIN")
+	w.userTableMap()
+	w.rows(updateRowsEvent, 100, 13, allUser, allUser,
+		userRow(1, "alice", true), userRow(1, "alice2", true), userRow(2, "bob", false), userRow(3, "bob", false))
+	w.xid(12)
+
+	w.gtid()
+	w.query("shop", "ALTER TABLE `log` ADD COLUMN `note` varchar(16)")
+	w.rotate("binlog.000002")
+	w.save()
+}
+
+func writeFile2() {
+	w := newWriter("binlog.000002")
+	w.formatDescription()
+	w.previousGTIDs()
+
+	w.gtid()
+	w.query("shop", "BEGIN")
+	// order_item: order_id INT, item VARCHAR(32), qty SMALLINT, without the column names
+	w.tableMap(101, "shop", "order_item", []byte{3, 15, 2}, u16(128), []bool{false, false, false}, optField(1, []byte{0}))
+	var (
+		before = concat(nullBitmap(2), u32(7), varString("apple", 1))
+		after  = concat(nullBitmap(1), u16(uint16(0xffff-2)))
+	)
+	w.rows(updateRowsEvent, 101, 3, []bool{true, true, false}, []bool{false, false, true}, before, after)
+	w.userTableMap()
+	w.rows(deleteRowsEvent, 100, 13, allUser, nil, userRow(3, "bob", false))
+	// the table of the other schema, and the unregistered table
+	w.tableMap(102, "other", "user", userTypes, userMeta, noneUser, userOpt)
+	w.rows(writeRowsEvent, 102, 13, allUser, nil, userRow(9, "eve", false))
+	w.tableMap(103, "shop", "log", []byte{8}, nil, []bool{false}, nil)
+	w.rows(writeRowsEvent, 103, 1, []bool{true}, nil, concat(nullBitmap(1), u64(5)))
+	w.xid(13)
+	w.save()
+}
+
+// userRow returns the row image of the user table, the columns of nulls are NULL.
+func userRow(id uint64, name string, negative bool, nulls ...int) []byte {
+	values := [][]byte{
+		u64(id),
+		varString(name, 2),
+		decimal10x2(negative, 1234, 50),
+		datetime2x3(2024, 5, 6, 7, 8, 9, 123000),
+		concat(u32(2), []byte{4, 1}),
+		{200},
+		u64(math.Float64bits(1.5)),
+		be(ts, 4),
+		varString("AB12", 1),
+		u32(1990<<9 | 12<<5 | 31)[:3],
+		time2x2(true, 1, 2, 3, 450000),
+		be(0x2ff, 2),
+		{2},
+	}
+	isNull := make([]bool, len(values))
+	for _, i := range nulls {
+		isNull[i] = true
+	}
+	row := bitmap(isNull)
+	for i, v := range values {
+		if !isNull[i] {
+			row = append(row, v...)
+		}
+	}
+	return row
+}
+
+type writer struct {
+	name string
+	buf  bytes.Buffer
+}
+
+func newWriter(name string) *writer {
+	w := &writer{name: name}
+	w.buf.WriteString("\xfebin")
+	return w
+}
+
+// event writes the event with the v4 header and the CRC32 checksum.
+func (w *writer) event(typ byte, body []byte) {
+	size := 19 + len(body) + 4
+	header := concat(u32(ts), []byte{typ}, u32(1), u32(uint32(size)), u32(uint32(w.buf.Len()+size)), u16(0))
+	data := concat(header, body)
+	w.buf.Write(data)
+	w.buf.Write(u32(crc32.ChecksumIEEE(data)))
+}
+
+func (w *writer) formatDescription() {
+	postHeaderLengths := make([]byte, 41)
+	for typ, n := range map[int]byte{
+		queryEvent: 13, rotateEvent: 8, formatDescriptionEvent: 98, xidEvent: 0, tableMapEvent: 8,
+		23: 8, 24: 8, 25: 8, writeRowsEvent: 10, updateRowsEvent: 10, deleteRowsEvent: 10,
+		gtidEvent: 42, previousGTIDsEvent: 0,
+	} {
+		postHeaderLengths[typ-1] = n
+	}
+	version := make([]byte, 50)
+	copy(version, "8.0.36")
+	// the checksum algorithm is CRC32
+	w.event(formatDescriptionEvent, concat(u16(4), version, u32(0), []byte{19}, postHeaderLengths, []byte{1}))
+}
+
+func (w *writer) previousGTIDs() {
+	w.event(previousGTIDsEvent, u64(0))
+}
+
+func (w *writer) gtid() {
+	w.event(gtidEvent, make([]byte, 42))
+}
+
+func (w *writer) query(schema, query string) {
+	body := concat(u32(7), u32(0), []byte{byte(len(schema))}, u16(0), u16(0), []byte(schema), []byte{0}, []byte(query))
+	w.event(queryEvent, body)
+}
+
+func (w *writer) xid(xid uint64) {
+	w.event(xidEvent, u64(xid))
+}
+
+func (w *writer) rotate(next string) {
+	w.event(rotateEvent, concat(u64(4), []byte(next)))
+}
+
+func (w *writer) userTableMap() {
+	w.tableMap(100, "shop", "user", userTypes, userMeta, userNullable, userOpt)
+}
+
+func (w *writer) tableMap(id uint64, schema, table string, types, meta []byte, nullable []bool, opt []byte) {
+	body := concat(tableID(id), u16(1),
+		[]byte{byte(len(schema))}, []byte(schema), []byte{0},
+		[]byte{byte(len(table))}, []byte(table), []byte{0},
+		lenEnc(uint64(len(types))), types,
+		lenEnc(uint64(len(meta))), meta,
+		bitmap(nullable), opt)
+	w.event(tableMapEvent, body)
+}
+
+// rows writes the v2 rows event, presentAfter is only for the update.
+func (w *writer) rows(typ byte, id uint64, columns int, present, presentAfter []bool, images ...[]byte) {
+	// the flags is STMT_END_F, the extra data is empty
+	body := concat(tableID(id), u16(1), u16(2), lenEnc(uint64(columns)), bitmap(present))
+	if presentAfter != nil {
+		body = append(body, bitmap(presentAfter)...)
+	}
+	for _, image := range images {
+		body = append(body, image...)
+	}
+	w.event(typ, body)
+}
+
+func (w *writer) save() {
+	if err := os.WriteFile(filepath.Join("testdata", w.name), w.buf.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// decimal10x2 encodes the DECIMAL(10,2) value.
+func decimal10x2(negative bool, integer uint32, fraction byte) []byte {
+	b := concat(be(uint64(integer), 4), []byte{fraction})
+	b[0] |= 0x80
+	if negative {
+		for i := range b {
+			b[i] ^= 0xff
+		}
+	}
+	return b
+}
+
+// datetime2x3 encodes the DATETIME(3) value.
+func datetime2x3(year, month, day, hour, minute, second, usec uint64) []byte {
+	ymd := (year*13+month)<<5 | day
+	hms := hour<<12 | minute<<6 | second
+	return concat(be(ymd<<17|hms+0x8000000000, 5), be(usec/100, 2))
+}
+
+// time2x2 encodes the TIME(2) value.
+func time2x2(negative bool, hour, minute, second, usec int64) []byte {
+	nr := (hour<<12|minute<<6|second)<<24 + usec
+	if negative {
+		nr = -nr
+	}
+	fraction := nr % (1 << 24)
+	return concat(be(uint64(0x800000+nr>>24), 3), []byte{byte(fraction / 10000)})
+}
+
+func tableID(id uint64) []byte {
+	return concat(u32(uint32(id)), u16(uint16(id>>32)))
+}
+
+func optField(typ byte, data []byte) []byte {
+	return concat([]byte{typ}, lenEnc(uint64(len(data))), data)
+}
+
+func names(ns []string) []byte {
+	var b []byte
+	for _, n := range ns {
+		b = append(b, lenEnc(uint64(len(n)))...)
+		b = append(b, n...)
+	}
+	return b
+}
+
+func varString(s string, lengthBytes int) []byte {
+	return concat(u64(uint64(len(s)))[:lengthBytes], []byte(s))
+}
+
+func lenEnc(n uint64) []byte {
+	switch {
+	case n < 251:
+		return []byte{byte(n)}
+	case n < 1<<16:
+		return concat([]byte{0xfc}, u16(uint16(n)))
+	case n < 1<<24:
+		return concat([]byte{0xfd}, u32(uint32(n))[:3])
+	}
+	return concat([]byte{0xfe}, u64(n))
+}
+
+func bitmap(bits []bool) []byte {
+	b := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			b[i/8] |= 1 << (i % 8)
+		}
+	}
+	return b
+}
+
+// nullBitmap returns the null bitmap of the image of n columns without NULLs.
+func nullBitmap(n int) []byte {
+	return bitmap(make([]bool, n))
+}
+
+func repeat(v bool, n int) []bool {
+	b := make([]bool, n)
+	for i := range b {
+		b[i] = v
+	}
+	return b
+}
+
+func u16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+
+func u32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+
+func u64(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+
+// be encodes v in n bytes big-endian.
+func be(v uint64, n int) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)[8-n:]
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
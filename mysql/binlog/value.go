@@ -0,0 +1,257 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readValue reads the value of the column i.
+// NOTE:
+//  Integers are int64, or uint64 if the column is known unsigned, ENUM is int64 index, SET and BIT are uint64;
+//  FLOAT is float32, DOUBLE is float64, DECIMAL is string;
+//  CHAR, VARCHAR are string, BLOB, TEXT, GEOMETRY and JSON (in MySQL binary format) are []byte;
+//  DATE, DATETIME and TIME are string like '2006-01-02 15:04:05.000000', TIMESTAMP is time.Time in UTC.
+func (t *TableMap) readValue(r *reader, i int) (interface{}, error) {
+	var (
+		typ  = t.ColumnTypes[i]
+		meta = t.ColumnMeta[i]
+	)
+	if typ == TypeString && meta >= 256 {
+		// the real type and length in meta
+		b0, b1 := byte(meta>>8), int(meta&0xff)
+		if b0&0x30 != 0x30 {
+			typ = b0 | 0x30
+			meta = uint16(b1 | (int(b0&0x30)^0x30)<<4)
+		} else {
+			typ = b0
+			meta = uint16(b1)
+		}
+	}
+	switch typ {
+	case TypeTiny:
+		return t.integer(r, i, 1), r.err
+	case TypeShort:
+		return t.integer(r, i, 2), r.err
+	case TypeInt24:
+		return t.integer(r, i, 3), r.err
+	case TypeLong:
+		return t.integer(r, i, 4), r.err
+	case TypeLongLong:
+		return t.integer(r, i, 8), r.err
+	case TypeYear:
+		if y := int64(r.byte()); y != 0 {
+			return y + 1900, r.err
+		}
+		return int64(0), r.err
+	case TypeFloat:
+		return math.Float32frombits(uint32(r.uintN(4))), r.err
+	case TypeDouble:
+		return math.Float64frombits(r.uintN(8)), r.err
+	case TypeNewDecimal:
+		return readDecimal(r, int(meta>>8), int(meta&0xff))
+	case TypeVarchar, TypeVarString, TypeString:
+		n := 1
+		if meta >= 256 {
+			n = 2
+		}
+		return string(r.bytes(int(r.uintN(n)))), r.err
+	case TypeEnum:
+		return int64(r.uintN(int(meta & 0xff))), r.err
+	case TypeSet:
+		return r.uintN(int(meta & 0xff)), r.err
+	case TypeBit:
+		bits := int(meta>>8)*8 + int(meta&0xff)
+		return bigEndian(r.bytes((bits + 7) / 8)), r.err
+	case TypeBlob, TypeTinyBlob, TypeMediumBlob, TypeLongBlob, TypeGeometry, TypeJSON:
+		n := int(meta)
+		if n == 0 {
+			n = blobLengthSize(typ)
+		}
+		return append([]byte(nil), r.bytes(int(r.uintN(n)))...), r.err
+	case TypeTimestamp:
+		return time.Unix(int64(r.uintN(4)), 0).UTC(), r.err
+	case TypeTimestamp2:
+		sec := int64(bigEndian(r.bytes(4)))
+		usec := readFrac(r, int(meta))
+		return time.Unix(sec, usec*1000).UTC(), r.err
+	case TypeDate, TypeNewDate:
+		v := r.uintN(3)
+		return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&15, v&31), r.err
+	case TypeDateTime:
+		v := r.uintN(8)
+		d, c := v/1000000, v%1000000
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", d/10000, d/100%100, d%100, c/10000, c/100%100, c%100), r.err
+	case TypeDateTime2:
+		v := int64(bigEndian(r.bytes(5))) - 0x8000000000
+		usec := readFrac(r, int(meta))
+		ymd, hms := v>>17, v&(1<<17-1)
+		ym := ymd >> 5
+		s := fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", ym/13, ym%13, ymd&31, hms>>12, (hms>>6)&63, hms&63)
+		return s + fracString(usec, int(meta)), r.err
+	case TypeTime:
+		v := int64(r.uintN(3))
+		if v&0x800000 != 0 {
+			v -= 1 << 24
+		}
+		var sign string
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, v/100%100, v%100), r.err
+	case TypeTime2:
+		return readTime2(r, int(meta))
+	case TypeNull:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported column type %d", typ)
+}
+
+// integer reads the little-endian integer of n bytes, signed unless the column is known unsigned.
+func (t *TableMap) integer(r *reader, i, n int) interface{} {
+	v := r.uintN(n)
+	if t.Unsigned != nil && t.Unsigned[i] {
+		return v
+	}
+	shift := 64 - 8*n
+	return int64(v<<shift) >> shift
+}
+
+func bigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func blobLengthSize(typ byte) int {
+	switch typ {
+	case TypeTinyBlob:
+		return 1
+	case TypeMediumBlob:
+		return 3
+	case TypeLongBlob:
+		return 4
+	}
+	return 2
+}
+
+// readFrac reads the fractional seconds of fsp digits, returns microseconds.
+func readFrac(r *reader, fsp int) int64 {
+	n := (fsp + 1) / 2
+	if n == 0 {
+		return 0
+	}
+	v := int64(bigEndian(r.bytes(n)))
+	for i := n; i < 3; i++ {
+		v *= 100
+	}
+	return v
+}
+
+func fracString(usec int64, fsp int) string {
+	if fsp <= 0 {
+		return ""
+	}
+	return "." + fmt.Sprintf("%06d", usec)[:fsp]
+}
+
+// readTime2 reads the TIME2 value, see my_time_packed_from_binary of MySQL.
+func readTime2(r *reader, fsp int) (interface{}, error) {
+	var v int64
+	switch fsp {
+	case 1, 2:
+		intPart := int64(bigEndian(r.bytes(3))) - 0x800000
+		frac := int64(r.byte())
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x100
+		}
+		v = intPart<<24 + frac*10000
+	case 3, 4:
+		intPart := int64(bigEndian(r.bytes(3))) - 0x800000
+		frac := int64(bigEndian(r.bytes(2)))
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		v = intPart<<24 + frac*100
+	case 5, 6:
+		v = int64(bigEndian(r.bytes(6))) - 0x800000000000
+	default:
+		v = (int64(bigEndian(r.bytes(3))) - 0x800000) << 24
+	}
+	var sign string
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	hms, usec := v>>24, v&(1<<24-1)
+	return fmt.Sprintf("%s%02d:%02d:%02d", sign, (hms>>12)&(1<<10-1), (hms>>6)&63, hms&63) + fracString(usec, fsp), r.err
+}
+
+// the bytes of the decimal digits less than 9
+var dig2bytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// readDecimal reads the binary DECIMAL(precision,scale), see bin2decimal of MySQL.
+func readDecimal(r *reader, precision, scale int) (interface{}, error) {
+	var (
+		intg  = precision - scale
+		intg0 = intg / 9
+		frac0 = scale / 9
+		size  = intg0*4 + dig2bytes[intg%9] + frac0*4 + dig2bytes[scale%9]
+		b     = append([]byte(nil), r.bytes(size)...)
+	)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if size == 0 {
+		return "0", nil
+	}
+	// the sign bit is set for positive values, the negative values are inverted
+	var mask byte
+	if b[0]&0x80 == 0 {
+		mask = 0xff
+	}
+	b[0] ^= 0x80
+	for i := range b {
+		b[i] ^= mask
+	}
+
+	group := func(n, digits int) string {
+		v := binary.BigEndian.Uint64(append(make([]byte, 8-n), b[:n]...))
+		b = b[n:]
+		str := strconv.FormatUint(v, 10)
+		if len(str) < digits {
+			str = strings.Repeat("0", digits-len(str)) + str
+		}
+		return str
+	}
+	var integer string
+	if n := dig2bytes[intg%9]; n > 0 {
+		integer = group(n, 0)
+	}
+	for i := 0; i < intg0; i++ {
+		integer += group(4, 9)
+	}
+	if integer = strings.TrimLeft(integer, "0"); integer == "" {
+		integer = "0"
+	}
+	if mask != 0 {
+		integer = "-" + integer
+	}
+	if scale == 0 {
+		return integer, nil
+	}
+	fraction := make([]string, 0, frac0+1)
+	for i := 0; i < frac0; i++ {
+		fraction = append(fraction, group(4, 9))
+	}
+	if n := dig2bytes[scale%9]; n > 0 {
+		fraction = append(fraction, group(n, scale%9))
+	}
+	return integer + "." + strings.Join(fraction, ""), nil
+}
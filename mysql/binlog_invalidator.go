@@ -0,0 +1,361 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/mysql/binlog"
+)
+
+// defaultSaveInterval the default minimum interval of saving the binlog position
+const defaultSaveInterval = time.Second
+
+// BinlogInvalidator deletes the primary key caches and the secondary caches of the unique keys
+// of the rows changed in the binlog, including the writes done outside xmodel, e.g. DBA scripts and other services.
+// NOTE:
+//  Requires binlog_format=ROW;
+//  The secondary caches are deleted only if the unique key columns are in the image, see binlog_row_image=FULL;
+//  The primary keys of the inserted rows are added to the bloom filter of the table, see EnableBloomFilter;
+//  The column names are read from the TABLE_MAP_EVENT if binlog_row_metadata=FULL,
+//  otherwise from information_schema, which may differ from the binlog after DDL;
+//  The position is saved at the transaction boundaries, the events after the saved position
+//  are handled again after restart, which is harmless.
+type BinlogInvalidator struct {
+	db     *DB
+	source binlog.Source
+	store  binlog.PositionStore
+	// Schema the database of the tables, default is the database of the *DB config.
+	Schema string
+	// SaveInterval the minimum interval of saving the position, default is 1s.
+	SaveInterval time.Duration
+	// OnInvalidate is called after the caches of the table are deleted, optional.
+	OnInvalidate func(tableName string, keys []string)
+	// UniqueKeys the fields of the unique keys cached besides the primary key by table name,
+	// e.g. map[string][][]string{"user": {{"email"}}}, the tables not in it use the fields tagged `key:"uni"`.
+	UniqueKeys map[string][][]string
+
+	columns      map[string][]string // key: table name, value: the column names from information_schema
+	queryColumns func(schema, tableName string) ([]string, error)
+	deleteKeys   func(keys []string) error
+}
+
+// NewBinlogInvalidator creates a binlog cache invalidator of the tables registered by RegCacheableDB.
+func (d *DB) NewBinlogInvalidator(source binlog.Source, store binlog.PositionStore) *BinlogInvalidator {
+	b := &BinlogInvalidator{
+		db:           d,
+		source:       source,
+		store:        store,
+		SaveInterval: defaultSaveInterval,
+		columns:      make(map[string][]string),
+	}
+	b.queryColumns = func(schema, tableName string) ([]string, error) {
+		var names []string
+		err := d.Select(&names, "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION;", schema, tableName)
+		return names, err
+	}
+	b.deleteKeys = func(keys []string) error {
+		// one key per command, the keys may be in different cluster slots
+		_, err := d.Cache.Pipelined(func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(key)
+			}
+			return nil
+		})
+		return err
+	}
+	return b
+}
+
+// Run reads the binlog from the saved position and deletes the caches, until ctx is done or an error occurs.
+// NOTE:
+//  Returns ctx.Err() if ctx is done;
+//  The position is saved before returning.
+func (b *BinlogInvalidator) Run(ctx context.Context) (err error) {
+	pos, err := b.store.Load()
+	if err != nil {
+		return err
+	}
+	if err = b.source.Seek(pos); err != nil {
+		return err
+	}
+	var (
+		saved    = pos
+		savedAt  = time.Now()
+		boundary = pos
+	)
+	defer func() {
+		if boundary != saved {
+			if serr := b.store.Save(boundary); serr != nil && err == nil {
+				err = serr
+			}
+		}
+	}()
+	for {
+		e, err := b.source.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if err = b.Handle(e); err != nil {
+			return err
+		}
+		if !isBoundary(e) {
+			continue
+		}
+		boundary = b.source.Position()
+		if time.Since(savedAt) >= b.SaveInterval {
+			if err = b.store.Save(boundary); err != nil {
+				return err
+			}
+			saved, savedAt = boundary, time.Now()
+		}
+	}
+}
+
+// isBoundary returns whether the position after the event is a transaction boundary to resume at.
+func isBoundary(e *binlog.Event) bool {
+	switch d := e.Data.(type) {
+	case *binlog.XID, *binlog.FormatDescription:
+		return true
+	case *binlog.Query:
+		return !strings.EqualFold(d.Query, "BEGIN")
+	}
+	return false
+}
+
+// Handle deletes the caches of the rows in the event.
+func (b *BinlogInvalidator) Handle(e *binlog.Event) error {
+	switch d := e.Data.(type) {
+	case *binlog.Query:
+		if !strings.EqualFold(d.Query, "BEGIN") && !strings.EqualFold(d.Query, "COMMIT") {
+			// DDL may change the columns
+			b.columns = make(map[string][]string)
+		}
+	case *binlog.Rows:
+		return b.invalidate(d)
+	}
+	return nil
+}
+
+func (b *BinlogInvalidator) invalidate(rows *binlog.Rows) error {
+	schema := b.Schema
+	if schema == "" {
+		schema = b.db.dbConfig.Database
+	}
+	if rows.Table.Schema != schema || b.db.dbConfig.NoCache {
+		return nil
+	}
+	c, ok := b.db.cacheableDBs[rows.Table.Table]
+	if !ok {
+		return nil
+	}
+	names, err := b.columnNames(rows.Table)
+	if err != nil {
+		return err
+	}
+	var priIndex = make([]int, len(c.priCols))
+	for i, col := range c.priCols {
+		if priIndex[i] = columnIndex(names, col); priIndex[i] == -1 {
+			return fmt.Errorf("BinlogInvalidator: primary key '%s' is not in the binlog columns of table '%s'", col, c.tableName)
+		}
+	}
+	uniqueKeys, err := b.uniqueKeys(c)
+	if err != nil {
+		return err
+	}
+
+	var (
+		keys = make([]string, 0, len(rows.Rows)*(1+len(uniqueKeys)))
+		seen = make(map[string]bool, cap(keys))
+		// the inserted rows and the after images of the updated rows, for the bloom filter
+		added []reflect.Value
+		add   = func(key string) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	)
+NEXT:
+	for i, row := range rows.Rows {
+		v := reflect.New(c.structType).Elem()
+		for j, idx := range priIndex {
+			if !rows.IsPresent(i, idx) {
+				// the after image without the primary key is not changed, see binlog_row_image=MINIMAL
+				continue NEXT
+			}
+			if err := b.setField(c, v, c.priFieldsIndex[j], row[idx]); err != nil {
+				return err
+			}
+		}
+		key, err := c.createPrikey(v)
+		if err != nil {
+			return err
+		}
+		if c.bloom != nil && (rows.Kind == binlog.RowsInsert || rows.Kind == binlog.RowsUpdate && i%2 == 1) {
+			added = append(added, v)
+		}
+		add(key)
+	UNIQUE:
+		for _, fields := range uniqueKeys {
+			values := make([]interface{}, len(fields))
+			for j, field := range fields {
+				idx := columnIndex(names, field)
+				if idx == -1 || !rows.IsPresent(i, idx) || row[idx] == nil {
+					continue UNIQUE
+				}
+				fi := c.fieldsIndexMap[field]
+				if err := b.setField(c, v, fi, row[idx]); err != nil {
+					return err
+				}
+				// the encoded fields are in the binlog as stored, which is the lookup value
+				values[j] = v.Field(fi).Interface()
+			}
+			uniqueKey, err := c.CreateCacheKeyByFields(fields, values)
+			if err != nil {
+				return err
+			}
+			add(uniqueKey)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err = b.deleteKeys(keys); err != nil {
+		return err
+	}
+	c.bloomAdd(added)
+	if b.OnInvalidate != nil {
+		b.OnInvalidate(c.tableName, keys)
+	}
+	return nil
+}
+
+// columnIndex returns the index of col in names, -1 if it is not found.
+func columnIndex(names []string, col string) int {
+	for i, name := range names {
+		if strings.EqualFold(name, col) {
+			return i
+		}
+	}
+	return -1
+}
+
+// setField sets the binlog value to the i-th field of v.
+func (b *BinlogInvalidator) setField(c *CacheableDB, v reflect.Value, i int, value interface{}) error {
+	if err := setBinlogValue(v.Field(i), value); err != nil {
+		return fmt.Errorf("BinlogInvalidator: table '%s' field %s: %s", c.tableName, c.structType.Field(i).Name, err.Error())
+	}
+	return nil
+}
+
+// uniqueKeys returns the fields of the unique keys of the table, in db field style.
+func (b *BinlogInvalidator) uniqueKeys(c *CacheableDB) ([][]string, error) {
+	uniqueKeys, ok := b.UniqueKeys[c.tableName]
+	if !ok {
+		for col, i := range c.fieldsIndexMap {
+			if c.structType.Field(i).Tag.Get("key") == "uni" {
+				uniqueKeys = append(uniqueKeys, []string{col})
+			}
+		}
+		sort.Slice(uniqueKeys, func(i, j int) bool { return uniqueKeys[i][0] < uniqueKeys[j][0] })
+		return uniqueKeys, nil
+	}
+	keys := make([][]string, 0, len(uniqueKeys))
+	for _, fields := range uniqueKeys {
+		snake := make([]string, len(fields))
+		for i, field := range fields {
+			snake[i] = gutil.SnakeString(field)
+			if _, ok := c.fieldsIndexMap[snake[i]]; !ok {
+				return nil, fmt.Errorf("BinlogInvalidator: table '%s' has no field '%s'", c.tableName, field)
+			}
+		}
+		if len(snake) > 0 {
+			keys = append(keys, snake)
+		}
+	}
+	return keys, nil
+}
+
+// columnNames returns the column names of the table in order.
+func (b *BinlogInvalidator) columnNames(t *binlog.TableMap) ([]string, error) {
+	if t.ColumnNames != nil {
+		return t.ColumnNames, nil
+	}
+	names, ok := b.columns[t.Table]
+	if ok && len(names) == len(t.ColumnTypes) {
+		return names, nil
+	}
+	names, err := b.queryColumns(t.Schema, t.Table)
+	if err != nil {
+		return nil, fmt.Errorf("BinlogInvalidator: %s", err.Error())
+	}
+	if len(names) != len(t.ColumnTypes) {
+		xlog.Warnf("BinlogInvalidator: table '%s' has %d columns, binlog has %d, set binlog_row_metadata=FULL", t.Table, len(names), len(t.ColumnTypes))
+		return nil, fmt.Errorf("BinlogInvalidator: the columns of table '%s' mismatch the binlog", t.Table)
+	}
+	b.columns[t.Table] = names
+	return names, nil
+}
+
+// setBinlogValue sets the decoded binlog value to the field.
+func setBinlogValue(fv reflect.Value, value interface{}) error {
+	switch x := value.(type) {
+	case nil:
+		return nil
+	case int64:
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fv.SetInt(x)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			// the signedness is unknown, e.g. MySQL 5.7
+			fv.SetUint(uint64(x) & (1<<fv.Type().Bits() - 1))
+			return nil
+		case reflect.String:
+			fv.SetString(strconv.FormatInt(x, 10))
+			return nil
+		}
+	case uint64:
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fv.SetInt(int64(x))
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			fv.SetUint(x)
+			return nil
+		case reflect.String:
+			fv.SetString(strconv.FormatUint(x, 10))
+			return nil
+		}
+	case string:
+		return setBinlogBytes(fv, []byte(x))
+	case []byte:
+		return setBinlogBytes(fv, x)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Type().ConvertibleTo(fv.Type()) && rv.Kind() != reflect.String {
+		fv.Set(rv.Convert(fv.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot set %T to %s", value, fv.Type())
+}
+
+func setBinlogBytes(fv reflect.Value, b []byte) error {
+	switch {
+	case fv.Kind() == reflect.String:
+		fv.SetString(string(b))
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8:
+		fv.SetBytes(b)
+	default:
+		return fmt.Errorf("cannot set string to %s", fv.Type())
+	}
+	return nil
+}
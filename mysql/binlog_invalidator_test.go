@@ -0,0 +1,131 @@
+package mysql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xmodel/mysql/binlog"
+	"github.com/swxctx/xmodel/redis"
+	"github.com/swxctx/xmodel/sqlx"
+	"github.com/swxctx/xmodel/sqlx/reflectx"
+)
+
+type binlogUser struct {
+	Id   uint64 `json:"id" key:"pri"`
+	Name string `json:"name" key:"uni"`
+}
+
+func (*binlogUser) TableName() string { return "user" }
+
+type binlogOrderItem struct {
+	OrderId int32  `json:"order_id" key:"pri"`
+	Item    string `json:"item" key:"pri"`
+	Qty     int16  `json:"qty"`
+}
+
+func (*binlogOrderItem) TableName() string { return "order_item" }
+
+type memPositionStore struct {
+	pos   binlog.Position
+	saves int
+}
+
+func (s *memPositionStore) Load() (binlog.Position, error) { return s.pos, nil }
+
+func (s *memPositionStore) Save(pos binlog.Position) error {
+	s.pos = pos
+	s.saves++
+	return nil
+}
+
+func TestBinlogInvalidator(t *testing.T) {
+	d := &DB{
+		DB:           &sqlx.DB{Mapper: reflectx.NewMapperFunc("json", gutil.SnakeString)},
+		dbConfig:     &Config{Database: "shop"},
+		Cache:        &redis.Client{},
+		cacheableDBs: make(map[string]*CacheableDB),
+	}
+	for _, ormStructPtr := range []Cacheable{&binlogUser{}, &binlogOrderItem{}} {
+		if _, err := d.RegCacheableDB(ormStructPtr, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := binlog.NewFileSource("binlog/testdata")
+	source.PollInterval = time.Millisecond
+	store := &memPositionStore{}
+	b := d.NewBinlogInvalidator(source, store)
+	b.SaveInterval = 0
+	// order_item has no column names in the binlog
+	b.queryColumns = func(schema, tableName string) ([]string, error) {
+		if schema != "shop" || tableName != "order_item" {
+			t.Fatalf("queryColumns(%s, %s)", schema, tableName)
+		}
+		return []string{"order_id", "item", "qty"}, nil
+	}
+	b.UniqueKeys = map[string][][]string{"order_item": {{"Item"}}}
+	var deleted [][]string
+	b.deleteKeys = func(keys []string) error {
+		deleted = append(deleted, keys)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := b.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Run() = %v", err)
+	}
+	want := [][]string{
+		{"shop:user:id[1]", `shop:user:name["alice"]`, "shop:user:id[2]", `shop:user:name["bob"]`},
+		{"shop:user:id[1]", `shop:user:name["alice"]`, `shop:user:name["alice2"]`, "shop:user:id[2]", `shop:user:name["bob"]`, "shop:user:id[3]"},
+		{`shop:order_item:item&order_id["apple",7]`, `shop:order_item:item["apple"]`},
+		{"shop:user:id[3]", `shop:user:name["bob"]`},
+	}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted keys = %q\nwant %q", deleted, want)
+	}
+	if store.pos != source.Position() || store.pos.File != "binlog.000002" || store.saves < 4 {
+		t.Fatalf("saved position = %s, saves %d, source at %s", store.pos, store.saves, source.Position())
+	}
+
+	// resume at the end
+	deleted = nil
+	source = binlog.NewFileSource("binlog/testdata")
+	b.source = source
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Run(ctx); err != context.DeadlineExceeded || deleted != nil {
+		t.Fatalf("Run() after resuming = %v, deleted %q", err, deleted)
+	}
+}
+
+func TestSetBinlogValue(t *testing.T) {
+	var (
+		u8  uint8
+		s   string
+		bs  []byte
+		i64 int64
+	)
+	for _, c := range []struct {
+		dest  interface{}
+		value interface{}
+		want  interface{}
+	}{
+		{&u8, int64(-56), uint8(200)},
+		{&s, int64(12), "12"},
+		{&s, []byte("a"), "a"},
+		{&bs, "b", []byte("b")},
+		{&i64, uint64(7), int64(7)},
+	} {
+		fv := reflect.ValueOf(c.dest).Elem()
+		if err := setBinlogValue(fv, c.value); err != nil || !reflect.DeepEqual(fv.Interface(), c.want) {
+			t.Errorf("setBinlogValue(%T, %#v) = %#v, %v", c.dest, c.value, fv.Interface(), err)
+		}
+	}
+	if err := setBinlogValue(reflect.ValueOf(&i64).Elem(), "x"); err == nil {
+		t.Error("setBinlogValue(int64, string) returns nil error")
+	}
+}
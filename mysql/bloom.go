@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/redis"
+)
+
+// bloomOptions the size of the bloom filter of a table.
+type bloomOptions struct {
+	expected int64
+	fpRate   float64
+}
+
+// EnableBloomFilter guards the lookups by primary key with a redis bloom filter of the primary keys,
+// sized for expected keys at the false positive rate fpRate, e.g. 0.01.
+// NOTE:
+//  Call it right after registration, it can be called before the *PreDB is initialized;
+//  CacheGet by primary key returns sql.ErrNoRows without reading the cache or the database if the key is not in the filter;
+//  The filter takes effect after the first RebuildBloomFilter, which adds the existing rows;
+//  Insert, Upsert, BatchInsert and BatchUpsert add the keys (even if the transaction is rolled back later),
+//  so do the generated model functions;
+//  Rows inserted by hand-written SQL are not added unless a BinlogInvalidator is running,
+//  otherwise call RebuildBloomFilter after them;
+//  The deleted keys stay in the filter until it is rebuilt.
+func (c *CacheableDB) EnableBloomFilter(expected int64, fpRate float64) error {
+	if expected <= 0 || fpRate <= 0 || fpRate >= 1 {
+		return fmt.Errorf("EnableBloomFilter(): invalid expected %d or fpRate %v", expected, fpRate)
+	}
+	c.bloomOpts = &bloomOptions{expected: expected, fpRate: fpRate}
+	if c.fieldsIndexMap == nil {
+		// registered by *PreDB and not initialized yet
+		return nil
+	}
+	if c.DB.dbConfig.NoCache || c.Cache == nil {
+		return fmt.Errorf("EnableBloomFilter(): table '%s': %s", c.tableName, ErrCacheNil.Error())
+	}
+	c.bloom = redis.NewBloomFilter(c.Cache, c.module, c.tableName+":bloom", expected, fpRate)
+	return nil
+}
+
+// BloomFilter returns the bloom filter of the primary keys, nil if it is not enabled.
+func (c *CacheableDB) BloomFilter() *redis.BloomFilter {
+	return c.bloom
+}
+
+// RebuildBloomFilter repopulates the bloom filter with the primary keys of all the rows, including the soft deleted ones.
+// NOTE:
+//  The primary keys are streamed in batches ordered by primary key;
+//  The lookups use the old filter until the new one is complete, the keys inserted meanwhile are added to both;
+//  Returns the number of the keys added.
+func (c *CacheableDB) RebuildBloomFilter(ctx context.Context) (int64, error) {
+	if c.bloom == nil {
+		return 0, fmt.Errorf("RebuildBloomFilter(): table '%s' has no bloom filter", c.tableName)
+	}
+	var n int64
+	err := c.bloom.Rebuild(func(add func(items ...string) error) error {
+		it := c.newColsBatchIter(ctx, c.priCols, "", nil)
+		defer it.close()
+		keys := make([]string, 0, it.batchSize)
+		for it.next() {
+			key, err := c.createPrikey(reflect.ValueOf(it.value()).Elem())
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			if len(keys) == cap(keys) {
+				if err = add(keys...); err != nil {
+					return err
+				}
+				n += int64(len(keys))
+				keys = keys[:0]
+			}
+		}
+		if it.err != nil {
+			return it.err
+		}
+		if err := add(keys...); err != nil {
+			return err
+		}
+		n += int64(len(keys))
+		return nil
+	})
+	if err != nil {
+		return 0, errors.New("RebuildBloomFilter(): " + err.Error())
+	}
+	return n, nil
+}
+
+// bloomExists returns false if the primary key of key is surely not in the table.
+// NOTE:
+//  Returns true if the filter is not enabled or fails.
+func (c *CacheableDB) bloomExists(key string) bool {
+	if c.bloom == nil {
+		return true
+	}
+	ok, err := c.bloom.Exists(key)
+	if err != nil {
+		xlog.Warnf("CacheGet(): bloom filter of table '%s': %s", c.tableName, err.Error())
+		return true
+	}
+	return ok
+}
+
+// bloomAdd adds the primary keys of rows to the bloom filter, logs the error.
+func (c *CacheableDB) bloomAdd(rows []reflect.Value) {
+	if c.bloom == nil {
+		return
+	}
+	keys := make([]string, 0, len(rows))
+	for _, v := range rows {
+		key, err := c.createPrikey(v)
+		if err != nil {
+			xlog.Errorf("bloomAdd(): table '%s': %s", c.tableName, err.Error())
+			return
+		}
+		keys = append(keys, key)
+	}
+	if err := c.bloom.Add(keys...); err != nil {
+		xlog.Errorf("bloomAdd(): table '%s': %s", c.tableName, err.Error())
+	}
+}
@@ -0,0 +1,107 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xmodel/mysql/binlog"
+	"github.com/swxctx/xmodel/redis"
+	"github.com/swxctx/xmodel/sqlx"
+	"github.com/swxctx/xmodel/sqlx/reflectx"
+)
+
+type bloomUser struct {
+	Id   int64  `json:"id" key:"pri"`
+	Name string `json:"name"`
+}
+
+func (*bloomUser) TableName() string { return "bloom_user" }
+
+func TestBloomFilter(t *testing.T) {
+	m := miniredis.RunT(t)
+	cache, err := redis.NewClient(&redis.Config{DeployType: redis.TypeSingle, ForSingle: redis.SingleConfig{Addr: m.Addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	// without a database connection, CacheGet must be served by the filter or the cache
+	d := &DB{
+		DB:           &sqlx.DB{Mapper: reflectx.NewMapperFunc("json", gutil.SnakeString)},
+		dbConfig:     &Config{Database: "shop"},
+		Cache:        cache,
+		cacheableDBs: make(map[string]*CacheableDB),
+	}
+	c, err := d.RegCacheableDB(&bloomUser{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.EnableBloomFilter(1000, 1); err == nil {
+		t.Fatal("EnableBloomFilter() of an invalid fpRate returns nil error")
+	}
+	if err = c.EnableBloomFilter(1000, 0.01); err != nil {
+		t.Fatal(err)
+	}
+	if key := c.BloomFilter().Key(); key != "shop:bloom_user:{bloom_user:bloom}" {
+		t.Fatalf("BloomFilter().Key() = %s", key)
+	}
+
+	// registered by *PreDB and not initialized yet
+	pending := new(CacheableDB)
+	if err = pending.EnableBloomFilter(1000, 0.01); err != nil || pending.bloom != nil || pending.bloomOpts.expected != 1000 {
+		t.Fatalf("EnableBloomFilter() before initialization = %v, %+v", err, pending.bloomOpts)
+	}
+
+	// the filter takes effect after the first rebuild
+	if !c.bloomExists(`shop:bloom_user:id[2]`) {
+		t.Fatal("bloomExists() before the rebuild = false")
+	}
+	if err = c.BloomFilter().Rebuild(func(add func(items ...string) error) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CacheGet(&bloomUser{Id: 2}); err != ErrNoRows {
+		t.Fatalf("CacheGet() of a key not in the filter = %v", err)
+	}
+
+	// the inserted rows are added
+	row := &bloomUser{Id: 1, Name: "a"}
+	if err = c.PutCache(row); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CacheGet(&bloomUser{Id: 1}); err != ErrNoRows {
+		t.Fatalf("CacheGet() of a cached key not in the filter = %v", err)
+	}
+	c.bloomAdd([]reflect.Value{reflect.ValueOf(row).Elem()})
+	got := &bloomUser{Id: 1}
+	if err = c.CacheGet(got); err != nil || *got != *row {
+		t.Fatalf("CacheGet() = %+v, %v", got, err)
+	}
+
+	// the rows inserted outside xmodel are added by the binlog invalidator
+	b := d.NewBinlogInvalidator(nil, nil)
+	table := &binlog.TableMap{Schema: "shop", Table: "bloom_user", ColumnTypes: []byte{8, 15}, ColumnNames: []string{"id", "name"}}
+	if err = b.Handle(&binlog.Event{Data: &binlog.Rows{
+		Kind:    binlog.RowsDelete,
+		Table:   table,
+		Present: []bool{true, true},
+		Rows:    [][]interface{}{{int64(3), "c"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if c.bloomExists(`shop:bloom_user:id[3]`) {
+		t.Fatal("the deleted row is added to the filter")
+	}
+	if err = b.Handle(&binlog.Event{Data: &binlog.Rows{
+		Kind:    binlog.RowsInsert,
+		Table:   table,
+		Present: []bool{true, true},
+		Rows:    [][]interface{}{{int64(3), "c"}, {int64(4), "d"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if !c.bloomExists(`shop:bloom_user:id[3]`) || !c.bloomExists(`shop:bloom_user:id[4]`) {
+		t.Fatal("the inserted rows in the binlog are not added to the filter")
+	}
+}
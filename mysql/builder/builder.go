@@ -0,0 +1,333 @@
+// Package builder is a type-safe fluent query builder for mysql models.
+//
+// It produces SQL with '?' placeholders plus the bind arguments, which can be
+// passed to sqlx directly, e.g.
+//
+//	query, args, err := builder.From("user").
+//		Where(UserCol.Name.Like("x%"), UserCol.Age.Between(18, 30)).
+//		OrderBy(UserCol.Id.Desc()).
+//		Limit(10).
+//		SoftDelete("deleted_ts").
+//		ToSQL()
+//	err = db.Select(&users, query, args...)
+package builder
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// DeletedTs the default soft-delete column of xmodel tables.
+const DeletedTs Column = "deleted_ts"
+
+// maxLimit the max LIMIT value of mysql, used when only OFFSET is specified.
+const maxLimit = "18446744073709551615"
+
+type join struct {
+	kind  string
+	table string
+	on    Cond
+}
+
+// Query the fluent SELECT query builder.
+type Query struct {
+	table         string
+	cols          []Column
+	joins         []join
+	where         Cond
+	groupBy       []Column
+	having        Cond
+	orders        []Order
+	limit         int64
+	offset        int64
+	softDeleteCol Column
+	unscoped      bool
+}
+
+// New creates an empty query.
+func New() *Query {
+	return &Query{limit: -1, offset: -1}
+}
+
+// From creates a query from the table.
+func From(table string) *Query {
+	return New().From(table)
+}
+
+// Where creates a query with the conditions joined by AND.
+func Where(conds ...Cond) *Query {
+	return New().Where(conds...)
+}
+
+// Clone returns a copy of the query.
+func (q *Query) Clone() *Query {
+	c := *q
+	c.cols = append([]Column(nil), q.cols...)
+	c.joins = append([]join(nil), q.joins...)
+	c.groupBy = append([]Column(nil), q.groupBy...)
+	c.orders = append([]Order(nil), q.orders...)
+	return &c
+}
+
+// From sets the main table.
+func (q *Query) From(table string) *Query {
+	q.table = table
+	return q
+}
+
+// Select sets the selected columns.
+// NOTE:
+//  Select all columns if cols is empty.
+func (q *Query) Select(cols ...Column) *Query {
+	q.cols = cols
+	return q
+}
+
+// Join adds 'INNER JOIN table ON cond'.
+func (q *Query) Join(table string, on Cond) *Query {
+	return q.addJoin("INNER JOIN", table, on)
+}
+
+// LeftJoin adds 'LEFT JOIN table ON cond'.
+func (q *Query) LeftJoin(table string, on Cond) *Query {
+	return q.addJoin("LEFT JOIN", table, on)
+}
+
+// RightJoin adds 'RIGHT JOIN table ON cond'.
+func (q *Query) RightJoin(table string, on Cond) *Query {
+	return q.addJoin("RIGHT JOIN", table, on)
+}
+
+func (q *Query) addJoin(kind, table string, on Cond) *Query {
+	q.joins = append(q.joins, join{kind: kind, table: table, on: on})
+	return q
+}
+
+// Where adds the conditions joined by AND.
+func (q *Query) Where(conds ...Cond) *Query {
+	return q.And(conds...)
+}
+
+// And adds the conditions with AND.
+func (q *Query) And(conds ...Cond) *Query {
+	if len(conds) == 0 {
+		return q
+	}
+	if q.where == nil {
+		q.where = And(conds...)
+	} else {
+		q.where = And(q.where, And(conds...))
+	}
+	return q
+}
+
+// Or adds the conditions with OR, e.g. '(current) OR (conds...)'.
+func (q *Query) Or(conds ...Cond) *Query {
+	if len(conds) == 0 {
+		return q
+	}
+	if q.where == nil {
+		q.where = And(conds...)
+	} else {
+		q.where = Or(q.where, And(conds...))
+	}
+	return q
+}
+
+// GroupBy sets the GROUP BY columns.
+func (q *Query) GroupBy(cols ...Column) *Query {
+	q.groupBy = cols
+	return q
+}
+
+// Having adds the HAVING conditions joined by AND.
+func (q *Query) Having(conds ...Cond) *Query {
+	if q.having == nil {
+		q.having = And(conds...)
+	} else {
+		q.having = And(q.having, And(conds...))
+	}
+	return q
+}
+
+// OrderBy appends the ORDER BY items.
+func (q *Query) OrderBy(orders ...Order) *Query {
+	q.orders = append(q.orders, orders...)
+	return q
+}
+
+// Limit sets the LIMIT, n<0 means no limit.
+func (q *Query) Limit(n int64) *Query {
+	q.limit = n
+	return q
+}
+
+// Offset sets the OFFSET, n<0 means no offset.
+func (q *Query) Offset(n int64) *Query {
+	q.offset = n
+	return q
+}
+
+// SoftDelete filters the rows which are soft deleted, e.g. '`deleted_ts`=0'.
+// NOTE:
+//  It is ignored if Unscoped() is called.
+func (q *Query) SoftDelete(col Column) *Query {
+	q.softDeleteCol = col
+	return q
+}
+
+// Unscoped includes the soft deleted rows.
+func (q *Query) Unscoped() *Query {
+	q.unscoped = true
+	return q
+}
+
+// ErrNoTable error: the query has no table
+var ErrNoTable = errors.New("builder: the query has no table, call From()")
+
+// ToSQL returns the SELECT statement and its arguments.
+func (q *Query) ToSQL() (string, []interface{}, error) {
+	if q.table == "" {
+		return "", nil, ErrNoTable
+	}
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	if len(q.cols) == 0 {
+		b.WriteString("*")
+	} else {
+		for i, col := range q.cols {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(col.Quote())
+		}
+	}
+	args := q.writeFrom(&b)
+	args = append(args, q.writeTail(&b, true)...)
+	return b.String(), args, nil
+}
+
+// CountSQL returns the 'SELECT COUNT(*)' statement and its arguments.
+// NOTE:
+//  ORDER BY, LIMIT and OFFSET are ignored.
+func (q *Query) CountSQL() (string, []interface{}, error) {
+	if q.table == "" {
+		return "", nil, ErrNoTable
+	}
+	var b strings.Builder
+	if len(q.groupBy) > 0 {
+		b.WriteString("SELECT COUNT(*) FROM (SELECT 1")
+	} else {
+		b.WriteString("SELECT COUNT(*)")
+	}
+	args := q.writeFrom(&b)
+	args = append(args, q.writeTail(&b, false)...)
+	if len(q.groupBy) > 0 {
+		b.WriteString(") AS `_t`")
+	}
+	return b.String(), args, nil
+}
+
+// WhereSQL returns the WHERE condition with its tail (GROUP BY, HAVING, ORDER BY, LIMIT and OFFSET),
+// which can be used as the 'whereCond' of the generated '*ByWhere' functions.
+// NOTE:
+//  Returns '1=1' if there is no condition.
+func (q *Query) WhereSQL() (string, []interface{}) {
+	cond, args := q.cond()
+	if cond == "" {
+		cond = "1=1"
+	}
+	var b strings.Builder
+	b.WriteString(cond)
+	args = append(args, q.writeTail(&b, true)...)
+	return b.String(), args
+}
+
+func (q *Query) cond() (string, []interface{}) {
+	var (
+		s    string
+		args []interface{}
+	)
+	if q.where != nil {
+		s, args = q.where.ToSQL()
+	}
+	if q.softDeleteCol == "" || q.unscoped {
+		return s, args
+	}
+	col := q.softDeleteCol
+	if len(q.joins) > 0 && q.table != "" && !strings.Contains(string(col), ".") {
+		col = col.Of(q.table)
+	}
+	if s == "" {
+		return col.Quote() + "=0", args
+	}
+	return "(" + s + ") AND " + col.Quote() + "=0", args
+}
+
+func (q *Query) writeFrom(b *strings.Builder) []interface{} {
+	var args []interface{}
+	b.WriteString(" FROM ")
+	b.WriteString(quoteName(q.table))
+	for _, j := range q.joins {
+		b.WriteByte(' ')
+		b.WriteString(j.kind)
+		b.WriteByte(' ')
+		b.WriteString(quoteName(j.table))
+		if j.on != nil {
+			s, a := j.on.ToSQL()
+			b.WriteString(" ON ")
+			b.WriteString(s)
+			args = append(args, a...)
+		}
+	}
+	if s, a := q.cond(); s != "" {
+		b.WriteString(" WHERE ")
+		b.WriteString(s)
+		args = append(args, a...)
+	}
+	return args
+}
+
+func (q *Query) writeTail(b *strings.Builder, withPaging bool) []interface{} {
+	var args []interface{}
+	if len(q.groupBy) > 0 {
+		b.WriteString(" GROUP BY ")
+		for i, col := range q.groupBy {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(col.Quote())
+		}
+		if q.having != nil {
+			if s, a := q.having.ToSQL(); s != "" {
+				b.WriteString(" HAVING ")
+				b.WriteString(s)
+				args = append(args, a...)
+			}
+		}
+	}
+	if !withPaging {
+		return args
+	}
+	if len(q.orders) > 0 {
+		b.WriteString(" ORDER BY ")
+		for i, o := range q.orders {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(string(o))
+		}
+	}
+	if q.limit >= 0 {
+		b.WriteString(" LIMIT ")
+		b.WriteString(strconv.FormatInt(q.limit, 10))
+	} else if q.offset >= 0 {
+		b.WriteString(" LIMIT " + maxLimit)
+	}
+	if q.offset >= 0 {
+		b.WriteString(" OFFSET ")
+		b.WriteString(strconv.FormatInt(q.offset, 10))
+	}
+	return args
+}
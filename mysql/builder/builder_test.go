@@ -0,0 +1,141 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+var userCol = struct {
+	Id        Column
+	Name      Column
+	Age       Column
+	DeletedTs Column
+}{
+	Id:        "id",
+	Name:      "name",
+	Age:       "age",
+	DeletedTs: "deleted_ts",
+}
+
+func TestToSQL(t *testing.T) {
+	var cases = []struct {
+		q     *Query
+		query string
+		args  []interface{}
+	}{
+		{
+			q:     From("user"),
+			query: "SELECT * FROM `user`",
+		},
+		{
+			q: From("user").
+				Select(userCol.Id, userCol.Name).
+				Where(userCol.Name.Like("x%"), userCol.Age.Between(18, 30)).
+				OrderBy(userCol.Id.Desc()).
+				Limit(10).
+				Offset(20).
+				SoftDelete(userCol.DeletedTs),
+			query: "SELECT `id`,`name` FROM `user` WHERE ((`name` LIKE ?) AND (`age` BETWEEN ? AND ?)) AND `deleted_ts`=0 ORDER BY `id` DESC LIMIT 10 OFFSET 20",
+			args:  []interface{}{"x%", 18, 30},
+		},
+		{
+			q: From("user").
+				Where(userCol.Id.In([]int64{1, 2, 3})).
+				Or(userCol.Name.Eq("a")).
+				SoftDelete(userCol.DeletedTs),
+			query: "SELECT * FROM `user` WHERE ((`id` IN (?,?,?)) OR (`name`=?)) AND `deleted_ts`=0",
+			args:  []interface{}{int64(1), int64(2), int64(3), "a"},
+		},
+		{
+			q:     From("user").Where(userCol.Id.In()).SoftDelete(userCol.DeletedTs).Unscoped(),
+			query: "SELECT * FROM `user` WHERE 1=0",
+		},
+		{
+			q: From("user").
+				Select(userCol.Age, "COUNT(*)").
+				GroupBy(userCol.Age).
+				Having(Raw("COUNT(*)>?", 1)).
+				Offset(5),
+			query: "SELECT `age`,COUNT(*) FROM `user` GROUP BY `age` HAVING COUNT(*)>? LIMIT 18446744073709551615 OFFSET 5",
+			args:  []interface{}{1},
+		},
+		{
+			q: From("user").
+				Select(userCol.Name.Of("user"), "log.text").
+				LeftJoin("log", userCol.Id.Of("user").EqCol("log.user_id")).
+				Where(userCol.Age.Gte(18)).
+				SoftDelete(userCol.DeletedTs),
+			query: "SELECT `user`.`name`,`log`.`text` FROM `user` LEFT JOIN `log` ON `user`.`id`=`log`.`user_id` WHERE (`age`>=?) AND `user`.`deleted_ts`=0",
+			args:  []interface{}{18},
+		},
+	}
+	for i, c := range cases {
+		query, args, err := c.q.ToSQL()
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if query != c.query {
+			t.Errorf("%d: query\nwant: %s\nhave: %s", i, c.query, query)
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("%d: args\nwant: %v\nhave: %v", i, c.args, args)
+		}
+	}
+}
+
+func TestCountSQL(t *testing.T) {
+	query, args, err := From("user").
+		Where(userCol.Age.Gt(18)).
+		GroupBy(userCol.Age).
+		OrderBy(userCol.Age.Asc()).
+		Limit(1).
+		SoftDelete(userCol.DeletedTs).
+		CountSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT COUNT(*) FROM (SELECT 1 FROM `user` WHERE (`age`>?) AND `deleted_ts`=0 GROUP BY `age`) AS `_t`"
+	if query != want {
+		t.Errorf("query\nwant: %s\nhave: %s", want, query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{18}) {
+		t.Errorf("args: %v", args)
+	}
+	if _, _, err = Where(userCol.Age.Gt(18)).CountSQL(); err != ErrNoTable {
+		t.Errorf("want ErrNoTable, have %v", err)
+	}
+}
+
+func TestWhereSQL(t *testing.T) {
+	whereCond, args := Where(Not(userCol.Name.IsNull()), Or(userCol.Age.Lt(10), userCol.Age.Gt(60))).
+		OrderBy(userCol.Id.Asc()).
+		Limit(2).
+		SoftDelete(userCol.DeletedTs).
+		WhereSQL()
+	want := "((NOT (`name` IS NULL)) AND ((`age`<?) OR (`age`>?))) AND `deleted_ts`=0 ORDER BY `id` ASC LIMIT 2"
+	if whereCond != want {
+		t.Errorf("whereCond\nwant: %s\nhave: %s", want, whereCond)
+	}
+	if !reflect.DeepEqual(args, []interface{}{10, 60}) {
+		t.Errorf("args: %v", args)
+	}
+	if whereCond, _ = New().WhereSQL(); whereCond != "1=1" {
+		t.Errorf("empty whereCond: %s", whereCond)
+	}
+}
+
+func TestLogicCondParentheses(t *testing.T) {
+	for _, c := range []struct {
+		cond Cond
+		want string
+	}{
+		{And(Raw("a=? XOR b=?", 1, 2), userCol.Age.Gt(3)), "(a=? XOR b=?) AND (`age`>?)"},
+		{And(Raw("a=1 or b=2"), Raw("c=3")), "(a=1 or b=2) AND (c=3)"},
+		{Or(userCol.Name.Eq("color"), userCol.Name.Like("%or%")), "(`name`=?) OR (`name` LIKE ?)"},
+		{And(nil, Raw(""), userCol.Id.Eq(1)), "`id`=?"},
+	} {
+		if s, _ := c.cond.ToSQL(); s != c.want {
+			t.Errorf("ToSQL()\nwant: %s\nhave: %s", c.want, s)
+		}
+	}
+}
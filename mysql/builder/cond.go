@@ -0,0 +1,242 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Column the typed column name of a table.
+// Use it to create conditions and orders which are checked at compile time.
+type Column string
+
+// Quote returns the column name quoted with backticks.
+// NOTE:
+//  'table.col' is quoted as '`table`.`col`'.
+func (c Column) Quote() string {
+	return quoteName(string(c))
+}
+
+// String returns the raw column name.
+func (c Column) String() string {
+	return string(c)
+}
+
+// Of returns the column qualified by the table name, e.g. 'user.name'.
+func (c Column) Of(table string) Column {
+	return Column(table + "." + string(c))
+}
+
+// Eq creates the condition 'col=?'.
+func (c Column) Eq(v interface{}) Cond {
+	return c.op("=", v)
+}
+
+// Ne creates the condition 'col<>?'.
+func (c Column) Ne(v interface{}) Cond {
+	return c.op("<>", v)
+}
+
+// Gt creates the condition 'col>?'.
+func (c Column) Gt(v interface{}) Cond {
+	return c.op(">", v)
+}
+
+// Gte creates the condition 'col>=?'.
+func (c Column) Gte(v interface{}) Cond {
+	return c.op(">=", v)
+}
+
+// Lt creates the condition 'col<?'.
+func (c Column) Lt(v interface{}) Cond {
+	return c.op("<", v)
+}
+
+// Lte creates the condition 'col<=?'.
+func (c Column) Lte(v interface{}) Cond {
+	return c.op("<=", v)
+}
+
+// Like creates the condition 'col LIKE ?'.
+func (c Column) Like(pattern string) Cond {
+	return c.op(" LIKE ", pattern)
+}
+
+// NotLike creates the condition 'col NOT LIKE ?'.
+func (c Column) NotLike(pattern string) Cond {
+	return c.op(" NOT LIKE ", pattern)
+}
+
+// In creates the condition 'col IN (?,?,...)'.
+// NOTE:
+//  A single slice argument is expanded;
+//  An empty list never matches.
+func (c Column) In(vs ...interface{}) Cond {
+	return inCond{col: c, values: expandValues(vs)}
+}
+
+// NotIn creates the condition 'col NOT IN (?,?,...)'.
+// NOTE:
+//  A single slice argument is expanded;
+//  An empty list always matches.
+func (c Column) NotIn(vs ...interface{}) Cond {
+	return inCond{col: c, values: expandValues(vs), not: true}
+}
+
+// Between creates the condition 'col BETWEEN ? AND ?'.
+func (c Column) Between(from, to interface{}) Cond {
+	return Raw(c.Quote()+" BETWEEN ? AND ?", from, to)
+}
+
+// IsNull creates the condition 'col IS NULL'.
+func (c Column) IsNull() Cond {
+	return Raw(c.Quote() + " IS NULL")
+}
+
+// IsNotNull creates the condition 'col IS NOT NULL'.
+func (c Column) IsNotNull() Cond {
+	return Raw(c.Quote() + " IS NOT NULL")
+}
+
+// EqCol creates the condition 'col=other', e.g. for JOIN ... ON.
+func (c Column) EqCol(other Column) Cond {
+	return Raw(c.Quote() + "=" + other.Quote())
+}
+
+// Asc creates the order 'col ASC'.
+func (c Column) Asc() Order {
+	return Order(c.Quote() + " ASC")
+}
+
+// Desc creates the order 'col DESC'.
+func (c Column) Desc() Order {
+	return Order(c.Quote() + " DESC")
+}
+
+func (c Column) op(op string, v interface{}) Cond {
+	return Raw(c.Quote()+op+"?", v)
+}
+
+// Order the ORDER BY item.
+type Order string
+
+// Cond the SQL condition with bind arguments.
+type Cond interface {
+	// ToSQL returns the condition string with '?' placeholders and its arguments.
+	ToSQL() (string, []interface{})
+}
+
+type rawCond struct {
+	sql  string
+	args []interface{}
+}
+
+// Raw creates a condition from the raw sql with '?' placeholders.
+func Raw(sql string, args ...interface{}) Cond {
+	return rawCond{sql: sql, args: args}
+}
+
+func (r rawCond) ToSQL() (string, []interface{}) {
+	return r.sql, r.args
+}
+
+type inCond struct {
+	col    Column
+	values []interface{}
+	not    bool
+}
+
+func (i inCond) ToSQL() (string, []interface{}) {
+	if len(i.values) == 0 {
+		if i.not {
+			return "1=1", nil
+		}
+		return "1=0", nil
+	}
+	var op = " IN ("
+	if i.not {
+		op = " NOT IN ("
+	}
+	return i.col.Quote() + op + strings.Repeat("?,", len(i.values)-1) + "?)", i.values
+}
+
+type logicCond struct {
+	op    string
+	conds []Cond
+}
+
+// And joins the conditions with AND.
+// NOTE:
+//  Each condition is parenthesized if there are more than one, so the raw conditions keep their precedence.
+func And(conds ...Cond) Cond {
+	return logicCond{op: " AND ", conds: conds}
+}
+
+// Or joins the conditions with OR.
+// NOTE:
+//  Each condition is parenthesized if there are more than one, so the raw conditions keep their precedence.
+func Or(conds ...Cond) Cond {
+	return logicCond{op: " OR ", conds: conds}
+}
+
+// Not negates the condition.
+func Not(cond Cond) Cond {
+	s, args := cond.ToSQL()
+	return Raw("NOT ("+s+")", args...)
+}
+
+func (l logicCond) ToSQL() (string, []interface{}) {
+	var (
+		parts = make([]string, 0, len(l.conds))
+		args  []interface{}
+	)
+	for _, c := range l.conds {
+		if c == nil {
+			continue
+		}
+		s, a := c.ToSQL()
+		if s == "" {
+			continue
+		}
+		parts = append(parts, s)
+		args = append(args, a...)
+	}
+	if len(parts) == 1 {
+		return parts[0], args
+	}
+	for i, s := range parts {
+		parts[i] = "(" + s + ")"
+	}
+	return strings.Join(parts, l.op), args
+}
+
+func expandValues(vs []interface{}) []interface{} {
+	if len(vs) != 1 {
+		return vs
+	}
+	v := reflect.ValueOf(vs[0])
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return vs
+	}
+	// []byte is a single value
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		return vs
+	}
+	a := make([]interface{}, v.Len())
+	for i := range a {
+		a[i] = v.Index(i).Interface()
+	}
+	return a
+}
+
+func quoteName(name string) string {
+	if name == "*" || strings.ContainsAny(name, "`( ") {
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		if p != "*" {
+			parts[i] = "`" + p + "`"
+		}
+	}
+	return strings.Join(parts, ".")
+}
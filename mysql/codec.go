@@ -0,0 +1,99 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+// initCodecs collects the codecs of the fields tagged by sqlx.EncryptTag.
+func (c *CacheableDB) initCodecs() error {
+	for col, i := range c.fieldsIndexMap {
+		codec, err := sqlx.FieldCodecOf(c.structType.Field(i))
+		if err != nil {
+			return fmt.Errorf("RegCacheableDB(): table '%s': %s", c.tableName, err.Error())
+		}
+		if codec == nil {
+			continue
+		}
+		for _, pri := range c.priCols {
+			if pri == col {
+				return fmt.Errorf("RegCacheableDB(): table '%s': primary key '%s' must not be encoded", c.tableName, col)
+			}
+		}
+		if c.codecs == nil {
+			c.codecs = make(map[int]sqlx.FieldCodec)
+		}
+		c.codecs[i] = codec
+	}
+	return nil
+}
+
+// fieldValue returns the value of the field to write to the database, encoded if the field has a codec.
+func (c *CacheableDB) fieldValue(structElemValue reflect.Value, i int) (interface{}, error) {
+	fv := structElemValue.Field(i)
+	if codec, ok := c.codecs[i]; ok {
+		return sqlx.EncodeField(codec, fv)
+	}
+	return fv.Interface(), nil
+}
+
+// lookupValue returns the value of the field to look up by, the codec of the field must be deterministic.
+func (c *CacheableDB) lookupValue(structElemValue reflect.Value, i int) (interface{}, error) {
+	if codec, ok := c.codecs[i]; ok && !codec.Deterministic() {
+		return nil, fmt.Errorf("cannot look up by the randomized encoded field '%s' of table '%s'", c.structType.Field(i).Name, c.tableName)
+	}
+	return c.fieldValue(structElemValue, i)
+}
+
+// fieldLookupValue returns the value of the field (db field style) to look up by.
+func (c *CacheableDB) fieldLookupValue(structElemValue reflect.Value, field string) (interface{}, error) {
+	if i, ok := c.fieldsIndexMap[field]; ok {
+		return c.lookupValue(structElemValue, i)
+	}
+	return structElemValue.FieldByName(gutil.CamelString(field)).Interface(), nil
+}
+
+// marshalCache returns the cache data of the struct, with the fields encoded.
+func (c *CacheableDB) marshalCache(structPtr interface{}) ([]byte, error) {
+	if len(c.codecs) == 0 {
+		return json.Marshal(structPtr)
+	}
+	v := reflect.ValueOf(structPtr).Elem()
+	cp := reflect.New(c.structType)
+	cp.Elem().Set(v)
+	for i := range c.codecs {
+		encoded, err := c.fieldValue(v, i)
+		if err != nil {
+			return nil, err
+		}
+		fv := cp.Elem().Field(i)
+		// the field may be of a named string or []byte type
+		fv.Set(reflect.ValueOf(encoded).Convert(fv.Type()))
+	}
+	return json.Marshal(cp.Interface())
+}
+
+// unmarshalCache decodes the cache data into the struct, and decodes the encoded fields.
+func (c *CacheableDB) unmarshalCache(data []byte, structPtr Cacheable) error {
+	if err := json.Unmarshal(data, structPtr); err != nil {
+		return err
+	}
+	v := reflect.ValueOf(structPtr).Elem()
+	for i, codec := range c.codecs {
+		fv := v.Field(i)
+		var encoded []byte
+		if fv.Kind() == reflect.String {
+			encoded = []byte(fv.String())
+		} else {
+			encoded = fv.Bytes()
+		}
+		if err := sqlx.DecodeField(codec, fv, encoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
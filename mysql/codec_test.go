@@ -0,0 +1,100 @@
+package mysql
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/swxctx/xmodel/crypt"
+)
+
+type codecTable struct {
+	Id    int64  `json:"id" key:"pri"`
+	Phone string `json:"phone" encrypt:"aes,deterministic"`
+	Card  string `json:"card" encrypt:"aes"`
+}
+
+func (*codecTable) TableName() string { return "codec_table" }
+
+type (
+	codecPhone string
+	codecCard  []byte
+)
+
+type codecNamedTable struct {
+	Id    int64      `json:"id" key:"pri"`
+	Phone codecPhone `json:"phone" encrypt:"aes,deterministic"`
+	Card  codecCard  `json:"card" encrypt:"aes"`
+}
+
+func (*codecNamedTable) TableName() string { return "codec_named_table" }
+
+func TestCacheCodec(t *testing.T) {
+	crypt.Register(&crypt.StaticKeys{Active: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}})
+	c := &CacheableDB{
+		tableName:      "codec_table",
+		priCols:        []string{"id"},
+		structType:     reflect.TypeOf(codecTable{}),
+		fieldsIndexMap: map[string]int{"id": 0, "phone": 1, "card": 2},
+	}
+	if err := c.initCodecs(); err != nil || len(c.codecs) != 2 {
+		t.Fatalf("initCodecs() = %v, codecs %d", err, len(c.codecs))
+	}
+
+	src := &codecTable{Id: 1, Phone: "13800000000", Card: "110101"}
+	data, err := c.marshalCache(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), src.Phone) || strings.Contains(string(data), src.Card) || src.Phone != "13800000000" {
+		t.Fatalf("marshalCache() = %s, src %+v", data, src)
+	}
+	var dest codecTable
+	if err = c.unmarshalCache(data, &dest); err != nil || dest != *src {
+		t.Fatalf("unmarshalCache() = %+v, %v", dest, err)
+	}
+
+	v := reflect.ValueOf(src).Elem()
+	phone, err := c.lookupValue(v, 1)
+	if err != nil || phone == src.Phone {
+		t.Fatalf("lookupValue(phone) = %v, %v", phone, err)
+	}
+	if !c.checkSecondCache(v, []string{"phone"}, []interface{}{phone}) {
+		t.Fatal("checkSecondCache() by the encrypted phone = false")
+	}
+	if _, err = c.lookupValue(v, 2); err == nil {
+		t.Fatal("lookupValue() of the randomized field returns nil error")
+	}
+}
+
+func TestCacheCodecNamedTypes(t *testing.T) {
+	crypt.Register(&crypt.StaticKeys{Active: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}})
+	c := &CacheableDB{
+		tableName:      "codec_named_table",
+		priCols:        []string{"id"},
+		structType:     reflect.TypeOf(codecNamedTable{}),
+		fieldsIndexMap: map[string]int{"id": 0, "phone": 1, "card": 2},
+	}
+	if err := c.initCodecs(); err != nil || len(c.codecs) != 2 {
+		t.Fatalf("initCodecs() = %v, codecs %d", err, len(c.codecs))
+	}
+
+	src := &codecNamedTable{Id: 1, Phone: "13800000000", Card: codecCard("110101")}
+	data, err := c.marshalCache(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), string(src.Phone)) {
+		t.Fatalf("marshalCache() = %s", data)
+	}
+	var dest codecNamedTable
+	if err = c.unmarshalCache(data, &dest); err != nil || dest.Phone != src.Phone || string(dest.Card) != string(src.Card) {
+		t.Fatalf("unmarshalCache() = %+v, %v", dest, err)
+	}
+
+	// the empty fields are not encoded
+	if _, err = c.marshalCache(&codecNamedTable{Id: 2}); err != nil {
+		t.Fatal(err)
+	}
+}
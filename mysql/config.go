@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/swxctx/xmodel/retry"
 )
 
 // Config db config
@@ -31,6 +32,16 @@ type Config struct {
 	// maximum amount of second a connection may be reused.
 	// If d <= 0, connections are reused forever.
 	ConnMaxLifetime int64 `yaml:"conn_max_lifetime" json:"conn_max_lifetime"`
+	// the maximum number of rows per multi-row statement of batch operations.
+	// The statement is also limited by the max_allowed_packet of the server.
+	// If n <= 0, the default is 1000.
+	MaxBatchRows int `yaml:"max_batch_rows" json:"max_batch_rows"`
+	// the maximum number of cached prepared statements.
+	// The least recently used statement is closed when the cache is full.
+	// If n == 0, the default is 256; if n < 0, the cache is disabled.
+	StmtCacheSize int `yaml:"stmt_cache_size" json:"stmt_cache_size"`
+	// the retry policy of connecting, and the background health checker.
+	Retry retry.Policy `yaml:"retry" json:"retry"`
 
 	// NoCache whether to disable cache
 	NoCache bool `yaml:"no_cache" json:"no_cache"`
@@ -9,11 +9,13 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/swxctx/gutil"
 	"github.com/swxctx/xlog"
 	"github.com/swxctx/xmodel/redis"
+	"github.com/swxctx/xmodel/retry"
 	"github.com/swxctx/xmodel/sqlx"
 	"github.com/swxctx/xmodel/sqlx/reflectx"
 )
@@ -25,6 +27,13 @@ type DB struct {
 	dbConfig     *Config
 	redisConfig  *redis.Config
 	cacheableDBs map[string]*CacheableDB
+	packetOnce   sync.Once
+	packetSize   int
+	stmtOnce     sync.Once
+	stmts        *stmtCache
+	migrationsMu sync.Mutex
+	migrations   map[int64]*Migration
+	health       retry.Health
 }
 
 // Connect to a database and verify with a ping.
@@ -38,24 +47,75 @@ func Connect(dbConfig *Config, redisConfig *redis.Config) (*DB, error) {
 		}
 	}
 
-	// this Pings the database trying to connect, panics on error
-	// use sqlx.Open() for sql.Open() semantics
-	db, err := sqlx.Connect("mysql", dbConfig.Source())
+	db, err := connect(dbConfig)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(dbConfig.MaxOpenConns)
-	db.SetMaxIdleConns(dbConfig.MaxIdleConns)
-	db.SetConnMaxLifetime(time.Duration(dbConfig.ConnMaxLifetime) * time.Second)
-	db.Mapper = reflectx.NewMapperFunc("json", gutil.SnakeString)
-
-	return &DB{
+	d := &DB{
 		DB:           db,
 		dbConfig:     dbConfig,
 		Cache:        cache,
 		redisConfig:  redisConfig,
 		cacheableDBs: make(map[string]*CacheableDB),
-	}, nil
+	}
+	d.startHealthCheck()
+	return d, nil
+}
+
+// connect to a database and verify with a ping, retries by dbConfig.Retry.
+func connect(dbConfig *Config) (*sqlx.DB, error) {
+	var db *sqlx.DB
+	err := retry.Do(context.Background(), &dbConfig.Retry, "mysql", func() (err error) {
+		// this Pings the database trying to connect
+		// use sqlx.Open() for sql.Open() semantics
+		db, err = sqlx.Connect("mysql", dbConfig.Source())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	db.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(dbConfig.ConnMaxLifetime) * time.Second)
+	db.Mapper = reflectx.NewMapperFunc("json", gutil.SnakeString)
+	return db, nil
+}
+
+// startHealthCheck marks the DB healthy, and starts the background health checker if configured.
+func (d *DB) startHealthCheck() {
+	d.health.Set(true)
+	interval := d.dbConfig.Retry.HealthCheckPeriod()
+	d.health.Start("mysql", interval, func() error {
+		// the pool dials a new connection if the old ones are broken
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+		return d.DB.PingContext(ctx)
+	})
+}
+
+// Healthy returns whether the database is connected and passed the last health check.
+func (d *DB) Healthy() bool {
+	return d.health.Healthy()
+}
+
+// WaitReady blocks until the database is healthy or ctx is done.
+// NOTE:
+//  With *PreDB, it waits for the initialization too.
+func (d *DB) WaitReady(ctx context.Context) error {
+	return d.health.WaitReady(ctx)
+}
+
+// Close stops the health checker, closes the cached prepared statements and the database.
+// NOTE:
+//  The redis client d.Cache is not closed.
+func (d *DB) Close() error {
+	d.health.Stop()
+	d.health.Set(false)
+	if d.DB == nil {
+		return nil
+	}
+	d.PurgeStmtCache()
+	return d.DB.Close()
 }
 
 // Cacheable the interface that can use cache.
@@ -73,9 +133,27 @@ type CacheableDB struct {
 	priCols           []string
 	cacheExpiration   time.Duration
 	typeName          string
+	structType        reflect.Type
 	priFieldsIndex    []int          // primary column index in struct
 	fieldsIndexMap    map[string]int // key:colName, value:field index in struct
 	module            *redis.Module
+	queries           *cacheableQueries
+	roles             ColumnRoles
+	pendingRoles      *ColumnRoles            // set before *PreDB initialized
+	withDeleted       bool                    // include the soft deleted rows
+	codecs            map[int]sqlx.FieldCodec // key: field index, value: the codec of the field tagged by sqlx.EncryptTag
+	audit             AuditSink               // records the writes if not nil
+	bloomOpts         *bloomOptions           // set by EnableBloomFilter, kept for *PreDB initialization
+	bloom             *redis.BloomFilter      // the primary keys filter if not nil
+}
+
+// cacheableQueries the query strings precomputed at registration.
+type cacheableQueries struct {
+	selectAll   string   // 'SELECT ... FROM ...' without WHERE
+	getByPri    string   // select one row by primary key
+	insert      string   // named 'INSERT' with all columns except 'deleted_ts', without terminator
+	insertNoPri string   // same as insert, but without the primary keys
+	getByFields sync.Map // key: joined fields, value: select one row by the fields
 }
 
 // ErrCacheNil error: *DB.Cache (redis) is nil
@@ -83,7 +161,12 @@ var ErrCacheNil = errors.New("*DB.Cache (redis) is nil")
 
 // RegCacheableDB registers a cacheable table.
 func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duration) (*CacheableDB, error) {
-	tableName := ormStructPtr.TableName()
+	return d.RegCacheableType(ormStructPtr.TableName(), reflect.TypeOf(ormStructPtr), cacheExpiration)
+}
+
+// RegCacheableType registers a cacheable table of the *struct type, which may be built at runtime
+// without the TableName method, e.g. by reflect.StructOf.
+func (d *DB) RegCacheableType(tableName string, structPtrType reflect.Type, cacheExpiration time.Duration) (*CacheableDB, error) {
 	if _, ok := d.cacheableDBs[tableName]; ok {
 		return nil, fmt.Errorf("re-register cacheable table: %s", tableName)
 	}
@@ -102,10 +185,15 @@ func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duratio
 	// if err != nil {
 	//	return nil, fmt.Errorf("RegCacheableDB(): %s", err.Error())
 	// }
-	v := reflect.ValueOf(ormStructPtr).Elem()
-	for i := 0; i < v.NumField(); i++ {
-		columnName := v.Type().Field(i).Tag.Get("json")
-		columnKey := v.Type().Field(i).Tag.Get("key")
+	t := structPtrType
+	var typeName = t.String()
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("ormStructPtr must be *struct type: %s", typeName)
+	}
+	t = t.Elem()
+	for i := 0; i < t.NumField(); i++ {
+		columnName := t.Field(i).Tag.Get("json")
+		columnKey := t.Field(i).Tag.Get("key")
 		colsResult = append(colsResult, &Col{
 			ColumnName: columnName,
 			ColumnKey:  columnKey,
@@ -127,15 +215,6 @@ func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duratio
 	}
 	sort.Strings(priCols)
 
-	t := reflect.TypeOf(ormStructPtr)
-	var typeName = t.String()
-	if t.Kind() != reflect.Ptr {
-		return nil, fmt.Errorf("ormStructPtr must be *struct type: %s", typeName)
-	}
-	t = t.Elem()
-	if t.Kind() != reflect.Struct {
-		return nil, fmt.Errorf("ormStructPtr must be *struct type: %s", typeName)
-	}
 	structMap := d.Mapper.TypeMap(t)
 	var fieldsIndexMap = make(map[string]int, len(structMap.Index))
 	for i, idx := range structMap.Index {
@@ -162,14 +241,30 @@ func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duratio
 		priCols:           priCols,
 		cacheExpiration:   cacheExpiration,
 		typeName:          typeName,
+		structType:        t,
 		priFieldsIndex:    priFieldsIndex,
 		fieldsIndexMap:    fieldsIndexMap,
 		module:            module,
 	}
+	if err := c.initCodecs(); err != nil {
+		return nil, err
+	}
+	c.roles = c.defaultColumnRoles()
+	c.initQueries()
 	d.cacheableDBs[tableName] = c
 	return c, nil
 }
 
+// initQueries precomputes the query strings.
+func (c *CacheableDB) initQueries() {
+	c.queries = &cacheableQueries{
+		selectAll:   c.selectSQL(),
+		getByPri:    c.createGetQuery(c.priCols),
+		insert:      c.createInsertSQL(false),
+		insertNoPri: c.createInsertSQL(true),
+	}
+}
+
 // GetCacheableDB returns the specified *CacheableDB
 func (d *DB) GetCacheableDB(tableName string) (*CacheableDB, error) {
 	c, ok := d.cacheableDBs[tableName]
@@ -233,8 +328,11 @@ func (c *CacheableDB) CreateCacheKey(structPtr Cacheable, fields ...string) (Cac
 	} else {
 		for i, field := range fields {
 			fields[i] = gutil.SnakeString(field)
-			vv := v.FieldByName(gutil.CamelString(field))
-			values = append(values, vv.Interface())
+			value, err := c.fieldLookupValue(v, fields[i])
+			if err != nil {
+				return emptyCacheKey, emptyValue, errors.New("CreateCacheKey(): " + err.Error())
+			}
+			values = append(values, value)
 		}
 		var err error
 		cacheKey, err = c.CreateCacheKeyByFields(fields, values)
@@ -268,11 +366,28 @@ func (c *CacheableDB) createPrikey(structElemValue reflect.Value) (string, error
 
 // CreateGetQuery creates query string of selecting one row data.
 // NOTE:
-//  If whereFields is empty, auto-use primary fields.
+//  If whereFields is empty, auto-use primary fields;
+//  The query strings are computed only once.
 func (c *CacheableDB) CreateGetQuery(whereFields ...string) string {
+	if c.queries == nil {
+		if len(whereFields) == 0 {
+			whereFields = c.priCols
+		}
+		return c.createGetQuery(whereFields)
+	}
 	if len(whereFields) == 0 {
-		whereFields = c.priCols
+		return c.queries.getByPri
 	}
+	key := strings.Join(whereFields, ",")
+	if query, ok := c.queries.getByFields.Load(key); ok {
+		return query.(string)
+	}
+	query := c.createGetQuery(whereFields)
+	c.queries.getByFields.Store(key, query)
+	return query
+}
+
+func (c *CacheableDB) createGetQuery(whereFields []string) string {
 	var queryAll = "SELECT"
 	if len(c.cols) > 0 {
 		for _, col := range c.cols {
@@ -295,8 +410,17 @@ func (c *CacheableDB) CreateGetQuery(whereFields ...string) string {
 // NOTE:
 //  If the cache does not exist, then write the cache;
 //  destStructPtr must be a *struct type;
-//  If fields is empty, auto-use primary fields.
+//  If fields is empty, auto-use primary fields;
+//  Returns sql.ErrNoRows if the row is soft deleted, unless WithDeleted() is used.
 func (c *CacheableDB) CacheGet(destStructPtr Cacheable, fields ...string) error {
+	err := c.cacheGet(destStructPtr, fields...)
+	if err == nil {
+		err = c.filterDeleted(reflect.ValueOf(destStructPtr).Elem(), err)
+	}
+	return err
+}
+
+func (c *CacheableDB) cacheGet(destStructPtr Cacheable, fields ...string) error {
 	var cacheKey, structElemValue, err = c.CreateCacheKey(destStructPtr, fields...)
 	if err != nil {
 		return err
@@ -304,7 +428,11 @@ func (c *CacheableDB) CacheGet(destStructPtr Cacheable, fields ...string) error
 
 	if c.DB.dbConfig.NoCache {
 		// read db
-		return c.DB.Get(destStructPtr, c.CreateGetQuery(fields...), cacheKey.FieldValues...)
+		return c.DB.stmtGet(context.Background(), destStructPtr, c.CreateGetQuery(fields...), cacheKey.FieldValues...)
+	}
+
+	if cacheKey.isPriKey && !c.bloomExists(cacheKey.Key) {
+		return ErrNoRows
 	}
 
 	var (
@@ -346,7 +474,9 @@ func (c *CacheableDB) CacheGet(destStructPtr Cacheable, fields ...string) error
 	}
 
 	// to lock or get first cache
-	c.Cache.LockCallback("lock_"+key, func() {
+	var locked bool
+	lockErr := c.Cache.LockDo(context.Background(), "lock_"+key, func(context.Context) error {
+		locked = true
 		var b []byte
 		if !exist {
 		FIRST:
@@ -354,10 +484,10 @@ func (c *CacheableDB) CacheGet(destStructPtr Cacheable, fields ...string) error
 				exist, err = c.getFirstCache(key, destStructPtr)
 				if exist {
 					err = nil
-					return
+					return nil
 				}
 				if err != nil {
-					return
+					return nil
 				}
 			} else {
 				b, err = c.Cache.Get(key).Bytes()
@@ -366,25 +496,25 @@ func (c *CacheableDB) CacheGet(destStructPtr Cacheable, fields ...string) error
 					gettedFirstCacheKey = true
 					goto FIRST
 				} else if !redis.IsRedisNil(err) {
-					return
+					return nil
 				}
 			}
 		}
 
 		// read db
-		err = c.DB.Get(destStructPtr, c.CreateGetQuery(fields...), cacheKey.FieldValues...)
+		err = c.DB.stmtGet(context.Background(), destStructPtr, c.CreateGetQuery(fields...), cacheKey.FieldValues...)
 		if err != nil {
-			return
+			return nil
 		}
 		key, err = c.createPrikey(structElemValue)
 		if err != nil {
 			xlog.Errorf("CacheGet(): createPrikey: %s", err.Error())
 			err = nil
-			return
+			return nil
 		}
 
 		// write cache
-		data, _ := json.Marshal(destStructPtr)
+		data, _ := c.marshalCache(destStructPtr)
 		err = c.Cache.Set(key, data, c.cacheExpiration).Err()
 		if err == nil && !cacheKey.isPriKey {
 			err = c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
@@ -393,7 +523,14 @@ func (c *CacheableDB) CacheGet(destStructPtr Cacheable, fields ...string) error
 			xlog.Errorf("CacheGet(): %s", err.Error())
 			err = nil
 		}
-	})
+		return nil
+	}, nil)
+	if !locked {
+		return lockErr
+	}
+	if lockErr != nil {
+		xlog.Warnf("CacheGet(): unlock: %s", lockErr.Error())
+	}
 
 	return err
 }
@@ -427,8 +564,12 @@ func (c *CacheableDB) createGetQueryByWhere(whereCond string) string {
 // NOTE:
 //  If the cache does not exist, then write the cache;
 //  destStructPtr must be a *struct type;
-//  whereNamedCond e.g. 'id=:id AND created_at>1520000000'.
+//  whereNamedCond e.g. 'id=:id AND created_at>1520000000';
+//  Automatic filter the soft deleted rows, unless WithDeleted() is used.
 func (c *CacheableDB) CacheGetByWhere(destStructPtr Cacheable, whereNamedCond string) error {
+	if !c.withDeleted {
+		whereNamedCond = insertZeroDeletedTs(whereNamedCond, c.roles.DeletedTs)
+	}
 	cacheKey, whereCond, err := c.createCacheKeyByWhere(destStructPtr, whereNamedCond)
 	if err != nil {
 		return err
@@ -437,7 +578,7 @@ func (c *CacheableDB) CacheGetByWhere(destStructPtr Cacheable, whereNamedCond st
 
 	if c.DB.dbConfig.NoCache {
 		// read db
-		return c.DB.Get(destStructPtr, c.createGetQueryByWhere(whereCond), cacheKey.FieldValues...)
+		return c.DB.stmtGet(context.Background(), destStructPtr, c.createGetQueryByWhere(whereCond), cacheKey.FieldValues...)
 	}
 
 	var (
@@ -477,16 +618,18 @@ func (c *CacheableDB) CacheGetByWhere(destStructPtr Cacheable, whereNamedCond st
 	}
 
 	// to lock or get first cache
-	c.Cache.LockCallback("lock_"+key, func() {
+	var locked bool
+	lockErr := c.Cache.LockDo(context.Background(), "lock_"+key, func(context.Context) error {
+		locked = true
 	FIRST:
 		if gettedFirstCacheKey {
 			exist, err = c.getFirstCache(key, destStructPtr)
 			if exist {
 				err = nil
-				return
+				return nil
 			}
 			if err != nil {
-				return
+				return nil
 			}
 		} else {
 			b, err = c.Cache.Get(key).Bytes()
@@ -495,24 +638,24 @@ func (c *CacheableDB) CacheGetByWhere(destStructPtr Cacheable, whereNamedCond st
 				gettedFirstCacheKey = true
 				goto FIRST
 			} else if !redis.IsRedisNil(err) {
-				return
+				return nil
 			}
 		}
 
 		// read db
-		err = c.DB.Get(destStructPtr, c.createGetQueryByWhere(whereCond), cacheKey.FieldValues...)
+		err = c.DB.stmtGet(context.Background(), destStructPtr, c.createGetQueryByWhere(whereCond), cacheKey.FieldValues...)
 		if err != nil {
-			return
+			return nil
 		}
 		key, err = c.createPrikey(structElemValue)
 		if err != nil {
 			xlog.Errorf("CacheGetByWhere(): createPrikey: %s", err.Error())
 			err = nil
-			return
+			return nil
 		}
 
 		// write cache
-		data, _ := json.Marshal(destStructPtr)
+		data, _ := c.marshalCache(destStructPtr)
 		err = c.Cache.Set(key, data, c.cacheExpiration).Err()
 		if err == nil && !cacheKey.isPriKey {
 			err = c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
@@ -521,7 +664,14 @@ func (c *CacheableDB) CacheGetByWhere(destStructPtr Cacheable, whereNamedCond st
 			xlog.Errorf("CacheGetByWhere(): %s", err.Error())
 			err = nil
 		}
-	})
+		return nil
+	}, nil)
+	if !locked {
+		return lockErr
+	}
+	if lockErr != nil {
+		xlog.Warnf("CacheGetByWhere(): unlock: %s", lockErr.Error())
+	}
 
 	return err
 }
@@ -535,6 +685,13 @@ func (c *CacheableDB) cleanDestCacheable(destStructElemValue reflect.Value) {
 
 func (c *CacheableDB) checkSecondCache(destStructElemValue reflect.Value, fields []string, values []interface{}) bool {
 	for i, field := range fields {
+		if idx, ok := c.fieldsIndexMap[field]; ok && c.codecs[idx] != nil {
+			value, err := c.lookupValue(destStructElemValue, idx)
+			if err != nil || !reflect.DeepEqual(value, values[i]) {
+				return false
+			}
+			continue
+		}
 		vv := destStructElemValue.FieldByName(gutil.CamelString(field))
 		if vv.Kind() == reflect.Ptr {
 			vv = vv.Elem()
@@ -556,7 +713,7 @@ func (c *CacheableDB) checkSecondCache(destStructElemValue reflect.Value, fields
 func (c *CacheableDB) getFirstCache(key string, destStructPtr Cacheable) (bool, error) {
 	data, err := c.Cache.Get(key).Bytes()
 	if err == nil {
-		err = json.Unmarshal(data, destStructPtr)
+		err = c.unmarshalCache(data, destStructPtr)
 		if err == nil {
 			return true, nil
 		}
@@ -580,7 +737,7 @@ func (c *CacheableDB) PutCache(srcStructPtr Cacheable, fields ...string) error {
 	if err != nil {
 		return err
 	}
-	data, err := json.Marshal(srcStructPtr)
+	data, err := c.marshalCache(srcStructPtr)
 	if err != nil {
 		return err
 	}
@@ -640,29 +797,57 @@ func (d *DB) Callback(fn func(sqlx.DbOrTx) error, tx ...*sqlx.Tx) error {
 
 // TransactCallback transactional operations.
 // nOTE: if an error is returned, the rollback method should be invoked outside the function.
+// If tx is not specified, the error of the commit is returned.
 func (d *DB) TransactCallback(fn func(*sqlx.Tx) error, tx ...*sqlx.Tx) (err error) {
 	if fn == nil {
 		return
 	}
-	var _tx *sqlx.Tx
-	if len(tx) > 0 {
-		_tx = tx[0]
+	if len(tx) > 0 && tx[0] != nil {
+		return fn(tx[0])
 	}
-	if _tx == nil {
-		_tx, err = d.Beginx()
+	return d.transact(context.Background(), fn)
+}
+
+// transact calls fn in a new transaction of ctx, commits it if fn returns nil and ctx is not done,
+// otherwise rolls it back.
+func (d *DB) transact(ctx context.Context, fn func(*sqlx.Tx) error) (err error) {
+	tx, err := d.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			err = ctx.Err()
+		}
 		if err != nil {
-			return err
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
 		}
-		defer func() {
-			if err != nil {
-				_tx.Rollback()
-			} else {
-				_tx.Commit()
-			}
-		}()
-	}
-	err = fn(_tx)
-	return err
+	}()
+	return fn(tx)
+}
+
+// IdempotentTransact calls fn in a new transaction once for the idempotency key,
+// and returns the stored response to the duplicate requests, see *redis.Client.Idempotent.
+// NOTE:
+//  The response is stored only after the transaction is committed;
+//  If fn returns an error or the commit fails, the transaction is rolled back and the claim of the key is released;
+//  If the claim is lost while fn runs, e.g. the key is deleted by others, ctx of fn is canceled and the transaction is rolled back;
+//  replayed is true if the response is the stored one;
+//  opts may be nil for the defaults.
+func (d *DB) IdempotentTransact(ctx context.Context, key string, fn func(context.Context, *sqlx.Tx) ([]byte, error), opts *redis.IdempotencyOptions) (response []byte, replayed bool, err error) {
+	if d.Cache == nil {
+		return nil, false, ErrCacheNil
+	}
+	return d.Cache.Idempotent(ctx, key, func(ctx context.Context) (response []byte, err error) {
+		// ctx is canceled if the claim is lost, which rolls back the transaction
+		err = d.transact(ctx, func(tx *sqlx.Tx) (err error) {
+			response, err = fn(ctx, tx)
+			return err
+		})
+		return response, err
+	}, opts)
 }
 
 // CallbackInSession non-transactional operations in one session.
@@ -705,7 +890,7 @@ func (d *DB) TransactCallbackInSession(fn func(context.Context, *sqlx.Tx) error,
 		if err != nil {
 			_tx.Rollback()
 		} else {
-			_tx.Commit()
+			err = _tx.Commit()
 		}
 	}()
 	err = fn(_ctx, _tx)
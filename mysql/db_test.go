@@ -1,10 +1,14 @@
 package mysql_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/swxctx/gutil"
 	"github.com/swxctx/xmodel/mysql"
 	"github.com/swxctx/xmodel/redis"
@@ -106,3 +110,72 @@ func TestCacheDb(t *testing.T) {
 	}
 	t.Logf("expired cache error: %v", err)
 }
+
+func TestIdempotentTransact(t *testing.T) {
+	dbConf := mysql.NewConfig()
+	dbConf.Database = "test"
+	m := miniredis.RunT(t)
+	redisConf := &redis.Config{DeployType: redis.TypeSingle, ForSingle: redis.SingleConfig{Addr: m.Addr()}}
+	db, err := mysql.Connect(dbConf, redisConf)
+	if err != nil {
+		t.Skipf("mysql is unreachable: %v", err)
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS `dbtest` (`test_id` INT(10) AUTO_INCREMENT, `test_content` VARCHAR(20), `test_deleted` TINYINT(2),  PRIMARY KEY(`test_id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='测试表'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "test:idempotency:" + time.Now().Format("150405.000000")
+	defer db.Cache.Del(key)
+	insert := func(ctx context.Context, tx *sqlx.Tx) ([]byte, error) {
+		r, err := tx.Exec("INSERT INTO dbtest (test_content,test_deleted)VALUES(?,0)", key)
+		if err != nil {
+			return nil, err
+		}
+		id, err := r.LastInsertId()
+		return []byte(strconv.FormatInt(id, 10)), err
+	}
+
+	// the failed transaction is rolled back and the key is released
+	failure := errors.New("failure")
+	_, _, err = db.IdempotentTransact(context.Background(), key, func(ctx context.Context, tx *sqlx.Tx) ([]byte, error) {
+		if _, err := insert(ctx, tx); err != nil {
+			return nil, err
+		}
+		return nil, failure
+	}, nil)
+	if err != failure {
+		t.Fatalf("IdempotentTransact() = %v", err)
+	}
+
+	first, replayed, err := db.IdempotentTransact(context.Background(), key, insert, nil)
+	if err != nil || replayed {
+		t.Fatalf("IdempotentTransact() = %s, %v, %v", first, replayed, err)
+	}
+	second, replayed, err := db.IdempotentTransact(context.Background(), key, insert, nil)
+	if err != nil || !replayed || string(second) != string(first) {
+		t.Fatalf("IdempotentTransact() of a duplicate = %s, %v, %v", second, replayed, err)
+	}
+	var n int
+	if err = db.Get(&n, "SELECT COUNT(*) FROM dbtest WHERE test_content=?", key); err != nil || n != 1 {
+		t.Fatalf("%d rows inserted, %v", n, err)
+	}
+
+	// the transaction is rolled back if the claim is lost
+	lostKey := key + ":lost"
+	defer db.Cache.Del(lostKey)
+	_, _, err = db.IdempotentTransact(context.Background(), lostKey, func(ctx context.Context, tx *sqlx.Tx) ([]byte, error) {
+		if _, err := tx.Exec("INSERT INTO dbtest (test_content,test_deleted)VALUES(?,0)", lostKey); err != nil {
+			return nil, err
+		}
+		db.Cache.Del(lostKey)
+		// the watchdog cancels ctx at the next refresh
+		<-ctx.Done()
+		return []byte("lost"), nil
+	}, &redis.IdempotencyOptions{ClaimTTL: 300 * time.Millisecond})
+	if err == nil {
+		t.Fatal("IdempotentTransact() after the claim is lost returns nil error")
+	}
+	if err = db.Get(&n, "SELECT COUNT(*) FROM dbtest WHERE test_content=?", lostKey); err != nil || n != 0 {
+		t.Fatalf("%d rows committed after the claim is lost, %v", n, err)
+	}
+}
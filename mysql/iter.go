@@ -0,0 +1,181 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Iter is a generic streaming iterator over the rows of a cacheable table.
+// It reads the rows in batches ordered by primary key (keyset pagination),
+// so that no long-running query holds the table.
+// NOTE:
+//  T must be the registered *struct type, e.g. mysql.NewIter[*User](...).
+type Iter[T Cacheable] struct {
+	it *batchIter
+}
+
+// NewIter creates an iterator over the rows matching whereCond.
+// NOTE:
+//  Without cache layer;
+//  whereCond must be a pure condition without ORDER BY, LIMIT, etc.
+//  e.g. 'age>? AND status=?', empty means all rows;
+//  Each batch has Config.MaxBatchRows rows by default.
+func NewIter[T Cacheable](ctx context.Context, c *CacheableDB, whereCond string, args ...interface{}) *Iter[T] {
+	it := c.newBatchIter(ctx, whereCond, args)
+	var zero T
+	if t := reflect.TypeOf(&zero).Elem(); t.String() != c.typeName {
+		it.err = fmt.Errorf("NewIter(): unmatch Cacheable: want %s, have %s", c.typeName, t.String())
+	}
+	return &Iter[T]{it: it}
+}
+
+// BatchSize sets the number of rows per batch query.
+func (it *Iter[T]) BatchSize(n int) *Iter[T] {
+	if n > 0 {
+		it.it.batchSize = n
+	}
+	return it
+}
+
+// Next moves to the next row, returns false when there are no more rows or an error occurs.
+func (it *Iter[T]) Next() bool {
+	return it.it.next()
+}
+
+// Value returns the current row.
+func (it *Iter[T]) Value() T {
+	return it.it.value().(T)
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iter[T]) Err() error {
+	return it.it.err
+}
+
+// Close stops the iteration and releases the current batch.
+func (it *Iter[T]) Close() error {
+	it.it.close()
+	return nil
+}
+
+// Each streams the rows matching whereCond into fn one by one, in batches by primary key.
+// NOTE:
+//  Without cache layer;
+//  The argument of fn is a new *struct of the registered type;
+//  whereCond must be a pure condition without ORDER BY, LIMIT, etc. empty means all rows;
+//  Stops and returns the error if fn returns an error or ctx is done.
+func (c *CacheableDB) Each(ctx context.Context, fn func(Cacheable) error, whereCond string, args ...interface{}) error {
+	it := c.newBatchIter(ctx, whereCond, args)
+	defer it.close()
+	for it.next() {
+		if err := fn(it.value().(Cacheable)); err != nil {
+			return err
+		}
+	}
+	return it.err
+}
+
+type batchIter struct {
+	ctx       context.Context
+	c         *CacheableDB
+	query     string
+	args      []interface{}
+	batchSize int
+	batch     reflect.Value // []*struct
+	pos       int
+	lastPri   []interface{}
+	done      bool
+	err       error
+}
+
+func (c *CacheableDB) newBatchIter(ctx context.Context, whereCond string, args []interface{}) *batchIter {
+	return c.newColsBatchIter(ctx, c.cols, whereCond, args)
+}
+
+// newColsBatchIter creates a batch iterator that selects only cols, which must include the primary keys.
+func (c *CacheableDB) newColsBatchIter(ctx context.Context, cols []string, whereCond string, args []interface{}) *batchIter {
+	whereCond = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(whereCond), ";"))
+	if whereCond == "" {
+		whereCond = "1=1"
+	}
+	return &batchIter{
+		ctx:       ctx,
+		c:         c,
+		query:     "SELECT `" + strings.Join(cols, "`,`") + "` FROM `" + c.tableName + "` WHERE (" + whereCond + ")",
+		args:      args,
+		batchSize: c.DB.maxBatchRows(),
+		pos:       -1,
+	}
+}
+
+func (it *batchIter) next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.batch.IsValid() && it.pos+1 < it.batch.Len() {
+		it.pos++
+		return true
+	}
+	if it.done {
+		return false
+	}
+	if it.err = it.ctx.Err(); it.err != nil {
+		return false
+	}
+	if it.err = it.fetch(); it.err != nil {
+		return false
+	}
+	if it.batch.Len() == 0 {
+		it.done = true
+		return false
+	}
+	it.pos = 0
+	return true
+}
+
+// fetch reads the next batch after the last primary key.
+func (it *batchIter) fetch() error {
+	var (
+		c      = it.c
+		query  = it.query
+		args   = it.args
+		priSQL = "`" + strings.Join(c.priCols, "`,`") + "`"
+	)
+	if it.lastPri != nil {
+		query += " AND (" + priSQL + ")>(" + strings.Repeat("?,", len(c.priCols)-1) + "?)"
+		args = append(append(make([]interface{}, 0, len(args)+len(it.lastPri)), args...), it.lastPri...)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %d;", priSQL, it.batchSize)
+
+	batch := reflect.New(reflect.SliceOf(reflect.PtrTo(c.structType)))
+	if err := c.DB.SelectContext(it.ctx, batch.Interface(), query, args...); err != nil {
+		return err
+	}
+	it.batch = batch.Elem()
+	if n := it.batch.Len(); n > 0 {
+		last := it.batch.Index(n - 1).Elem()
+		it.lastPri = make([]interface{}, len(c.priFieldsIndex))
+		for i, idx := range c.priFieldsIndex {
+			it.lastPri[i] = last.Field(idx).Interface()
+		}
+	}
+	if it.batch.Len() < it.batchSize {
+		it.done = true
+	}
+	return nil
+}
+
+func (it *batchIter) value() interface{} {
+	if !it.batch.IsValid() || it.pos < 0 {
+		return nil
+	}
+	return it.batch.Index(it.pos).Interface()
+}
+
+func (it *batchIter) close() {
+	it.done = true
+	it.batch = reflect.Value{}
+	it.pos = -1
+}
@@ -0,0 +1,502 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+const (
+	// MigrationTable the table recording the applied migrations
+	MigrationTable = "schema_migrations"
+	// the seconds to wait for the migration lock
+	migrateLockTimeout = 60
+)
+
+// Migration a versioned schema change, loaded from the numbered .sql files or defined by Go functions.
+// NOTE:
+//  Up/Down may contain multiple statements, and 'DELIMITER' lines for routines;
+//  UpFunc/DownFunc are used if Up/Down are empty, and run in a transaction;
+//  MySQL DDL statements are not transactional, a failed migration may be partially applied.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	UpFunc   func(context.Context, *sqlx.Tx) error
+	DownFunc func(context.Context, *sqlx.Tx) error
+}
+
+// Checksum returns the sha256 of the Up SQL, empty if it is a Go function migration.
+func (m *Migration) Checksum() string {
+	if m.Up == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationStatus the status of a migration.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt int64
+	// Modified the Up SQL has been changed since it was applied
+	Modified bool
+	// Missing the migration was applied but is not found in the registered migrations
+	Missing bool
+}
+
+type appliedMigration struct {
+	Version   int64  `json:"version"`
+	Name      string `json:"name"`
+	Checksum  string `json:"checksum"`
+	AppliedAt int64  `json:"applied_at"`
+}
+
+// ReadMigrations reads the migrations from the directory of fsys.
+// NOTE:
+//  File name format: '<version>_<name>.up.sql' and '<version>_<name>.down.sql',
+//  e.g. '0001_create_user.up.sql'; the down file is optional;
+//  Other files are ignored.
+func ReadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var byVersion = make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		var (
+			fileName = entry.Name()
+			isUp     bool
+			base     string
+		)
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			isUp, base = true, strings.TrimSuffix(fileName, ".up.sql")
+		case strings.HasSuffix(fileName, ".down.sql"):
+			base = strings.TrimSuffix(fileName, ".down.sql")
+		default:
+			continue
+		}
+		versionStr, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("ReadMigrations(): invalid migration version: %s", fileName)
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("ReadMigrations(): duplicate migration version %d: %s, %s", version, m.Name, name)
+		}
+		if isUp {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+	var migrations = make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("ReadMigrations(): migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// LoadMigrations reads the migrations from dir and registers them.
+func (d *DB) LoadMigrations(dir string) error {
+	migrations, err := ReadMigrations(os.DirFS(dir), ".")
+	if err != nil {
+		return err
+	}
+	return d.AddMigrations(migrations...)
+}
+
+// AddMigrations registers the migrations.
+func (d *DB) AddMigrations(migrations ...*Migration) error {
+	d.migrationsMu.Lock()
+	defer d.migrationsMu.Unlock()
+	if d.migrations == nil {
+		d.migrations = make(map[int64]*Migration, len(migrations))
+	}
+	for _, m := range migrations {
+		if m.Version <= 0 {
+			return fmt.Errorf("AddMigrations(): invalid migration version: %d", m.Version)
+		}
+		if m.Up == "" && m.UpFunc == nil {
+			return fmt.Errorf("AddMigrations(): migration %d has no up", m.Version)
+		}
+		if _, ok := d.migrations[m.Version]; ok {
+			return fmt.Errorf("AddMigrations(): re-register migration: %d", m.Version)
+		}
+		d.migrations[m.Version] = m
+	}
+	return nil
+}
+
+// sortedMigrations returns the registered migrations in version order.
+func (d *DB) sortedMigrations() []*Migration {
+	d.migrationsMu.Lock()
+	defer d.migrationsMu.Unlock()
+	var migrations = make([]*Migration, 0, len(d.migrations))
+	for _, m := range d.migrations {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+// Migrate applies all the pending migrations in version order, returns the applied ones.
+// NOTE:
+//  Holds the 'GET_LOCK' advisory lock, so concurrent processes do not race;
+//  Fails before applying anything if the Up SQL of an applied migration is modified;
+//  If dryRun is true, only logs and returns the pending migrations.
+func (d *DB) Migrate(ctx context.Context, dryRun bool) ([]*Migration, error) {
+	var done []*Migration
+	err := d.migrateCallback(ctx, dryRun, func(conn *sqlx.Conn, applied map[int64]*appliedMigration) error {
+		migrations := d.sortedMigrations()
+		for _, m := range migrations {
+			a, ok := applied[m.Version]
+			if ok && a.Checksum != "" && a.Checksum != m.Checksum() {
+				return fmt.Errorf("Migrate(): checksum mismatch of the applied migration %d_%s", m.Version, m.Name)
+			}
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if dryRun {
+				logMigration("up", m, m.Up)
+			} else {
+				err := runMigration(ctx, conn, m.Up, m.UpFunc, func(tx sqlx.ExecerContext) error {
+					_, err := tx.ExecContext(ctx, "INSERT INTO `"+MigrationTable+"` (`version`,`name`,`checksum`,`applied_at`)VALUES(?,?,?,?);",
+						m.Version, m.Name, m.Checksum(), time.Now().Unix())
+					return err
+				})
+				if err != nil {
+					return fmt.Errorf("Migrate(): %d_%s: %s", m.Version, m.Name, err.Error())
+				}
+				xlog.Infof("Migrate(): applied %d_%s", m.Version, m.Name)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Rollback reverts the last n applied migrations in reverse version order, returns the reverted ones.
+// NOTE:
+//  Holds the 'GET_LOCK' advisory lock, so concurrent processes do not race;
+//  Fails before reverting anything if one of them is not registered or has no down;
+//  If dryRun is true, only logs and returns the migrations to revert.
+func (d *DB) Rollback(ctx context.Context, n int, dryRun bool) ([]*Migration, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	var done []*Migration
+	err := d.migrateCallback(ctx, dryRun, func(conn *sqlx.Conn, applied map[int64]*appliedMigration) error {
+		var versions = make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+		if n < len(versions) {
+			versions = versions[:n]
+		}
+		d.migrationsMu.Lock()
+		var todo = make([]*Migration, 0, len(versions))
+		for _, version := range versions {
+			m, ok := d.migrations[version]
+			if !ok {
+				d.migrationsMu.Unlock()
+				return fmt.Errorf("Rollback(): applied migration %d is not registered", version)
+			}
+			if m.Down == "" && m.DownFunc == nil {
+				d.migrationsMu.Unlock()
+				return fmt.Errorf("Rollback(): migration %d_%s has no down", m.Version, m.Name)
+			}
+			todo = append(todo, m)
+		}
+		d.migrationsMu.Unlock()
+		for _, m := range todo {
+			if dryRun {
+				logMigration("down", m, m.Down)
+			} else {
+				err := runMigration(ctx, conn, m.Down, m.DownFunc, func(tx sqlx.ExecerContext) error {
+					_, err := tx.ExecContext(ctx, "DELETE FROM `"+MigrationTable+"` WHERE `version`=?;", m.Version)
+					return err
+				})
+				if err != nil {
+					return fmt.Errorf("Rollback(): %d_%s: %s", m.Version, m.Name, err.Error())
+				}
+				xlog.Infof("Rollback(): reverted %d_%s", m.Version, m.Name)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status returns the status of the registered and applied migrations in version order.
+func (d *DB) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var list []*MigrationStatus
+	err := d.CallbackInSession(func(ctx context.Context, conn *sqlx.Conn) error {
+		applied, err := loadAppliedMigrations(ctx, conn, false)
+		if err != nil {
+			return err
+		}
+		for _, m := range d.sortedMigrations() {
+			s := &MigrationStatus{Version: m.Version, Name: m.Name}
+			if a, ok := applied[m.Version]; ok {
+				s.Applied = true
+				s.AppliedAt = a.AppliedAt
+				s.Modified = a.Checksum != "" && a.Checksum != m.Checksum()
+				delete(applied, m.Version)
+			}
+			list = append(list, s)
+		}
+		for _, a := range applied {
+			list = append(list, &MigrationStatus{
+				Version:   a.Version,
+				Name:      a.Name,
+				Applied:   true,
+				AppliedAt: a.AppliedAt,
+				Missing:   true,
+			})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Version < list[j].Version
+		})
+		return nil
+	}, ctx)
+	return list, err
+}
+
+// migrateCallback calls fn in a session holding the migration lock.
+func (d *DB) migrateCallback(ctx context.Context, dryRun bool, fn func(*sqlx.Conn, map[int64]*appliedMigration) error) error {
+	return d.CallbackInSession(func(ctx context.Context, conn *sqlx.Conn) error {
+		lockName := "xmodel_migrate:" + d.dbConfig.Database
+		var locked sql.NullInt64
+		err := conn.GetContext(ctx, &locked, "SELECT GET_LOCK(?,?);", lockName, migrateLockTimeout)
+		if err != nil {
+			return err
+		}
+		if locked.Int64 != 1 {
+			return fmt.Errorf("migration lock '%s' is held by another session", lockName)
+		}
+		defer func() {
+			// the ctx may be done
+			if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?);", lockName); err != nil {
+				xlog.Errorf("migrateCallback(): release lock: %s", err.Error())
+			}
+		}()
+		applied, err := loadAppliedMigrations(ctx, conn, !dryRun)
+		if err != nil {
+			return err
+		}
+		return fn(conn, applied)
+	}, ctx)
+}
+
+func loadAppliedMigrations(ctx context.Context, conn *sqlx.Conn, create bool) (map[int64]*appliedMigration, error) {
+	if create {
+		_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `"+MigrationTable+"` ("+
+			"`version` bigint(20) NOT NULL,"+
+			"`name` varchar(255) NOT NULL DEFAULT '',"+
+			"`checksum` char(64) NOT NULL DEFAULT '',"+
+			"`applied_at` bigint(20) NOT NULL DEFAULT '0',"+
+			"PRIMARY KEY (`version`)"+
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;")
+		if err != nil {
+			return nil, err
+		}
+	}
+	var list []*appliedMigration
+	err := conn.SelectContext(ctx, &list, "SELECT `version`,`name`,`checksum`,`applied_at` FROM `"+MigrationTable+"`;")
+	if err != nil {
+		var mysqlErr *driver.MySQLError
+		// ER_NO_SUCH_TABLE: nothing applied yet
+		if !create && errors.As(err, &mysqlErr) && mysqlErr.Number == 1146 {
+			return map[int64]*appliedMigration{}, nil
+		}
+		return nil, err
+	}
+	var applied = make(map[int64]*appliedMigration, len(list))
+	for _, a := range list {
+		applied[a.Version] = a
+	}
+	return applied, nil
+}
+
+// runMigration runs the SQL statements or the Go function of a migration, then records it.
+func runMigration(ctx context.Context, conn *sqlx.Conn, query string, fn func(context.Context, *sqlx.Tx) error, record func(sqlx.ExecerContext) error) error {
+	if query == "" {
+		tx, err := conn.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err = fn(ctx, tx); err == nil {
+			err = record(tx)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+	for _, stmt := range SplitStatements(query) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s\n%s", err.Error(), stmt)
+		}
+	}
+	return record(conn)
+}
+
+func logMigration(direction string, m *Migration, query string) {
+	if query == "" {
+		xlog.Infof("[dry-run] %s %d_%s: Go function", direction, m.Version, m.Name)
+		return
+	}
+	xlog.Infof("[dry-run] %s %d_%s:\n%s", direction, m.Version, m.Name, strings.Join(SplitStatements(query), ";\n")+";")
+}
+
+// SplitStatements splits the SQL text into statements without the terminators.
+// NOTE:
+//  Handles quoted strings, identifiers and comments;
+//  Supports the 'DELIMITER' lines of the mysql client, e.g. for CREATE TRIGGER;
+//  Empty statements and comments-only statements are dropped.
+func SplitStatements(text string) []string {
+	var (
+		stmts     []string
+		delimiter = ";"
+		buf       strings.Builder
+		hasCode   bool
+		quote     byte
+		lineStart = true
+	)
+	flush := func() {
+		if s := strings.TrimSpace(buf.String()); s != "" && hasCode {
+			stmts = append(stmts, s)
+		}
+		buf.Reset()
+		hasCode = false
+	}
+	for i := 0; i < len(text); {
+		c := text[i]
+		if quote != 0 {
+			buf.WriteByte(c)
+			i++
+			if c == '\\' && quote != '`' && i < len(text) {
+				buf.WriteByte(text[i])
+				i++
+			} else if c == quote {
+				if i < len(text) && text[i] == quote {
+					// doubled quote
+					buf.WriteByte(text[i])
+					i++
+				} else {
+					quote = 0
+				}
+			}
+			continue
+		}
+		if lineStart {
+			// DELIMITER directive must be at the start of a line
+			j := i
+			for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+				j++
+			}
+			if len(text)-j > 10 && strings.EqualFold(text[j:j+10], "DELIMITER ") {
+				end := strings.IndexByte(text[j:], '\n')
+				if end == -1 {
+					end = len(text) - j
+				}
+				if d := strings.TrimSpace(text[j+10 : j+end]); d != "" {
+					flush()
+					delimiter = d
+				}
+				i = j + end
+				continue
+			}
+		}
+		lineStart = false
+		switch {
+		case c == '\n':
+			lineStart = true
+			buf.WriteByte(c)
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			hasCode = true
+			buf.WriteByte(c)
+			i++
+		case c == '#' || (c == '-' && strings.HasPrefix(text[i:], "--") &&
+			(i+2 == len(text) || text[i+2] == ' ' || text[i+2] == '\t' || text[i+2] == '\n' || text[i+2] == '\r')):
+			end := strings.IndexByte(text[i:], '\n')
+			if end == -1 {
+				end = len(text) - i
+			}
+			buf.WriteString(text[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end == -1 {
+				end = len(text) - i
+			} else {
+				end += 4
+			}
+			// keep the executable comments, e.g. /*!40101 ... */
+			if strings.HasPrefix(text[i:], "/*!") {
+				hasCode = true
+			}
+			buf.WriteString(text[i : i+end])
+			i += end
+		case strings.HasPrefix(text[i:], delimiter):
+			flush()
+			i += len(delimiter)
+		default:
+			if c != ' ' && c != '\t' && c != '\r' {
+				hasCode = true
+			}
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+	return stmts
+}
@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	text := `-- create table
+CREATE TABLE t (id INT, s VARCHAR(8) DEFAULT 'a;b'); # trailing comment
+INSERT INTO t VALUES (1, 'it''s;'), (2, "x\";y");
+/* only a comment; */
+/*!40101 SET NAMES utf8mb4 */;
+DELIMITER //
+CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.s = 'z'; END//
+DELIMITER ;
+UPDATE ` + "`t`" + ` SET s='--x' WHERE id=1
+`
+	got := SplitStatements(text)
+	want := []string{
+		"-- create table\nCREATE TABLE t (id INT, s VARCHAR(8) DEFAULT 'a;b')",
+		"# trailing comment\nINSERT INTO t VALUES (1, 'it''s;'), (2, \"x\\\";y\")",
+		"/* only a comment; */\n/*!40101 SET NAMES utf8mb4 */",
+		"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.s = 'z'; END",
+		"UPDATE `t` SET s='--x' WHERE id=1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_name.up.sql":    {Data: []byte("ALTER TABLE user ADD name VARCHAR(32);")},
+		"migrations/0002_add_name.down.sql":  {Data: []byte("ALTER TABLE user DROP name;")},
+		"migrations/0001_create_user.up.sql": {Data: []byte("CREATE TABLE user (id INT);")},
+		"migrations/README.md":               {Data: []byte("ignored")},
+	}
+	migrations, err := ReadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "add_name" ||
+		migrations[0].Down != "" || migrations[1].Down == "" {
+		t.Fatalf("migrations: %+v %+v", migrations[0], migrations[1])
+	}
+	if len(migrations[0].Checksum()) != 64 {
+		t.Fatalf("checksum: %s", migrations[0].Checksum())
+	}
+
+	fsys["migrations/0003_only_down.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	if _, err = ReadMigrations(fsys, "migrations"); err == nil {
+		t.Fatal("want error of missing up file")
+	}
+}
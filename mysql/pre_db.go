@@ -1,20 +1,29 @@
 package mysql
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
-	"github.com/swxctx/gutil"
 	"github.com/swxctx/xmodel/redis"
-	"github.com/swxctx/xmodel/sqlx"
-	"github.com/swxctx/xmodel/sqlx/reflectx"
 )
 
 // PreDB preset *DB
 type PreDB struct {
 	*DB
-	preFuncs map[string]func() error
+	mu       sync.Mutex
+	preFuncs []*preFunc // in registration order
+	deps     map[string][]string
 	inited   bool
+	ownCache bool // the redis client is created by Init
+}
+
+// preFunc the registration of a table, called at initialization.
+type preFunc struct {
+	tableName string
+	fn        func() error
 }
 
 // NewPreDB creates a unconnected *DB
@@ -23,12 +32,17 @@ func NewPreDB() *PreDB {
 		DB: &DB{
 			cacheableDBs: make(map[string]*CacheableDB),
 		},
-		preFuncs: make(map[string]func() error),
+		deps: make(map[string][]string),
 	}
 }
 
 // Init initialize *DB.
+// NOTE:
+//  Does nothing if it is initialized.
 func (p *PreDB) Init(dbConfig *Config, redisConfig *redis.Config) (err error) {
+	if p.Inited() {
+		return nil
+	}
 	var cache *redis.Client
 	if !dbConfig.NoCache && redisConfig != nil {
 		cache, err = redis.NewClient(redisConfig)
@@ -36,65 +50,190 @@ func (p *PreDB) Init(dbConfig *Config, redisConfig *redis.Config) (err error) {
 			return err
 		}
 	}
-	return p.Init2(dbConfig, cache)
+	if err = p.init(dbConfig, cache, cache != nil); err != nil && cache != nil {
+		cache.Close()
+	}
+	return err
 }
 
 // Init2 initialize *DB.
+// NOTE:
+//  Registers the tables in registration order, and after their dependencies (see DependsOn);
+//  Does nothing if it is initialized;
+//  It can be called again after Close.
 func (p *PreDB) Init2(dbConfig *Config, redisClient *redis.Client) (err error) {
-	p.DB.DB, err = sqlx.Connect("mysql", dbConfig.Source())
+	return p.init(dbConfig, redisClient, false)
+}
+
+// init initializes *DB, ownCache is whether redisClient is created by Init and closed by Close.
+func (p *PreDB) init(dbConfig *Config, redisClient *redis.Client, ownCache bool) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inited {
+		return nil
+	}
+	preFuncs, err := p.sortedPreFuncs()
+	if err != nil {
+		return err
+	}
+
+	p.DB.DB, err = connect(dbConfig)
 	if err != nil {
 		return err
 	}
-	p.DB.SetMaxOpenConns(dbConfig.MaxOpenConns)
-	p.DB.SetMaxIdleConns(dbConfig.MaxIdleConns)
-	p.DB.SetConnMaxLifetime(time.Duration(dbConfig.ConnMaxLifetime) * time.Second)
-	p.DB.Mapper = reflectx.NewMapperFunc("json", gutil.SnakeString)
 	p.DB.dbConfig = dbConfig
 	if !dbConfig.NoCache && redisClient != nil {
 		p.DB.Cache = redisClient
 		p.DB.redisConfig = redisClient.Config()
+		p.ownCache = ownCache
 	}
 
-	for _, preFunc := range p.preFuncs {
-		if err = preFunc(); err != nil {
+	for _, preFunc := range preFuncs {
+		if err = preFunc.fn(); err != nil {
+			p.DB.Close()
+			p.reset()
 			return err
 		}
 	}
 	p.inited = true
+	p.DB.startHealthCheck()
 	return nil
 }
 
-// RegCacheableDB registers a cacheable table.
-func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duration, initQuery string, args ...interface{}) (*CacheableDB, error) {
-	if p.inited {
-		if len(initQuery) > 0 {
-			_, err := p.DB.Exec(initQuery, args...)
-			if err != nil {
-				return nil, err
+// Inited returns whether the *DB is initialized.
+func (p *PreDB) Inited() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inited
+}
+
+// Close waits for the in-flight cache locks, and closes the database.
+// NOTE:
+//  The redis client is closed only if it is created by Init, the one passed to Init2 is left to the caller;
+//  If ctx is done before the locks are released, it still closes the database and returns ctx.Err();
+//  The registered *CacheableDB are kept, and are available again after re-initialization.
+func (p *PreDB) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.inited {
+		return nil
+	}
+	var errs []error
+	if p.DB.Cache != nil {
+		errs = append(errs, p.DB.Cache.WaitLocks(ctx))
+	}
+	errs = append(errs, p.DB.Close())
+	if p.DB.Cache != nil && p.ownCache {
+		errs = append(errs, p.DB.Cache.Close())
+	}
+	p.reset()
+	return errors.Join(errs...)
+}
+
+// reset drops the closed clients and the registered tables.
+func (p *PreDB) reset() {
+	p.DB.DB = nil
+	p.DB.Cache = nil
+	p.DB.redisConfig = nil
+	p.ownCache = false
+	p.DB.cacheableDBs = make(map[string]*CacheableDB)
+	p.inited = false
+}
+
+// DependsOn declares that the table is registered (and its initQuery executed)
+// after the dependencies at initialization.
+// NOTE:
+//  The tables must be registered by the *PreDB before initialization.
+func (p *PreDB) DependsOn(tableName string, dependencies ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deps[tableName] = append(p.deps[tableName], dependencies...)
+}
+
+// sortedPreFuncs returns the registrations sorted by dependencies, otherwise by registration order.
+func (p *PreDB) sortedPreFuncs() ([]*preFunc, error) {
+	var (
+		index  = make(map[string]int, len(p.preFuncs))
+		state  = make(map[string]int, len(p.preFuncs)) // 1: visiting, 2: done
+		sorted = make([]*preFunc, 0, len(p.preFuncs))
+		visit  func(tableName string, path []string) error
+	)
+	for i, f := range p.preFuncs {
+		index[f.tableName] = i
+	}
+	visit = func(tableName string, path []string) error {
+		switch state[tableName] {
+		case 1:
+			return fmt.Errorf("Init2(): circular table dependencies: %v", append(path, tableName))
+		case 2:
+			return nil
+		}
+		state[tableName] = 1
+		for _, dep := range p.deps[tableName] {
+			if _, ok := index[dep]; !ok {
+				return fmt.Errorf("Init2(): table '%s' depends on unregistered table '%s'", tableName, dep)
 			}
+			if err := visit(dep, append(path, tableName)); err != nil {
+				return err
+			}
+		}
+		state[tableName] = 2
+		sorted = append(sorted, p.preFuncs[index[tableName]])
+		return nil
+	}
+	for _, f := range p.preFuncs {
+		if err := visit(f.tableName, nil); err != nil {
+			return nil, err
 		}
-		return p.DB.RegCacheableDB(ormStructPtr, cacheExpiration)
 	}
+	return sorted, nil
+}
 
+// RegCacheableDB registers a cacheable table.
+// NOTE:
+//  If the *PreDB is not initialized, the table is registered and initQuery is executed at initialization.
+func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duration, initQuery string, args ...interface{}) (*CacheableDB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	tableName := ormStructPtr.TableName()
-	if _, ok := p.preFuncs[ormStructPtr.TableName()]; ok {
-		return nil, fmt.Errorf("re-register cacheable table: %s", tableName)
+	for _, f := range p.preFuncs {
+		if f.tableName == tableName {
+			return nil, fmt.Errorf("re-register cacheable table: %s", tableName)
+		}
 	}
 	var cacheableDB = new(CacheableDB)
-	var preFunc = func() error {
+	var fn = func() error {
 		if len(initQuery) > 0 {
 			_, err := p.DB.Exec(initQuery, args...)
 			if err != nil {
 				return err
 			}
 		}
+		roles := cacheableDB.pendingRoles
+		if roles == nil && cacheableDB.fieldsIndexMap != nil {
+			// re-initialization, keep the roles set before
+			r := cacheableDB.roles
+			roles = &r
+		}
 		_cacheableDB, err := p.DB.RegCacheableDB(ormStructPtr, cacheExpiration)
+		if err == nil && roles != nil {
+			err = _cacheableDB.SetColumnRoles(*roles)
+		}
+		if err == nil && cacheableDB.bloomOpts != nil {
+			err = _cacheableDB.EnableBloomFilter(cacheableDB.bloomOpts.expected, cacheableDB.bloomOpts.fpRate)
+		}
 		if err == nil {
+			_cacheableDB.audit = cacheableDB.audit
 			*cacheableDB = *_cacheableDB
 			p.DB.cacheableDBs[tableName] = cacheableDB
 		}
 		return err
 	}
-	p.preFuncs[tableName] = preFunc
+	if p.inited {
+		if err := fn(); err != nil {
+			return nil, err
+		}
+	}
+	p.preFuncs = append(p.preFuncs, &preFunc{tableName: tableName, fn: fn})
 	return cacheableDB, nil
 }
@@ -0,0 +1,81 @@
+package mysql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/swxctx/xmodel/redis"
+)
+
+func TestSortedPreFuncs(t *testing.T) {
+	p := NewPreDB()
+	for _, tableName := range []string{"order", "user", "item", "order_item"} {
+		p.preFuncs = append(p.preFuncs, &preFunc{tableName: tableName})
+	}
+	p.DependsOn("order", "user")
+	p.DependsOn("order_item", "order", "item")
+	sorted, err := p.sortedPreFuncs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range sorted {
+		names = append(names, f.tableName)
+	}
+	if got, want := strings.Join(names, ","), "user,order,item,order_item"; got != want {
+		t.Fatalf("sortedPreFuncs() = %s, want %s", got, want)
+	}
+
+	p.DependsOn("user", "order_item")
+	if _, err = p.sortedPreFuncs(); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Fatalf("sortedPreFuncs() with cycle: %v", err)
+	}
+
+	p = NewPreDB()
+	p.preFuncs = append(p.preFuncs, &preFunc{tableName: "order"})
+	p.DependsOn("order", "user")
+	if _, err = p.sortedPreFuncs(); err == nil || !strings.Contains(err.Error(), "unregistered") {
+		t.Fatalf("sortedPreFuncs() with unknown dependency: %v", err)
+	}
+}
+
+func TestPreDBCloseCache(t *testing.T) {
+	m := miniredis.RunT(t)
+	newCache := func() *redis.Client {
+		cache, err := redis.NewClient(&redis.Config{DeployType: redis.TypeSingle, ForSingle: redis.SingleConfig{Addr: m.Addr()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cache
+	}
+
+	// the client passed to Init2 is shared, and left open
+	shared := newCache()
+	defer shared.Close()
+	p := NewPreDB()
+	p.DB.Cache, p.inited = shared, true
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := shared.Ping().Err(); err != nil {
+		t.Fatalf("the shared client is closed: %v", err)
+	}
+	if p.Inited() || p.DB.Cache != nil {
+		t.Fatal("Close() does not reset the *PreDB")
+	}
+
+	// the client created by Init is closed
+	owned := newCache()
+	p.DB.Cache, p.ownCache, p.inited = owned, true, true
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := owned.Ping().Err(); err == nil {
+		t.Fatal("the client created by Init is not closed")
+	}
+	if p.ownCache {
+		t.Fatal("Close() does not reset ownCache")
+	}
+}
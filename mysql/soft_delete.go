@@ -0,0 +1,297 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+// ColumnRoles the columns playing the conventional roles of a table,
+// empty means the table has no such column.
+type ColumnRoles struct {
+	// the unix seconds of creation, filled on insert if it is zero
+	CreatedAt string
+	// the unix seconds of the last write, filled on every write
+	UpdatedAt string
+	// the unix seconds of soft deletion, 0 means not deleted
+	DeletedTs string
+}
+
+// DefaultColumnRoles the conventional columns of xmodel tables,
+// used at registration if the table has them.
+var DefaultColumnRoles = ColumnRoles{
+	CreatedAt: "created_at",
+	UpdatedAt: "updated_at",
+	DeletedTs: "deleted_ts",
+}
+
+// ErrNoSoftDelete error: the table has no soft-delete column
+var ErrNoSoftDelete = errors.New("the table has no soft-delete column")
+
+// defaultColumnRoles returns the DefaultColumnRoles that the table has.
+func (c *CacheableDB) defaultColumnRoles() ColumnRoles {
+	var roles ColumnRoles
+	if c.isInt64Column(DefaultColumnRoles.CreatedAt) {
+		roles.CreatedAt = DefaultColumnRoles.CreatedAt
+	}
+	if c.isInt64Column(DefaultColumnRoles.UpdatedAt) {
+		roles.UpdatedAt = DefaultColumnRoles.UpdatedAt
+	}
+	if c.isInt64Column(DefaultColumnRoles.DeletedTs) {
+		roles.DeletedTs = DefaultColumnRoles.DeletedTs
+	}
+	return roles
+}
+
+// ColumnRoles returns the columns playing the conventional roles.
+func (c *CacheableDB) ColumnRoles() ColumnRoles {
+	return c.roles
+}
+
+// SetColumnRoles registers which columns play the conventional roles.
+// NOTE:
+//  The columns must be db field style (snake format) of int64 fields, empty means no such column;
+//  If it is called before the *PreDB is initialized, the roles are checked and applied at initialization;
+//  Not concurrent safe, call it right after registration.
+func (c *CacheableDB) SetColumnRoles(roles ColumnRoles) error {
+	if c.fieldsIndexMap == nil {
+		// registered by *PreDB and not initialized yet
+		c.pendingRoles = &roles
+		return nil
+	}
+	for _, col := range []string{roles.CreatedAt, roles.UpdatedAt, roles.DeletedTs} {
+		if col != "" && !c.isInt64Column(col) {
+			return fmt.Errorf("SetColumnRoles(): '%s' is not an int64 column of table '%s'", col, c.tableName)
+		}
+	}
+	c.roles = roles
+	c.initQueries()
+	return nil
+}
+
+func (c *CacheableDB) isInt64Column(col string) bool {
+	i, ok := c.fieldsIndexMap[col]
+	return ok && c.structType.Field(i).Type.Kind() == reflect.Int64
+}
+
+// WithDeleted returns a handle that includes the soft deleted rows in queries.
+// NOTE:
+//  It shares the table and the cache with c, but not the settings:
+//  SetColumnRoles, EnableAudit and EnableBloomFilter called on either later do not affect the other;
+//  With *PreDB, call it after the *PreDB is initialized.
+func (c *CacheableDB) WithDeleted() *CacheableDB {
+	if c.withDeleted {
+		return c
+	}
+	cc := c.clone()
+	cc.withDeleted = true
+	return cc
+}
+
+// clone returns a copy of c with its own slices, maps and precomputed queries.
+func (c *CacheableDB) clone() *CacheableDB {
+	cc := *c
+	cc.cols = append([]string(nil), c.cols...)
+	cc.priCols = append([]string(nil), c.priCols...)
+	cc.priFieldsIndex = append([]int(nil), c.priFieldsIndex...)
+	if c.fieldsIndexMap != nil {
+		cc.fieldsIndexMap = make(map[string]int, len(c.fieldsIndexMap))
+		for col, i := range c.fieldsIndexMap {
+			cc.fieldsIndexMap[col] = i
+		}
+	}
+	if c.codecs != nil {
+		cc.codecs = make(map[int]sqlx.FieldCodec, len(c.codecs))
+		for i, codec := range c.codecs {
+			cc.codecs[i] = codec
+		}
+	}
+	if c.pendingRoles != nil {
+		roles := *c.pendingRoles
+		cc.pendingRoles = &roles
+	}
+	if c.queries != nil {
+		cc.initQueries()
+	}
+	return &cc
+}
+
+// filterDeleted returns sql.ErrNoRows if the row got is soft deleted.
+func (c *CacheableDB) filterDeleted(structElemValue reflect.Value, err error) error {
+	if err != nil || c.withDeleted {
+		return err
+	}
+	if i, ok := c.fieldsIndexMap[c.roles.DeletedTs]; ok && structElemValue.Field(i).Int() != 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// stampTimestamps fills the 'created_at' role if it is zero, and the 'updated_at' role
+// if it is zero or force is true.
+func (c *CacheableDB) stampTimestamps(structElemValue reflect.Value, now int64, force bool) {
+	if i, ok := c.fieldsIndexMap[c.roles.UpdatedAt]; ok {
+		if fv := structElemValue.Field(i); force || fv.Int() == 0 {
+			fv.SetInt(now)
+		}
+	}
+	if i, ok := c.fieldsIndexMap[c.roles.CreatedAt]; ok {
+		if fv := structElemValue.Field(i); fv.Int() == 0 {
+			fv.SetInt(now)
+		}
+	}
+}
+
+// SoftDelete marks the row as deleted by primary key, and deletes its cache.
+// NOTE:
+//  srcStructPtr must be a *struct type with the primary key specified;
+//  Sets the 'deleted_ts' and 'updated_at' roles of the table and srcStructPtr to now;
+//  Returns ErrNoSoftDelete if the table has no 'deleted_ts' role.
+func (c *CacheableDB) SoftDelete(srcStructPtr Cacheable, tx ...*sqlx.Tx) error {
+	return c.setDeleted(context.Background(), srcStructPtr, "", true, tx...)
+}
+
+// Restore marks the soft deleted row as not deleted by primary key, and deletes its cache.
+// NOTE:
+//  srcStructPtr must be a *struct type with the primary key specified;
+//  Sets the 'deleted_ts' role of the table and srcStructPtr to 0, and the 'updated_at' role to now;
+//  Returns ErrNoSoftDelete if the table has no 'deleted_ts' role.
+func (c *CacheableDB) Restore(srcStructPtr Cacheable, tx ...*sqlx.Tx) error {
+	return c.setDeleted(context.Background(), srcStructPtr, "", false, tx...)
+}
+
+// ForceDelete deletes the row from the hard disk by primary key, whether it is soft deleted or not,
+// and deletes its cache.
+// NOTE:
+//  srcStructPtr must be a *struct type with the primary key specified.
+func (c *CacheableDB) ForceDelete(srcStructPtr Cacheable, tx ...*sqlx.Tx) error {
+	return c.forceDelete(context.Background(), srcStructPtr, "", false, tx...)
+}
+
+func (c *CacheableDB) setDeleted(ctx context.Context, srcStructPtr Cacheable, uniqueField string, deleted bool, tx ...*sqlx.Tx) error {
+	if c.roles.DeletedTs == "" {
+		return ErrNoSoftDelete
+	}
+	v, where, args, err := c.whereKey(srcStructPtr, uniqueField)
+	if err != nil {
+		return err
+	}
+	var (
+		now     = time.Now().Unix()
+		sets    []string
+		setArgs []interface{}
+		ts      int64
+	)
+	if deleted {
+		ts = now
+		where = append(where, "`"+c.roles.DeletedTs+"`=0")
+	} else {
+		where = append(where, "`"+c.roles.DeletedTs+"`<>0")
+	}
+	sets = append(sets, "`"+c.roles.DeletedTs+"`=?")
+	setArgs = append(setArgs, ts)
+	if c.roles.UpdatedAt != "" {
+		sets = append(sets, "`"+c.roles.UpdatedAt+"`=?")
+		setArgs = append(setArgs, now)
+	}
+	action := AuditRestore
+	if deleted {
+		action = AuditSoftDelete
+	}
+	query := "UPDATE `" + c.tableName + "` SET " + strings.Join(sets, ",") + " WHERE " + strings.Join(where, " AND ") + ";"
+	err = c.audited(ctx, action, []reflect.Value{v}, uniqueField, func(tx ...*sqlx.Tx) error {
+		return c.DB.StmtCallback(ctx, query, func(stmt *sqlx.Stmt) error {
+			_, err := stmt.ExecContext(ctx, append(setArgs, args...)...)
+			return err
+		}, tx...)
+	}, tx...)
+	if err != nil {
+		return err
+	}
+	v.Field(c.fieldsIndexMap[c.roles.DeletedTs]).SetInt(ts)
+	if i, ok := c.fieldsIndexMap[c.roles.UpdatedAt]; ok {
+		v.Field(i).SetInt(now)
+	}
+	c.deleteCacheLogged(srcStructPtr, uniqueField)
+	return nil
+}
+
+// forceDelete deletes the row from the hard disk, only if it is not soft deleted when live is true.
+func (c *CacheableDB) forceDelete(ctx context.Context, srcStructPtr Cacheable, uniqueField string, live bool, tx ...*sqlx.Tx) error {
+	v, where, args, err := c.whereKey(srcStructPtr, uniqueField)
+	if err != nil {
+		return err
+	}
+	query := c.deleteSQL(where, live)
+	err = c.audited(ctx, AuditDelete, []reflect.Value{v}, uniqueField, func(tx ...*sqlx.Tx) error {
+		return c.DB.StmtCallback(ctx, query, func(stmt *sqlx.Stmt) error {
+			_, err := stmt.ExecContext(ctx, args...)
+			return err
+		}, tx...)
+	}, tx...)
+	if err != nil {
+		return err
+	}
+	c.deleteCacheLogged(srcStructPtr, uniqueField)
+	return nil
+}
+
+// deleteSQL returns the 'DELETE' of the where conditions, with the "`deleted_ts`=0" condition if live is true.
+func (c *CacheableDB) deleteSQL(where []string, live bool) string {
+	if live && c.roles.DeletedTs != "" && !c.withDeleted {
+		where = append(where, "`"+c.roles.DeletedTs+"`=0")
+	}
+	return "DELETE FROM `" + c.tableName + "` WHERE " + strings.Join(where, " AND ") + ";"
+}
+
+// whereKey returns the conditions and values of the primary key, or uniqueField if it is not empty.
+func (c *CacheableDB) whereKey(srcStructPtr Cacheable, uniqueField string) (reflect.Value, []string, []interface{}, error) {
+	v := reflect.ValueOf(srcStructPtr)
+	if typeName := v.Type().String(); typeName != c.typeName {
+		return emptyValue, nil, nil, fmt.Errorf("unmatch Cacheable: want %s, have %s", c.typeName, typeName)
+	}
+	if v.IsNil() {
+		return emptyValue, nil, nil, errors.New("nil " + c.typeName)
+	}
+	v = v.Elem()
+	cols := c.priCols
+	if uniqueField != "" {
+		if _, ok := c.fieldsIndexMap[uniqueField]; !ok {
+			return emptyValue, nil, nil, fmt.Errorf("unknown field '%s' of table '%s'", uniqueField, c.tableName)
+		}
+		cols = []string{uniqueField}
+	}
+	var (
+		where = make([]string, 0, len(cols)+1)
+		args  = make([]interface{}, 0, len(cols))
+	)
+	for _, col := range cols {
+		arg, err := c.lookupValue(v, c.fieldsIndexMap[col])
+		if err != nil {
+			return emptyValue, nil, nil, err
+		}
+		where = append(where, "`"+col+"`=?")
+		args = append(args, arg)
+	}
+	return v, where, args, nil
+}
+
+// deleteCacheLogged deletes the cache of srcStructPtr, logs the error only.
+func (c *CacheableDB) deleteCacheLogged(srcStructPtr Cacheable, uniqueField string) {
+	var err error
+	if uniqueField != "" {
+		err = c.DeleteCache(srcStructPtr, uniqueField)
+	} else {
+		err = c.DeleteCache(srcStructPtr)
+	}
+	if err != nil {
+		xlog.Errorf("%s", err.Error())
+	}
+}
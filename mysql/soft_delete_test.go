@@ -0,0 +1,52 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xmodel/redis"
+	"github.com/swxctx/xmodel/sqlx"
+	"github.com/swxctx/xmodel/sqlx/reflectx"
+)
+
+type softDeleteUser struct {
+	Id        int64  `json:"id" key:"pri"`
+	Name      string `json:"name"`
+	UpdatedAt int64  `json:"updated_at"`
+	DeletedTs int64  `json:"deleted_ts"`
+}
+
+func (*softDeleteUser) TableName() string { return "soft_delete_user" }
+
+func TestWithDeleted(t *testing.T) {
+	d := &DB{
+		DB:           &sqlx.DB{Mapper: reflectx.NewMapperFunc("json", gutil.SnakeString)},
+		dbConfig:     &Config{Database: "shop"},
+		Cache:        &redis.Client{},
+		cacheableDBs: make(map[string]*CacheableDB),
+	}
+	c, err := d.RegCacheableDB(&softDeleteUser{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd := c.WithDeleted()
+	if !wd.withDeleted || c.withDeleted || wd.WithDeleted() != wd {
+		t.Fatal("WithDeleted() does not include the soft deleted rows only in the new handle")
+	}
+	if wd.queries == c.queries {
+		t.Fatal("WithDeleted() shares the precomputed queries")
+	}
+
+	// the later settings of the original do not leak into the handle
+	if err = c.SetColumnRoles(ColumnRoles{UpdatedAt: "updated_at"}); err != nil {
+		t.Fatal(err)
+	}
+	if wd.roles.DeletedTs != "deleted_ts" || c.roles.DeletedTs != "" {
+		t.Fatalf("roles after SetColumnRoles() = %+v, the handle %+v", c.roles, wd.roles)
+	}
+	c.fieldsIndexMap["x"] = 9
+	if _, ok := wd.fieldsIndexMap["x"]; ok {
+		t.Fatal("WithDeleted() shares the fields map")
+	}
+}
@@ -0,0 +1,280 @@
+package mysql
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+// defaultStmtCacheSize the default max number of cached prepared statements per DB
+const defaultStmtCacheSize = 256
+
+// StmtCacheStats the statistics of the prepared statement cache.
+type StmtCacheStats struct {
+	Size      int    // the number of cached statements
+	Capacity  int    // the max number of cached statements
+	Hits      uint64 // the number of lookups that reused a cached statement
+	Misses    uint64 // the number of lookups that prepared a new statement
+	Evictions uint64 // the number of statements closed for exceeding the capacity
+}
+
+// HitRate returns the ratio of hits to lookups, 0 if there is no lookup.
+func (s StmtCacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// stmtCache a bounded LRU cache of prepared statements, keyed by query text.
+// NOTE:
+//  The evicted statement is closed after the last user released it.
+type stmtCache struct {
+	mu        sync.Mutex
+	capacity  int
+	lru       *list.List // *stmtEntry, front is the most recently used
+	entries   map[string]*list.Element
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type stmtEntry struct {
+	key     string
+	stmt    *sqlx.Stmt
+	nstmt   *sqlx.NamedStmt
+	refs    int
+	evicted bool
+}
+
+func newStmtCache(capacity int) *stmtCache {
+	return &stmtCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element, capacity),
+	}
+}
+
+// acquire returns the cached entry of key, or the prepared one if not cached.
+// The caller must call release(entry) after using it.
+func (s *stmtCache) acquire(key string, prepare func() (*stmtEntry, error)) (*stmtEntry, error) {
+	s.mu.Lock()
+	if elem, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(elem)
+		e := elem.Value.(*stmtEntry)
+		e.refs++
+		s.mu.Unlock()
+		atomic.AddUint64(&s.hits, 1)
+		return e, nil
+	}
+	s.mu.Unlock()
+	atomic.AddUint64(&s.misses, 1)
+
+	e, err := prepare()
+	if err != nil {
+		return nil, err
+	}
+	e.key = key
+	e.refs = 1
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		// prepared concurrently by another goroutine
+		e.close()
+		s.lru.MoveToFront(elem)
+		e = elem.Value.(*stmtEntry)
+		e.refs++
+		return e, nil
+	}
+	s.entries[key] = s.lru.PushFront(e)
+	for s.lru.Len() > s.capacity {
+		elem := s.lru.Back()
+		old := s.lru.Remove(elem).(*stmtEntry)
+		delete(s.entries, old.key)
+		old.evicted = true
+		s.evictions++
+		if old.refs == 0 {
+			old.close()
+		}
+	}
+	return e, nil
+}
+
+func (s *stmtCache) release(e *stmtEntry) {
+	s.mu.Lock()
+	e.refs--
+	closable := e.evicted && e.refs == 0
+	s.mu.Unlock()
+	if closable {
+		e.close()
+	}
+}
+
+// purge closes all the idle statements and drops all the entries.
+func (s *stmtCache) purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for elem := s.lru.Front(); elem != nil; elem = elem.Next() {
+		e := elem.Value.(*stmtEntry)
+		e.evicted = true
+		if e.refs == 0 {
+			e.close()
+		}
+	}
+	s.lru.Init()
+	s.entries = make(map[string]*list.Element, s.capacity)
+}
+
+func (s *stmtCache) stats() StmtCacheStats {
+	s.mu.Lock()
+	size, evictions := s.lru.Len(), s.evictions
+	s.mu.Unlock()
+	return StmtCacheStats{
+		Size:      size,
+		Capacity:  s.capacity,
+		Hits:      atomic.LoadUint64(&s.hits),
+		Misses:    atomic.LoadUint64(&s.misses),
+		Evictions: evictions,
+	}
+}
+
+func (e *stmtEntry) close() {
+	var err error
+	if e.stmt != nil {
+		err = e.stmt.Close()
+	}
+	if e.nstmt != nil {
+		err = e.nstmt.Close()
+	}
+	if err != nil {
+		xlog.Errorf("stmtCache: close statement: %s", err.Error())
+	}
+}
+
+// stmtCache returns the prepared statement cache, nil if it is disabled.
+func (d *DB) stmtCache() *stmtCache {
+	d.stmtOnce.Do(func() {
+		size := defaultStmtCacheSize
+		if d.dbConfig != nil && d.dbConfig.StmtCacheSize != 0 {
+			size = d.dbConfig.StmtCacheSize
+		}
+		if size > 0 {
+			d.stmts = newStmtCache(size)
+		}
+	})
+	return d.stmts
+}
+
+// StmtCacheStats returns the statistics of the prepared statement cache.
+func (d *DB) StmtCacheStats() StmtCacheStats {
+	if s := d.stmtCache(); s != nil {
+		return s.stats()
+	}
+	return StmtCacheStats{}
+}
+
+// PurgeStmtCache closes and drops all the cached prepared statements.
+func (d *DB) PurgeStmtCache() {
+	if s := d.stmtCache(); s != nil {
+		s.purge()
+	}
+}
+
+// StmtCallback calls fn with the cached prepared statement of query.
+// NOTE:
+//  The statement is prepared on first use, and is bound to the transaction if tx is specified;
+//  The statement must not be used after fn returns.
+func (d *DB) StmtCallback(ctx context.Context, query string, fn func(*sqlx.Stmt) error, tx ...*sqlx.Tx) error {
+	s := d.stmtCache()
+	if s == nil {
+		stmt, err := d.prepareStmt(ctx, query, tx...)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		return fn(stmt)
+	}
+	e, err := s.acquire(query, func() (*stmtEntry, error) {
+		stmt, err := d.DB.PreparexContext(ctx, query)
+		return &stmtEntry{stmt: stmt}, err
+	})
+	if err != nil {
+		return err
+	}
+	defer s.release(e)
+	if len(tx) > 0 && tx[0] != nil {
+		txStmt := tx[0].StmtxContext(ctx, e.stmt)
+		defer txStmt.Close()
+		return fn(txStmt)
+	}
+	return fn(e.stmt)
+}
+
+// NamedStmtCallback calls fn with the cached prepared named statement of query.
+// NOTE:
+//  The statement is prepared on first use, and is bound to the transaction if tx is specified;
+//  The statement must not be used after fn returns.
+func (d *DB) NamedStmtCallback(ctx context.Context, query string, fn func(*sqlx.NamedStmt) error, tx ...*sqlx.Tx) error {
+	s := d.stmtCache()
+	if s == nil {
+		nstmt, err := d.prepareNamedStmt(ctx, query, tx...)
+		if err != nil {
+			return err
+		}
+		defer nstmt.Close()
+		return fn(nstmt)
+	}
+	// the named statement and the plain statement of the same text are different
+	e, err := s.acquire(":"+query, func() (*stmtEntry, error) {
+		nstmt, err := d.DB.PrepareNamedContext(ctx, query)
+		return &stmtEntry{nstmt: nstmt}, err
+	})
+	if err != nil {
+		return err
+	}
+	defer s.release(e)
+	if len(tx) > 0 && tx[0] != nil {
+		txStmt := tx[0].NamedStmtContext(ctx, e.nstmt)
+		defer txStmt.Close()
+		return fn(txStmt)
+	}
+	return fn(e.nstmt)
+}
+
+func (d *DB) prepareStmt(ctx context.Context, query string, tx ...*sqlx.Tx) (*sqlx.Stmt, error) {
+	if len(tx) > 0 && tx[0] != nil {
+		return tx[0].PreparexContext(ctx, query)
+	}
+	return d.DB.PreparexContext(ctx, query)
+}
+
+func (d *DB) prepareNamedStmt(ctx context.Context, query string, tx ...*sqlx.Tx) (*sqlx.NamedStmt, error) {
+	if len(tx) > 0 && tx[0] != nil {
+		return tx[0].PrepareNamedContext(ctx, query)
+	}
+	return d.DB.PrepareNamedContext(ctx, query)
+}
+
+// stmtGet selects one row by the cached prepared statement.
+func (d *DB) stmtGet(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return d.StmtCallback(ctx, query, func(stmt *sqlx.Stmt) error {
+		return stmt.GetContext(ctx, dest, args...)
+	})
+}
+
+// namedStmtExec executes the named query by the cached prepared statement.
+func (d *DB) namedStmtExec(ctx context.Context, query string, arg interface{}, tx ...*sqlx.Tx) (sql.Result, error) {
+	var r sql.Result
+	err := d.NamedStmtCallback(ctx, query, func(nstmt *sqlx.NamedStmt) (err error) {
+		r, err = nstmt.ExecContext(ctx, arg)
+		return err
+	}, tx...)
+	return r, err
+}
@@ -0,0 +1,39 @@
+package mysql
+
+import "testing"
+
+func TestStmtCache(t *testing.T) {
+	s := newStmtCache(2)
+	var prepared int
+	prepare := func() (*stmtEntry, error) {
+		prepared++
+		return &stmtEntry{}, nil
+	}
+	for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+		e, err := s.acquire(key, prepare)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.release(e)
+	}
+	stats := s.stats()
+	// a:miss b:miss a:hit c:miss(evict b) a:hit b:miss(evict c)
+	if prepared != 4 || stats.Hits != 2 || stats.Misses != 4 || stats.Evictions != 2 || stats.Size != 2 {
+		t.Fatalf("prepared=%d stats=%+v", prepared, stats)
+	}
+	if rate := stats.HitRate(); rate < 0.33 || rate > 0.34 {
+		t.Fatalf("hit rate: %v", rate)
+	}
+
+	// the evicted entry in use is not closed until released
+	inUse, _ := s.acquire("a", prepare)
+	s.acquire("x", prepare)
+	s.acquire("y", prepare)
+	if !inUse.evicted || inUse.refs != 1 {
+		t.Fatalf("entry: %+v", inUse)
+	}
+	s.release(inUse)
+	if inUse.refs != 0 {
+		t.Fatalf("entry: %+v", inUse)
+	}
+}
@@ -0,0 +1,523 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/swxctx/xmodel/mysql/builder"
+	"github.com/swxctx/xmodel/sqlx"
+)
+
+// Table is a generic typed repository of a cacheable table.
+// It provides the same cache semantics as the generated model functions,
+// so hand-written models can use it without codegen.
+// NOTE:
+//  T must be the registered *struct type, e.g. *mysql.Table[*User];
+//  The conventional 'created_at', 'updated_at' and 'deleted_ts' columns are
+//  maintained automatically if the table has them.
+type Table[T Cacheable] struct {
+	*CacheableDB
+}
+
+// NewTable wraps the registered *CacheableDB as a typed table.
+// NOTE:
+//  Use it with the *CacheableDB returned by *PreDB.RegCacheableDB before the *PreDB is initialized.
+func NewTable[T Cacheable](c *CacheableDB) *Table[T] {
+	return &Table[T]{CacheableDB: c}
+}
+
+// RegTable registers a cacheable table of type T and returns the typed table.
+func RegTable[T Cacheable](d *DB, cacheExpiration time.Duration) (*Table[T], error) {
+	c, err := d.RegCacheableDB(newCacheable[T](), cacheExpiration)
+	if err != nil {
+		return nil, err
+	}
+	return NewTable[T](c), nil
+}
+
+func newCacheable[T Cacheable]() T {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Ptr {
+		var zero T
+		return zero
+	}
+	return reflect.New(t.Elem()).Interface().(T)
+}
+
+// WithDeleted returns a table that includes the soft deleted rows in queries and updates.
+// NOTE:
+//  With *PreDB, call it after the *PreDB is initialized.
+func (t *Table[T]) WithDeleted() *Table[T] {
+	return &Table[T]{CacheableDB: t.CacheableDB.WithDeleted()}
+}
+
+// New creates a new zero value of T.
+func (t *Table[T]) New() T {
+	return newCacheable[T]()
+}
+
+// Insert inserts a row into database.
+// NOTE:
+//  Without cache layer;
+//  If the primary key is zero, it is generated by mysql, and written back to obj
+//  when it is a single integer;
+//  Automatic fill 'created_at' and 'updated_at' fields.
+func (t *Table[T]) Insert(ctx context.Context, obj T, tx ...*sqlx.Tx) error {
+	v, err := t.structElem(obj)
+	if err != nil {
+		return err
+	}
+	t.stampTimestamps(v, time.Now().Unix(), true)
+	query, autoID := t.insertSQL(v)
+	err = t.audited(ctx, AuditInsert, []reflect.Value{v}, "", func(tx ...*sqlx.Tx) error {
+		r, err := t.DB.namedStmtExec(ctx, query+";", obj, tx...)
+		if err == nil && autoID {
+			var id int64
+			if id, err = r.LastInsertId(); err == nil {
+				v.Field(t.priFieldsIndex[0]).SetInt(id)
+			}
+		}
+		return err
+	}, tx...)
+	if err != nil {
+		return err
+	}
+	t.bloomAdd([]reflect.Value{v})
+	return nil
+}
+
+// Upsert inserts or updates a row by primary key.
+// NOTE:
+//  With cache layer;
+//  Insert the row if the primary key is zero or not exist, otherwise update it by updateFields;
+//  updateFields' members must be db field style (snake format);
+//  Automatic update 'updated_at' field;
+//  Don't update the primary keys, 'created_at' key and 'deleted_ts' key;
+//  Update all fields except the primary keys, 'created_at' key and 'deleted_ts' key, if updateFields is empty.
+func (t *Table[T]) Upsert(ctx context.Context, obj T, updateFields []string, tx ...*sqlx.Tx) error {
+	v, err := t.structElem(obj)
+	if err != nil {
+		return err
+	}
+	t.stampTimestamps(v, time.Now().Unix(), false)
+	query, autoID := t.insertSQL(v)
+	sets := t.setColumns(updateFields, "=VALUES(`", "`)")
+	if len(sets) == 0 {
+		return nil
+	}
+	query += " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+	if len(updateFields) > 0 && t.roles.DeletedTs != "" {
+		query += ",`" + t.roles.DeletedTs + "`=0"
+	}
+	err = t.audited(ctx, AuditUpdate, []reflect.Value{v}, "", func(tx ...*sqlx.Tx) error {
+		r, err := t.DB.namedStmtExec(ctx, query+";", obj, tx...)
+		if err == nil && autoID {
+			var rowsAffected int64
+			rowsAffected, err = r.RowsAffected()
+			if rowsAffected == 1 {
+				var id int64
+				if id, err = r.LastInsertId(); err == nil {
+					v.Field(t.priFieldsIndex[0]).SetInt(id)
+				}
+			}
+		}
+		return err
+	}, tx...)
+	if err != nil {
+		return err
+	}
+	t.bloomAdd([]reflect.Value{v})
+	t.deleteCacheLogged(obj, "")
+	return nil
+}
+
+// UpdateByPrimary updates a row in database by primary key.
+// NOTE:
+//  With cache layer;
+//  updateFields' members must be db field style (snake format);
+//  Automatic update 'updated_at' field;
+//  Don't update the primary keys, 'created_at' key and 'deleted_ts' key;
+//  Update all fields except the primary keys, 'created_at' key and 'deleted_ts' key, if updateFields is empty.
+func (t *Table[T]) UpdateByPrimary(ctx context.Context, obj T, updateFields []string, tx ...*sqlx.Tx) error {
+	return t.update(ctx, obj, "", updateFields, tx...)
+}
+
+// UpdateByUnique updates a row in database by the uniqueField key.
+// NOTE:
+//  With cache layer;
+//  uniqueField must be db field style (snake format);
+//  updateFields' members must be db field style (snake format);
+//  Automatic update 'updated_at' field;
+//  Don't update the primary keys, uniqueField key, 'created_at' key and 'deleted_ts' key.
+func (t *Table[T]) UpdateByUnique(ctx context.Context, obj T, uniqueField string, updateFields []string, tx ...*sqlx.Tx) error {
+	return t.update(ctx, obj, uniqueField, updateFields, tx...)
+}
+
+func (t *Table[T]) update(ctx context.Context, obj T, uniqueField string, updateFields []string, tx ...*sqlx.Tx) error {
+	v, err := t.structElem(obj)
+	if err != nil {
+		return err
+	}
+	t.stampTimestamps(v, time.Now().Unix(), true)
+	sets := t.setColumns(updateFields, "=:", "", uniqueField)
+	if len(sets) == 0 {
+		return nil
+	}
+	whereCols := t.priCols
+	if uniqueField != "" {
+		whereCols = []string{uniqueField}
+	}
+	var where = make([]string, 0, len(whereCols)+1)
+	for _, col := range whereCols {
+		where = append(where, "`"+col+"`=:"+col)
+	}
+	if t.roles.DeletedTs != "" && !t.withDeleted {
+		where = append(where, "`"+t.roles.DeletedTs+"`=0")
+	}
+	query := "UPDATE `" + t.tableName + "` SET " + strings.Join(sets, ",") + " WHERE " + strings.Join(where, " AND ") + " LIMIT 1;"
+	err = t.audited(ctx, AuditUpdate, []reflect.Value{v}, uniqueField, func(tx ...*sqlx.Tx) error {
+		_, err := t.DB.namedStmtExec(ctx, query, obj, tx...)
+		return err
+	}, tx...)
+	if err != nil {
+		return err
+	}
+	t.deleteCacheLogged(obj, uniqueField)
+	return nil
+}
+
+// DeleteByPrimary deletes a row in database by the primary key of key.
+// NOTE:
+//  With cache layer;
+//  Soft delete by setting 'deleted_ts' field, if deleteHard is false;
+//  Otherwise delete from the hard disk, if it is not soft deleted (see ForceDelete).
+func (t *Table[T]) DeleteByPrimary(ctx context.Context, key T, deleteHard bool, tx ...*sqlx.Tx) error {
+	return t.delete(ctx, key, "", deleteHard, tx...)
+}
+
+// DeleteByUnique deletes a row in database by the uniqueField key of key.
+// NOTE:
+//  With cache layer;
+//  uniqueField must be db field style (snake format);
+//  Soft delete by setting 'deleted_ts' field, if deleteHard is false;
+//  Otherwise delete from the hard disk, if it is not soft deleted (see ForceDelete).
+func (t *Table[T]) DeleteByUnique(ctx context.Context, key T, uniqueField string, deleteHard bool, tx ...*sqlx.Tx) error {
+	return t.delete(ctx, key, uniqueField, deleteHard, tx...)
+}
+
+func (t *Table[T]) delete(ctx context.Context, key T, uniqueField string, deleteHard bool, tx ...*sqlx.Tx) error {
+	if deleteHard {
+		// Immediately delete from the hard disk.
+		return t.forceDelete(ctx, key, uniqueField, true, tx...)
+	}
+	// Delay delete from the hard disk.
+	return t.setDeleted(ctx, key, uniqueField, true, tx...)
+}
+
+// GetByPrimary queries a row by the primary key of key, and fills the result into key.
+// NOTE:
+//  With cache layer;
+//  If @return bool=false error=nil, means the data is not exist.
+func (t *Table[T]) GetByPrimary(ctx context.Context, key T) (T, bool, error) {
+	return t.cacheGet(ctx, key)
+}
+
+// GetByUnique queries a row by the uniqueField key of key, and fills the result into key.
+// NOTE:
+//  With cache layer;
+//  uniqueField must be db field style (snake format);
+//  If @return bool=false error=nil, means the data is not exist.
+func (t *Table[T]) GetByUnique(ctx context.Context, key T, uniqueField string) (T, bool, error) {
+	return t.cacheGet(ctx, key, uniqueField)
+}
+
+func (t *Table[T]) cacheGet(ctx context.Context, key T, fields ...string) (T, bool, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, false, err
+	}
+	v, err := t.structElem(key)
+	if err != nil {
+		return zero, false, err
+	}
+	err = t.CacheGet(key, fields...)
+	switch err {
+	case nil:
+		if !t.isLive(v) {
+			return zero, false, nil
+		}
+		return key, true, nil
+	case sql.ErrNoRows:
+		return zero, false, nil
+	default:
+		return zero, false, err
+	}
+}
+
+// GetWhere queries a row from database by WHERE condition.
+// NOTE:
+//  Without cache layer;
+//  Automatic filter the soft deleted rows;
+//  If @return bool=false error=nil, means the data is not exist.
+func (t *Table[T]) GetWhere(ctx context.Context, whereCond string, args ...interface{}) (T, bool, error) {
+	obj := t.New()
+	err := t.DB.GetContext(ctx, obj, t.queries.selectAll+t.whereSQL(whereCond)+" LIMIT 1;", args...)
+	return t.getResult(obj, err)
+}
+
+// SelectWhere queries some rows from database by WHERE condition.
+// NOTE:
+//  Without cache layer;
+//  Automatic filter the soft deleted rows.
+func (t *Table[T]) SelectWhere(ctx context.Context, whereCond string, args ...interface{}) ([]T, error) {
+	var objs []T
+	err := t.DB.SelectContext(ctx, &objs, t.queries.selectAll+t.whereSQL(whereCond), args...)
+	return objs, err
+}
+
+// CountWhere counts the rows in database by WHERE condition.
+// NOTE:
+//  Without cache layer;
+//  Automatic filter the soft deleted rows.
+func (t *Table[T]) CountWhere(ctx context.Context, whereCond string, args ...interface{}) (int64, error) {
+	var count int64
+	err := t.DB.GetContext(ctx, &count, "SELECT count(*) FROM `"+t.tableName+"`"+t.whereSQL(whereCond), args...)
+	return count, err
+}
+
+// EachWhere streams the rows matching whereCond into fn one by one, in batches by primary key.
+// NOTE:
+//  Without cache layer;
+//  Automatic filter the soft deleted rows;
+//  whereCond must be a pure condition without ORDER BY, LIMIT, etc.
+func (t *Table[T]) EachWhere(ctx context.Context, fn func(T) error, whereCond string, args ...interface{}) error {
+	if !t.withDeleted {
+		whereCond = insertZeroDeletedTs(whereCond, t.roles.DeletedTs)
+	}
+	it := NewIter[T](ctx, t.CacheableDB, whereCond, args...)
+	defer it.Close()
+	for it.Next() {
+		if err := fn(it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// GetByQuery queries a row from database by the query builder.
+// NOTE:
+//  Without cache layer;
+//  The table, columns, 'deleted_ts' filter and 'LIMIT 1' are set automatically;
+//  If @return bool=false error=nil, means the data is not exist.
+func (t *Table[T]) GetByQuery(ctx context.Context, q *builder.Query) (T, bool, error) {
+	query, args, err := t.query(q).Limit(1).ToSQL()
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+	obj := t.New()
+	err = t.DB.GetContext(ctx, obj, query, args...)
+	return t.getResult(obj, err)
+}
+
+// SelectByQuery queries some rows from database by the query builder.
+// NOTE:
+//  Without cache layer;
+//  The table, columns and 'deleted_ts' filter are set automatically.
+func (t *Table[T]) SelectByQuery(ctx context.Context, q *builder.Query) ([]T, error) {
+	query, args, err := t.query(q).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	var objs []T
+	err = t.DB.SelectContext(ctx, &objs, query, args...)
+	return objs, err
+}
+
+// CountByQuery counts the rows in database by the query builder.
+// NOTE:
+//  Without cache layer;
+//  The table and 'deleted_ts' filter are set automatically.
+func (t *Table[T]) CountByQuery(ctx context.Context, q *builder.Query) (int64, error) {
+	query, args, err := t.query(q).CountSQL()
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = t.DB.GetContext(ctx, &count, query, args...)
+	return count, err
+}
+
+func (t *Table[T]) query(q *builder.Query) *builder.Query {
+	if q == nil {
+		q = builder.New()
+	}
+	var cols = make([]builder.Column, len(t.cols))
+	for i, col := range t.cols {
+		cols[i] = builder.Column(col)
+	}
+	q = q.Clone().From(t.tableName).Select(cols...)
+	if t.roles.DeletedTs != "" && !t.withDeleted {
+		q = q.SoftDelete(builder.Column(t.roles.DeletedTs))
+	}
+	return q
+}
+
+func (t *Table[T]) getResult(obj T, err error) (T, bool, error) {
+	var zero T
+	switch err {
+	case nil:
+		return obj, true, nil
+	case sql.ErrNoRows:
+		return zero, false, nil
+	default:
+		return zero, false, err
+	}
+}
+
+func (t *Table[T]) structElem(obj T) (reflect.Value, error) {
+	v := reflect.ValueOf(obj)
+	if typeName := v.Type().String(); typeName != t.typeName {
+		return emptyValue, errors.New("unmatch Cacheable: want " + t.typeName + ", have " + typeName)
+	}
+	if v.IsNil() {
+		return emptyValue, errors.New("nil " + t.typeName)
+	}
+	return v.Elem(), nil
+}
+
+// isLive returns whether the row read from cache is an existing row.
+func (c *CacheableDB) isLive(structElemValue reflect.Value) bool {
+	if i, ok := c.fieldsIndexMap[c.roles.CreatedAt]; ok && structElemValue.Field(i).Int() == 0 {
+		return false
+	}
+	return true
+}
+
+// insertSQL returns the named 'INSERT' statement without terminator,
+// and whether the primary key should be generated by mysql.
+func (c *CacheableDB) insertSQL(structElemValue reflect.Value) (string, bool) {
+	zeroPri := true
+	for _, idx := range c.priFieldsIndex {
+		if !structElemValue.Field(idx).IsZero() {
+			zeroPri = false
+			break
+		}
+	}
+	autoID := zeroPri && c.isAutoIncrement([]reflect.Value{structElemValue})
+	if zeroPri {
+		return c.queries.insertNoPri, autoID
+	}
+	return c.queries.insert, autoID
+}
+
+func (c *CacheableDB) createInsertSQL(omitPri bool) string {
+	var (
+		cols  = make([]string, 0, len(c.cols))
+		isPri = make(map[string]bool, len(c.priCols))
+	)
+	for _, col := range c.priCols {
+		isPri[col] = true
+	}
+	for _, col := range c.cols {
+		if (col == c.roles.DeletedTs) || (omitPri && isPri[col]) {
+			continue
+		}
+		cols = append(cols, col)
+	}
+	return "INSERT INTO `" + c.tableName + "` (`" + strings.Join(cols, "`,`") + "`)VALUES(:" + strings.Join(cols, ",:") + ")"
+}
+
+// setColumns returns the 'SET' assignments of updateFields, e.g. "`name`=:name";
+// Skips the primary keys, 'created_at', 'updated_at', 'deleted_ts' and exclude fields,
+// then appends 'updated_at' if there are assignments.
+func (c *CacheableDB) setColumns(updateFields []string, op, closing string, exclude ...string) []string {
+	var (
+		skip = make(map[string]bool, len(c.priCols)+len(exclude)+3)
+		sets []string
+	)
+	for _, col := range c.priCols {
+		skip[col] = true
+	}
+	for _, col := range exclude {
+		skip[col] = true
+	}
+	skip[c.roles.CreatedAt], skip[c.roles.UpdatedAt], skip[c.roles.DeletedTs] = true, true, true
+	if len(updateFields) == 0 {
+		updateFields = c.cols
+	}
+	for _, col := range updateFields {
+		if skip[col] {
+			continue
+		}
+		sets = append(sets, "`"+col+"`"+op+col+closing)
+	}
+	if col := c.roles.UpdatedAt; len(sets) > 0 && col != "" {
+		sets = append(sets, "`"+col+"`"+op+col+closing)
+	}
+	return sets
+}
+
+func (c *CacheableDB) selectSQL() string {
+	return "SELECT `" + strings.Join(c.cols, "`,`") + "` FROM `" + c.tableName + "`"
+}
+
+func (c *CacheableDB) whereSQL(whereCond string) string {
+	if !c.withDeleted {
+		whereCond = insertZeroDeletedTs(whereCond, c.roles.DeletedTs)
+	} else {
+		whereCond = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(whereCond), ";"))
+	}
+	if whereCond == "" {
+		return ""
+	}
+	if i := index(whereCond, "ORDER BY", "order by", "GROUP BY", "group by", "LIMIT", "limit"); i == 0 {
+		return " " + whereCond
+	}
+	return " WHERE " + whereCond
+}
+
+// insertZeroDeletedTs inserts the "`deletedTsCol`=0" condition into whereCond,
+// if it does not contain the deletedTsCol condition yet.
+func insertZeroDeletedTs(whereCond string, deletedTsCol string) string {
+	whereCond = strings.TrimSpace(whereCond)
+	whereCond = strings.TrimSpace(strings.TrimRight(whereCond, ";"))
+	if deletedTsCol == "" || index(whereCond, "`"+deletedTsCol+"`", " "+deletedTsCol, "("+deletedTsCol) != -1 ||
+		strings.HasPrefix(whereCond, deletedTsCol) {
+		return whereCond
+	}
+	var cond = "`" + deletedTsCol + "`=0"
+	i := index(
+		whereCond,
+		"ORDER BY", "order by",
+		"GROUP BY", "group by",
+		"OFFSET", "offset",
+		"LIMIT", "limit",
+	)
+	switch i {
+	case -1:
+		if whereCond == "" {
+			return cond
+		}
+		return "(" + whereCond + ") AND " + cond
+	case 0:
+		return cond + " " + whereCond
+	default:
+		return "(" + strings.TrimSpace(whereCond[:i]) + ") AND " + cond + " " + whereCond[i:]
+	}
+}
+
+func index(s string, sub ...string) int {
+	var i, ii = -1, -1
+	for _, ss := range sub {
+		ii = strings.Index(s, ss)
+		if ii != -1 && (ii < i || i == -1) {
+			i = ii
+		}
+	}
+	return i
+}
@@ -0,0 +1,40 @@
+package mysql
+
+import "testing"
+
+func TestInsertZeroDeletedTs(t *testing.T) {
+	var cases = []struct {
+		whereCond    string
+		deletedTsCol string
+		want         string
+	}{
+		{"", "deleted_ts", "`deleted_ts`=0"},
+		{"", "", ""},
+		{"id=?;", "deleted_ts", "(id=?) AND `deleted_ts`=0"},
+		{"a=? OR b=? ORDER BY id LIMIT 10", "deleted_ts", "(a=? OR b=?) AND `deleted_ts`=0 ORDER BY id LIMIT 10"},
+		{"ORDER BY id", "deleted_ts", "`deleted_ts`=0 ORDER BY id"},
+		{"id=? AND `deleted_ts`>0", "deleted_ts", "id=? AND `deleted_ts`>0"},
+		{"deleted_ts>0", "deleted_ts", "deleted_ts>0"},
+		{"id=?", "", "id=?"},
+	}
+	for _, c := range cases {
+		if got := insertZeroDeletedTs(c.whereCond, c.deletedTsCol); got != c.want {
+			t.Errorf("insertZeroDeletedTs(%q, %v) = %q, want %q", c.whereCond, c.deletedTsCol, got, c.want)
+		}
+	}
+}
+
+func TestDeleteSQL(t *testing.T) {
+	c := &CacheableDB{tableName: "user", roles: ColumnRoles{DeletedTs: "deleted_ts"}}
+	where := []string{"`id`=?"}
+	if got, want := c.deleteSQL(where, true), "DELETE FROM `user` WHERE `id`=? AND `deleted_ts`=0;"; got != want {
+		t.Errorf("deleteSQL(live) = %q, want %q", got, want)
+	}
+	if got, want := c.deleteSQL(where, false), "DELETE FROM `user` WHERE `id`=?;"; got != want {
+		t.Errorf("deleteSQL() = %q, want %q", got, want)
+	}
+	c.roles.DeletedTs = ""
+	if got, want := c.deleteSQL(where, true), "DELETE FROM `user` WHERE `id`=?;"; got != want {
+		t.Errorf("deleteSQL(live) without 'deleted_ts' = %q, want %q", got, want)
+	}
+}
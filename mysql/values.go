@@ -3,23 +3,54 @@ package mysql
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
 var (
 	emptyObjectValue = []byte("{}")
 	emptyArrayValue  = []byte("[]")
+	nullValue        = []byte("null")
 )
 
+// columnBytes returns the bytes of the column value, nil if the value is NULL.
+func columnBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported column value type %T", value)
+	}
+}
+
+// scanJSON decodes the JSON column value into dest, sets dest to zero if the value is NULL or empty.
+func scanJSON[T any](value interface{}, dest *T) error {
+	data, err := columnBytes(value)
+	if err != nil {
+		return err
+	}
+	var v T
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+	}
+	*dest = v
+	return nil
+}
+
 // Int32s db column value type.
 type Int32s []int32
 
 // Scan implements the sql.Scanner interface.
 func (i *Int32s) Scan(value interface{}) error {
-	data, ok := value.([]byte)
-	if !ok {
-		return nil
-	}
-	return json.Unmarshal(data, i)
+	return scanJSON(value, i)
 }
 
 // Value implements the driver.Valuer interface.
@@ -35,11 +66,7 @@ type Int64s []int64
 
 // Scan implements the sql.Scanner interface.
 func (i *Int64s) Scan(value interface{}) error {
-	data, ok := value.([]byte)
-	if !ok {
-		return nil
-	}
-	return json.Unmarshal(data, i)
+	return scanJSON(value, i)
 }
 
 // Value implements the driver.Valuer interface.
@@ -50,16 +77,44 @@ func (i Int64s) Value() (driver.Value, error) {
 	return json.Marshal(i)
 }
 
+// Uint64s db column value type.
+type Uint64s []uint64
+
+// Scan implements the sql.Scanner interface.
+func (u *Uint64s) Scan(value interface{}) error {
+	return scanJSON(value, u)
+}
+
+// Value implements the driver.Valuer interface.
+func (u Uint64s) Value() (driver.Value, error) {
+	if u == nil {
+		return emptyArrayValue, nil
+	}
+	return json.Marshal(u)
+}
+
+// Float64s db column value type.
+type Float64s []float64
+
+// Scan implements the sql.Scanner interface.
+func (f *Float64s) Scan(value interface{}) error {
+	return scanJSON(value, f)
+}
+
+// Value implements the driver.Valuer interface.
+func (f Float64s) Value() (driver.Value, error) {
+	if f == nil {
+		return emptyArrayValue, nil
+	}
+	return json.Marshal(f)
+}
+
 // Strings db column value type.
 type Strings []string
 
 // Scan implements the sql.Scanner interface.
 func (s *Strings) Scan(value interface{}) error {
-	data, ok := value.([]byte)
-	if !ok {
-		return nil
-	}
-	return json.Unmarshal(data, s)
+	return scanJSON(value, s)
 }
 
 // Value implements the driver.Valuer interface.
@@ -75,11 +130,7 @@ type Int8IFaceMap map[int8]interface{}
 
 // Scan implements the sql.Scanner interface.
 func (i *Int8IFaceMap) Scan(value interface{}) error {
-	data, ok := value.([]byte)
-	if !ok {
-		return nil
-	}
-	return json.Unmarshal(data, i)
+	return scanJSON(value, i)
 }
 
 // Value implements the driver.Valuer interface.
@@ -95,11 +146,7 @@ type IntStringMap map[int]string
 
 // Scan implements the sql.Scanner interface.
 func (i *IntStringMap) Scan(value interface{}) error {
-	data, ok := value.([]byte)
-	if !ok {
-		return nil
-	}
-	return json.Unmarshal(data, i)
+	return scanJSON(value, i)
 }
 
 // Value implements the driver.Valuer interface.
@@ -109,3 +156,235 @@ func (i IntStringMap) Value() (driver.Value, error) {
 	}
 	return json.Marshal(i)
 }
+
+// JSON db column value type, stores V as JSON.
+// NOTE:
+//  It is encoded as V itself in JSON, e.g. in the cache;
+//  NULL is scanned as the zero value of T.
+type JSON[T any] struct {
+	V T
+}
+
+// Scan implements the sql.Scanner interface.
+func (j *JSON[T]) Scan(value interface{}) error {
+	return scanJSON(value, &j.V)
+}
+
+// Value implements the driver.Valuer interface.
+func (j JSON[T]) Value() (driver.Value, error) {
+	return json.Marshal(j.V)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (j JSON[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.V)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (j *JSON[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &j.V)
+}
+
+// NullJSON nullable db column value type, stores V as JSON, or NULL if Valid is false.
+// NOTE:
+//  It is encoded as V itself in JSON, or null if Valid is false.
+type NullJSON[T any] struct {
+	V     T
+	Valid bool // Valid is true if V is not NULL
+}
+
+// Scan implements the sql.Scanner interface.
+func (n *NullJSON[T]) Scan(value interface{}) error {
+	data, err := columnBytes(value)
+	if err != nil {
+		return err
+	}
+	var v T
+	if data == nil {
+		n.V, n.Valid = v, false
+		return nil
+	}
+	if err = json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	n.V, n.Valid = v, true
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (n NullJSON[T]) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return json.Marshal(n.V)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (n NullJSON[T]) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return nullValue, nil
+	}
+	return json.Marshal(n.V)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (n *NullJSON[T]) UnmarshalJSON(data []byte) error {
+	var v T
+	if string(data) == "null" {
+		n.V, n.Valid = v, false
+		return nil
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	n.V, n.Valid = v, true
+	return nil
+}
+
+// Set db column value type of the mysql SET column, e.g. 'a,b'.
+type Set []string
+
+// Scan implements the sql.Scanner interface.
+func (s *Set) Scan(value interface{}) error {
+	data, err := columnBytes(value)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		*s = nil
+		return nil
+	}
+	*s = strings.Split(string(data), ",")
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (s Set) Value() (driver.Value, error) {
+	for _, member := range s {
+		if strings.Contains(member, ",") {
+			return nil, fmt.Errorf("Set.Value(): member contains comma: %q", member)
+		}
+	}
+	return strings.Join(s, ","), nil
+}
+
+// Has returns whether member is in the set.
+func (s Set) Has(member string) bool {
+	for _, m := range s {
+		if m == member {
+			return true
+		}
+	}
+	return false
+}
+
+// Bitmask db column value type of the BIGINT UNSIGNED column, used as 64 flags.
+type Bitmask uint64
+
+// Scan implements the sql.Scanner interface.
+func (b *Bitmask) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		*b = Bitmask(v)
+		return nil
+	case uint64:
+		*b = Bitmask(v)
+		return nil
+	}
+	data, err := columnBytes(value)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		*b = 0
+		return nil
+	}
+	u, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Bitmask.Scan(): %s", err.Error())
+	}
+	*b = Bitmask(u)
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (b Bitmask) Value() (driver.Value, error) {
+	if b > math.MaxInt64 {
+		return strconv.FormatUint(uint64(b), 10), nil
+	}
+	return int64(b), nil
+}
+
+// Has returns whether the bit (0~63) is set.
+func (b Bitmask) Has(bit uint) bool {
+	return b&(1<<bit) != 0
+}
+
+// Set returns the bitmask with the bit (0~63) set.
+func (b Bitmask) Set(bit uint) Bitmask {
+	return b | 1<<bit
+}
+
+// Clear returns the bitmask with the bit (0~63) cleared.
+func (b Bitmask) Clear(bit uint) Bitmask {
+	return b &^ (1 << bit)
+}
+
+// Decimal db column value type of the DECIMAL column, keeps the exact digits as string.
+// NOTE:
+//  Empty means 0.
+type Decimal string
+
+// Scan implements the sql.Scanner interface.
+func (d *Decimal) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		*d = Decimal(strconv.FormatInt(v, 10))
+		return nil
+	case float64:
+		*d = Decimal(strconv.FormatFloat(v, 'f', -1, 64))
+		return nil
+	}
+	data, err := columnBytes(value)
+	if err != nil {
+		return err
+	}
+	*d = Decimal(data)
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (d Decimal) Value() (driver.Value, error) {
+	if d == "" {
+		return "0", nil
+	}
+	if !isDecimal(string(d)) {
+		return nil, fmt.Errorf("Decimal.Value(): invalid decimal: %q", string(d))
+	}
+	return string(d), nil
+}
+
+// isDecimal returns whether s is like '-123.45'.
+func isDecimal(s string) bool {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	var digits, dots int
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.':
+			dots++
+		default:
+			return false
+		}
+	}
+	return digits > 0 && dots <= 1
+}
+
+// Float64 returns the float64 value, which may lose precision.
+func (d Decimal) Float64() (float64, error) {
+	if d == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(string(d), 64)
+}
@@ -0,0 +1,68 @@
+package mysql
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestScanValues(t *testing.T) {
+	var i64s Int64s
+	for _, value := range []interface{}{[]byte("[1,2]"), "[1,2]"} {
+		if err := i64s.Scan(value); err != nil || !reflect.DeepEqual(i64s, Int64s{1, 2}) {
+			t.Fatalf("Int64s.Scan(%#v) = %v, %v", value, i64s, err)
+		}
+	}
+	if err := i64s.Scan(nil); err != nil || i64s != nil {
+		t.Fatalf("Int64s.Scan(nil) = %v, %v", i64s, err)
+	}
+	if err := i64s.Scan(int64(1)); err == nil {
+		t.Fatal("Int64s.Scan(int64) returns nil error")
+	}
+
+	type meta struct {
+		Tags []string `json:"tags"`
+	}
+	var j JSON[meta]
+	if err := j.Scan(`{"tags":["a"]}`); err != nil || !reflect.DeepEqual(j.V.Tags, []string{"a"}) {
+		t.Fatalf("JSON.Scan() = %v, %v", j, err)
+	}
+	if b, _ := json.Marshal(j); string(b) != `{"tags":["a"]}` {
+		t.Fatalf("json.Marshal(JSON) = %s", b)
+	}
+
+	var n NullJSON[[]int]
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Fatalf("NullJSON.Scan(nil) = %v, %v", n, err)
+	}
+	if v, _ := n.Value(); v != nil {
+		t.Fatalf("NullJSON.Value() of NULL = %v", v)
+	}
+	if err := json.Unmarshal([]byte("[1]"), &n); err != nil || !n.Valid || n.V[0] != 1 {
+		t.Fatalf("json.Unmarshal(NullJSON) = %v, %v", n, err)
+	}
+
+	var s Set
+	if err := s.Scan([]byte("a,b")); err != nil || !s.Has("b") || s.Has("c") {
+		t.Fatalf("Set.Scan() = %v, %v", s, err)
+	}
+	if _, err := (Set{"a,b"}).Value(); err == nil {
+		t.Fatal("Set.Value() with comma returns nil error")
+	}
+
+	var b Bitmask
+	if err := b.Scan([]byte("5")); err != nil || !b.Has(0) || b.Has(1) || !b.Has(2) {
+		t.Fatalf("Bitmask.Scan() = %v, %v", b, err)
+	}
+	if b = b.Set(1).Clear(0); b != 6 {
+		t.Fatalf("Bitmask.Set().Clear() = %d", b)
+	}
+
+	var d Decimal
+	if err := d.Scan([]byte("12.3400")); err != nil || d != "12.3400" {
+		t.Fatalf("Decimal.Scan() = %v, %v", d, err)
+	}
+	if _, err := Decimal("1e3").Value(); err == nil {
+		t.Fatal("Decimal.Value() of invalid decimal returns nil error")
+	}
+}
@@ -0,0 +1,186 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/gutil"
+)
+
+// WarmOptions the options of warming up the caches.
+type WarmOptions struct {
+	// BatchSize the number of rows per query and per redis pipeline, default is Config.MaxBatchRows.
+	BatchSize int
+	// UniqueKeys the fields of the unique keys to cache besides the primary key, e.g. [][]string{{"email"}}.
+	UniqueKeys [][]string
+	// RowsPerSecond the maximum number of rows to warm per second, 0 means no limit.
+	RowsPerSecond int
+	// Jitter the maximum fraction of the cache expiration added to each TTL at random, e.g. 0.1 for +10%,
+	// so that the warmed keys do not expire at the same time.
+	Jitter float64
+	// OnProgress is called after each batch, optional.
+	OnProgress func(WarmProgress)
+}
+
+// WarmProgress the progress of warming up the caches of a table.
+type WarmProgress struct {
+	Table   string
+	Rows    int64 // the number of rows read
+	Keys    int64 // the number of keys set
+	Elapsed time.Duration
+}
+
+// warmEntry one key to set.
+type warmEntry struct {
+	key   string
+	value interface{}
+}
+
+// Warm streams the rows matching whereCond in batches by primary key, and caches them by pipelined SETs,
+// e.g. after a redis flush or failover.
+// NOTE:
+//  whereCond must be a pure condition without ORDER BY, LIMIT, etc. empty means all rows;
+//  The secondary caches of opts.UniqueKeys are set too;
+//  Overwrites the existing caches, the rows changed during warming may be cached stale until they are written again;
+//  Returns the progress so far and ctx.Err() if ctx is done.
+func (c *CacheableDB) Warm(ctx context.Context, whereCond string, args []interface{}, opts *WarmOptions) (WarmProgress, error) {
+	if opts == nil {
+		opts = new(WarmOptions)
+	}
+	var (
+		start    = time.Now()
+		progress = WarmProgress{Table: c.tableName}
+	)
+	if c.DB.dbConfig.NoCache {
+		return progress, nil
+	}
+	uniqueKeys, err := c.warmUniqueKeys(opts.UniqueKeys)
+	if err != nil {
+		return progress, err
+	}
+	it := c.newBatchIter(ctx, whereCond, args)
+	defer it.close()
+	if opts.BatchSize > 0 {
+		it.batchSize = opts.BatchSize
+	}
+
+	rows := make([]reflect.Value, 0, it.batchSize)
+	flush := func() error {
+		entries, err := c.warmEntries(rows, uniqueKeys)
+		if err != nil {
+			return err
+		}
+		_, err = c.Cache.Pipelined(func(p redis.Pipeliner) error {
+			for _, e := range entries {
+				p.Set(e.key, e.value, jitterTTL(c.cacheExpiration, opts.Jitter))
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Warm(): %s", err.Error())
+		}
+		progress.Rows += int64(len(rows))
+		progress.Keys += int64(len(entries))
+		progress.Elapsed = time.Since(start)
+		rows = rows[:0]
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+		if opts.RowsPerSecond <= 0 {
+			return nil
+		}
+		wait := time.Duration(float64(progress.Rows)/float64(opts.RowsPerSecond)*float64(time.Second)) - progress.Elapsed
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+			return nil
+		}
+	}
+	for it.next() {
+		rows = append(rows, reflect.ValueOf(it.value()).Elem())
+		if len(rows) < it.batchSize {
+			continue
+		}
+		if err = flush(); err != nil {
+			return progress, err
+		}
+	}
+	if it.err != nil {
+		return progress, it.err
+	}
+	if len(rows) > 0 {
+		err = flush()
+	}
+	return progress, err
+}
+
+// warmUniqueKeys returns the unique keys in db field style, without the primary key.
+func (c *CacheableDB) warmUniqueKeys(uniqueKeys [][]string) ([][]string, error) {
+	var keys = make([][]string, 0, len(uniqueKeys))
+	for _, fields := range uniqueKeys {
+		if len(fields) == 0 {
+			continue
+		}
+		snake := make([]string, len(fields))
+		for i, field := range fields {
+			snake[i] = gutil.SnakeString(field)
+			if _, ok := c.fieldsIndexMap[snake[i]]; !ok {
+				return nil, fmt.Errorf("Warm(): table '%s' has no field '%s'", c.tableName, field)
+			}
+		}
+		keys = append(keys, snake)
+	}
+	return keys, nil
+}
+
+// warmEntries returns the primary key caches and the secondary caches of the rows.
+func (c *CacheableDB) warmEntries(rows []reflect.Value, uniqueKeys [][]string) ([]warmEntry, error) {
+	var entries = make([]warmEntry, 0, len(rows)*(1+len(uniqueKeys)))
+	for _, v := range rows {
+		priKey, err := c.createPrikey(v)
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.marshalCache(v.Addr().Interface())
+		if err != nil {
+			return nil, fmt.Errorf("Warm(): %s", err.Error())
+		}
+		entries = append(entries, warmEntry{key: priKey, value: data})
+		for _, fields := range uniqueKeys {
+			values := make([]interface{}, len(fields))
+			for i, field := range fields {
+				if values[i], err = c.fieldLookupValue(v, field); err != nil {
+					return nil, fmt.Errorf("Warm(): %s", err.Error())
+				}
+			}
+			key, err := c.CreateCacheKeyByFields(fields, values)
+			if err != nil {
+				return nil, err
+			}
+			if key != priKey {
+				entries = append(entries, warmEntry{key: key, value: priKey})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// jitterTTL returns the expiration plus a random duration up to jitter*expiration.
+func jitterTTL(expiration time.Duration, jitter float64) time.Duration {
+	if expiration <= 0 || jitter <= 0 {
+		return expiration
+	}
+	max := int64(float64(expiration) * jitter)
+	if max <= 0 {
+		return expiration
+	}
+	return expiration + time.Duration(rand.Int63n(max+1))
+}
@@ -0,0 +1,69 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xmodel/redis"
+	"github.com/swxctx/xmodel/sqlx"
+	"github.com/swxctx/xmodel/sqlx/reflectx"
+)
+
+func TestWarmEntries(t *testing.T) {
+	d := &DB{
+		DB:           &sqlx.DB{Mapper: reflectx.NewMapperFunc("json", gutil.SnakeString)},
+		dbConfig:     &Config{Database: "shop"},
+		Cache:        &redis.Client{},
+		cacheableDBs: make(map[string]*CacheableDB),
+	}
+	// the struct built at runtime, e.g. by 'xmodel cache warm'
+	structType := reflect.PtrTo(reflect.StructOf([]reflect.StructField{
+		{Name: "Id", Type: reflect.TypeOf(int64(0)), Tag: `json:"id" key:"pri"`},
+		{Name: "Email", Type: reflect.TypeOf(""), Tag: `json:"email" key:"uni"`},
+	}))
+	c, err := d.RegCacheableType("member", structType, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.warmUniqueKeys([][]string{{"phone"}}); err == nil {
+		t.Fatal("warmUniqueKeys() of the unknown field returns nil error")
+	}
+	uniqueKeys, err := c.warmUniqueKeys([][]string{{"Email"}, {"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := reflect.New(structType.Elem()).Elem()
+	row.Field(0).SetInt(1)
+	row.Field(1).SetString("a@b.c")
+	entries, err := c.warmEntries([]reflect.Value{row}, uniqueKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []warmEntry{
+		{key: "shop:member:id[1]", value: []byte(`{"id":1,"email":"a@b.c"}`)},
+		{key: `shop:member:email["a@b.c"]`, value: "shop:member:id[1]"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("warmEntries() = %q\nwant %q", entries, want)
+	}
+}
+
+func TestJitterTTL(t *testing.T) {
+	if ttl := jitterTTL(time.Minute, 0); ttl != time.Minute {
+		t.Fatalf("jitterTTL() without jitter = %s", ttl)
+	}
+	var jittered bool
+	for i := 0; i < 100; i++ {
+		ttl := jitterTTL(time.Minute, 0.1)
+		if ttl < time.Minute || ttl > time.Minute+6*time.Second {
+			t.Fatalf("jitterTTL() = %s", ttl)
+		}
+		jittered = jittered || ttl != time.Minute
+	}
+	if !jittered {
+		t.Fatal("jitterTTL() is not jittered")
+	}
+}
@@ -0,0 +1,186 @@
+package redis
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+const (
+	// bloomMaxBits the maximum size of a redis bitmap
+	bloomMaxBits = 1 << 32
+	// bloomMaxHashes the maximum number of the hash functions
+	bloomMaxHashes = 30
+	// bloomRebuildTTL the expiration of the bitmap being rebuilt, refreshed by every add
+	bloomRebuildTTL = 10 * time.Minute
+	// bloomBatchSize the maximum number of the items per script call
+	bloomBatchSize = 1000
+)
+
+// BloomFilter a bloom filter on a redis bitmap by SETBIT/GETBIT with k hash functions.
+// NOTE:
+//  The filter takes effect after the first Rebuild, before it, or if the bitmap is lost,
+//  Exists returns true and Add does nothing, so a partial filter never reports an existing item as absent.
+type BloomFilter struct {
+	c          *Client
+	key        string
+	rebuildKey string
+	bits       uint64
+	hashes     int
+}
+
+// NewBloomFilter creates a bloom filter named name in the module, sized for expected items at the false positive rate fpRate.
+// NOTE:
+//  The keys are 'module:{name}' and 'module:{name}:rebuild', the hash tag keeps them in one cluster slot;
+//  If expected <= 0, it is 1; if fpRate is not in (0, 1), it is 0.01;
+//  The bitmap is 2^32 bits at most, about 1.44*log2(1/fpRate) bits per item.
+func NewBloomFilter(c *Client, m *Module, name string, expected int64, fpRate float64) *BloomFilter {
+	if expected <= 0 {
+		expected = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	n := float64(expected)
+	bits := math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	if bits > bloomMaxBits {
+		bits = bloomMaxBits
+	}
+	hashes := int(math.Round(bits / n * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	} else if hashes > bloomMaxHashes {
+		hashes = bloomMaxHashes
+	}
+	key := m.Key("{" + name + "}")
+	return &BloomFilter{
+		c:          c,
+		key:        key,
+		rebuildKey: key + ":rebuild",
+		bits:       uint64(bits),
+		hashes:     hashes,
+	}
+}
+
+// Key returns the redis key of the bitmap.
+func (f *BloomFilter) Key() string {
+	return f.key
+}
+
+// Bits returns the size of the bitmap.
+func (f *BloomFilter) Bits() uint64 {
+	return f.bits
+}
+
+// Hashes returns the number of the hash functions.
+func (f *BloomFilter) Hashes() int {
+	return f.hashes
+}
+
+// offsets returns the bit offsets of item, by double hashing of the 128-bit FNV-1a.
+func (f *BloomFilter) offsets(item string, dst []interface{}) []interface{} {
+	h := fnv.New128a()
+	h.Write([]byte(item))
+	sum := h.Sum(nil)
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[i+8])
+	}
+	h2 |= 1
+	for i := 0; i < f.hashes; i++ {
+		dst = append(dst, (h1+uint64(i)*h2)%f.bits)
+	}
+	return dst
+}
+
+// Add adds the items, to the bitmap being rebuilt as well.
+func (f *BloomFilter) Add(items ...string) error {
+	for len(items) > 0 {
+		n := len(items)
+		if n > bloomBatchSize {
+			n = bloomBatchSize
+		}
+		offsets := make([]interface{}, 0, n*f.hashes)
+		for _, item := range items[:n] {
+			offsets = f.offsets(item, offsets)
+		}
+		if err := bloomAddScript.Run(f.c, []string{f.key, f.rebuildKey}, offsets...).Err(); err != nil {
+			return err
+		}
+		items = items[n:]
+	}
+	return nil
+}
+
+// Exists returns false if item is surely not added, true if it may be added.
+func (f *BloomFilter) Exists(item string) (bool, error) {
+	n, err := bloomExistsScript.Run(f.c, []string{f.key}, f.offsets(item, nil)...).Int()
+	return n == 1, err
+}
+
+// Rebuild replaces the bitmap with a new one filled by fill, which calls add with all the items.
+// NOTE:
+//  The new bitmap replaces the old one by RENAME after fill returns nil, Exists uses the old one meanwhile;
+//  The items added by Add during the rebuild are added to both;
+//  The new bitmap expires if add is not called for 10 minutes, then Rebuild fails.
+func (f *BloomFilter) Rebuild(fill func(add func(items ...string) error) error) error {
+	pipe := f.c.TxPipeline()
+	defer pipe.Close()
+	pipe.Del(f.rebuildKey)
+	pipe.SetBit(f.rebuildKey, int64(f.bits-1), 0)
+	pipe.PExpire(f.rebuildKey, bloomRebuildTTL)
+	if _, err := pipe.Exec(); err != nil {
+		return err
+	}
+	err := fill(func(items ...string) error {
+		pipe := f.c.Pipeline()
+		defer pipe.Close()
+		offsets := make([]interface{}, 0, f.hashes)
+		for _, item := range items {
+			for _, offset := range f.offsets(item, offsets[:0]) {
+				pipe.SetBit(f.rebuildKey, int64(offset.(uint64)), 1)
+			}
+		}
+		pipe.PExpire(f.rebuildKey, bloomRebuildTTL)
+		_, err := pipe.Exec()
+		return err
+	})
+	if err != nil {
+		f.c.Del(f.rebuildKey)
+		return err
+	}
+	pipe = f.c.TxPipeline()
+	defer pipe.Close()
+	pipe.Rename(f.rebuildKey, f.key)
+	pipe.Persist(f.key)
+	_, err = pipe.Exec()
+	return err
+}
+
+// bloomAddScript sets the bits of ARGV in KEYS[1] and KEYS[2] if they exist.
+var bloomAddScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call("EXISTS", key) == 1 then
+		for _, offset in ipairs(ARGV) do
+			redis.call("SETBIT", key, offset, 1)
+		end
+	end
+end
+return 1
+`)
+
+// bloomExistsScript returns 1 if all the bits of ARGV are set in KEYS[1], or it does not exist.
+var bloomExistsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 1
+end
+for _, offset in ipairs(ARGV) do
+	if redis.call("GETBIT", KEYS[1], offset) == 0 then
+		return 0
+	end
+end
+return 1
+`)
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	_, c := newMiniClient(t)
+	f := NewBloomFilter(c, NewModule("test"), "users", 1000, 0.01)
+	if f.Key() != "test:{users}" || f.Bits() != 9586 || f.Hashes() != 7 {
+		t.Fatalf("Key() = %s, Bits() = %d, Hashes() = %d", f.Key(), f.Bits(), f.Hashes())
+	}
+
+	// not built yet
+	if err := f.Add("a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := f.Exists("x"); err != nil || !ok {
+		t.Fatalf("Exists() before Rebuild() = %v, %v", ok, err)
+	}
+	if n := c.Exists(f.Key()).Val(); n != 0 {
+		t.Fatal("Add() before Rebuild() creates the bitmap")
+	}
+
+	err := f.Rebuild(func(add func(items ...string) error) error {
+		for i := 0; i < 1000; i += 100 {
+			items := make([]string, 0, 100)
+			for j := i; j < i+100; j++ {
+				items = append(items, "member"+strconv.Itoa(j))
+			}
+			if err := add(items...); err != nil {
+				return err
+			}
+			if i == 500 {
+				// added by the others during the rebuild
+				if err := f.Add("during"); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if ok, err := f.Exists("member" + strconv.Itoa(i)); err != nil || !ok {
+			t.Fatalf("Exists() of an added item = %v, %v", ok, err)
+		}
+	}
+	if ok, _ := f.Exists("during"); !ok {
+		t.Fatal("the item added during Rebuild() is lost")
+	}
+	var positives int
+	for i := 0; i < 1000; i++ {
+		if ok, _ := f.Exists("other" + strconv.Itoa(i)); ok {
+			positives++
+		}
+	}
+	if positives > 30 {
+		t.Fatalf("%d false positives of 1000", positives)
+	}
+	if ttl := c.TTL(f.Key()).Val(); ttl >= 0 {
+		t.Fatalf("TTL() = %s", ttl)
+	}
+
+	// a failed rebuild keeps the bitmap
+	if err = f.Rebuild(func(add func(items ...string) error) error {
+		return errors.New("fill")
+	}); err == nil || err.Error() != "fill" {
+		t.Fatalf("Rebuild() = %v", err)
+	}
+	if ok, _ := f.Exists("member1"); !ok {
+		t.Fatal("the bitmap is lost after a failed Rebuild()")
+	}
+	if n := c.Exists(f.Key() + ":rebuild").Val(); n != 0 {
+		t.Fatal("the rebuilding bitmap is left")
+	}
+}
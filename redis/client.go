@@ -2,41 +2,53 @@
 package redis
 
 import (
-	"fmt"
+	"context"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/xmodel/retry"
 )
 
 type (
 	// Config redis (cluster) client config
 	Config struct {
-		// redis deploy type, [single, cluster]
+		// redis deploy type, [single, cluster, sentinel]
 		DeployType string `yaml:"deploy_type"`
 		// only for single node config, valid when DeployType=single.
 		ForSingle SingleConfig `yaml:"for_single"`
 		// only for cluster config, valid when DeployType=cluster.
 		ForCluster ClusterConfig `yaml:"for_cluster"`
+		// only for sentinel config, valid when DeployType=sentinel.
+		ForSentinel SentinelConfig `yaml:"for_sentinel,omitempty"`
 
+		// An optional username of the Redis 6 ACL, requires Password.
+		Username string `yaml:"username,omitempty"`
 		// An optional password. Must match the password specified in the
 		// requirepass server configuration option.
 		Password string `yaml:"password,omitempty"`
 
+		// An optional TLS config, TLS is enabled if it is set.
+		TLS *TLSConfig `yaml:"tls,omitempty"`
+
 		// The maximum number of retries before giving up.
 		// Default is to not retry failed commands.
 		MaxRetries int `yaml:"max_retries,omitempty"`
 
+		// The durations are written as '300ms', '5s', or integers of seconds in yaml.
+
 		// Dial timeout for establishing new connections.
 		// Default is 5 seconds.
-		DialTimeout int64 `yaml:"dial_timeout,omitempty"`
+		DialTimeout Duration `yaml:"dial_timeout,omitempty"`
 		// Timeout for socket reads. If reached, commands will fail
 		// with a timeout instead of blocking.
-		// Default is 3 seconds.
-		ReadTimeout int64 `yaml:"read_timeout,omitempty"`
+		// Default is 3 seconds; -1 for no timeout.
+		ReadTimeout Duration `yaml:"read_timeout,omitempty"`
 		// Timeout for socket writes. If reached, commands will fail
 		// with a timeout instead of blocking.
-		// Default is ReadTimeout.
-		WriteTimeout int64 `yaml:"write_timeout,omitempty"`
+		// Default is ReadTimeout; -1 for no timeout.
+		WriteTimeout Duration `yaml:"write_timeout,omitempty"`
 
 		// PoolSizePerNode applies per cluster node and not for the whole cluster.
 		// Maximum number of socket connections.
@@ -45,20 +57,23 @@ type (
 		// Amount of time client waits for connection if all connections
 		// are busy before returning an error.
 		// Default is ReadTimeout + 1 second.
-		PoolTimeout int64 `yaml:"pool_timeout,omitempty"`
+		PoolTimeout Duration `yaml:"pool_timeout,omitempty"`
 		// Amount of time after which client closes idle connections.
 		// Should be less than server's timeout.
-		// Default is 300 seconds.
-		IdleTimeout int64 `yaml:"idle_timeout"`
+		// Default is 300 seconds; -1 disables idle timeout check.
+		IdleTimeout Duration `yaml:"idle_timeout"`
 		// Frequency of idle checks.
 		// Default is 60 seconds.
 		// When minus value is set, then idle check is disabled.
-		IdleCheckFrequency int64 `yaml:"idle_check_frequency,omitempty"`
+		IdleCheckFrequency Duration `yaml:"idle_check_frequency,omitempty"`
 
 		// Enables read only queries on slave nodes.
 		// Only for cluster.
 		ReadOnly bool `yaml:"read_only,omitempty"`
 
+		// The retry policy of connecting, and the background health checker.
+		Retry retry.Policy `yaml:"retry,omitempty"`
+
 		init bool
 	}
 
@@ -66,10 +81,25 @@ type (
 	SingleConfig struct {
 		// host:port address.
 		Addr string `yaml:"addr"`
+		// Database to be selected after connecting to the server.
+		DB int `yaml:"db,omitempty"`
 
 		// Maximum backoff between each retry.
-		// Default is 512 seconds; -1 disables backoff.
-		MaxRetryBackoff int64 `yaml:"max_retry_backoff,omitempty"`
+		// Default is 512 milliseconds; -1 disables backoff.
+		MaxRetryBackoff Duration `yaml:"max_retry_backoff,omitempty"`
+	}
+
+	// SentinelConfig redis sentinel (failover) client config.
+	SentinelConfig struct {
+		// The master name monitored by the sentinels.
+		MasterName string `yaml:"master_name"`
+		// A seed list of host:port addresses of sentinel nodes.
+		SentinelAddrs []string `yaml:"sentinel_addrs"`
+		// An optional username and password of the sentinel nodes.
+		SentinelUsername string `yaml:"sentinel_username,omitempty"`
+		SentinelPassword string `yaml:"sentinel_password,omitempty"`
+		// Database to be selected after connecting to the master.
+		DB int `yaml:"db,omitempty"`
 	}
 
 	// ClusterConfig redis cluster client config.
@@ -89,8 +119,9 @@ type (
 
 // deploy types
 const (
-	TypeSingle  = "single"
-	TypeCluster = "cluster"
+	TypeSingle   = "single"
+	TypeCluster  = "cluster"
+	TypeSentinel = "sentinel"
 )
 
 // NewConfig creates a default config.
@@ -104,7 +135,12 @@ func NewConfig() *Config {
 // Client redis (cluster) client.
 type (
 	Client struct {
-		cfg *Config
+		cfg       *Config
+		health    retry.Health
+		mu        sync.Mutex
+		locks     int           // the number of in-flight LockCallback and LockDo
+		locksIdle chan struct{} // closed when locks drops to 0
+		closed    bool
 		Cmdable
 	}
 	Cmdable interface {
@@ -138,7 +174,16 @@ type (
 )
 
 // NewClient creates a redis(cluster) client from yaml config, and pings the client.
+// NOTE:
+//  The config is checked by cfg.Validate() first.
 func NewClient(cfg *Config) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := cfg.TLS.build()
+	if err != nil {
+		return nil, err
+	}
 	var c = &Client{
 		cfg: cfg,
 	}
@@ -146,16 +191,19 @@ func NewClient(cfg *Config) (*Client, error) {
 	case TypeSingle:
 		c.Cmdable = redis.NewClient(&redis.Options{
 			Addr:               cfg.ForSingle.Addr,
+			DB:                 cfg.ForSingle.DB,
+			Username:           cfg.Username,
 			Password:           cfg.Password,
+			TLSConfig:          tlsConfig,
 			MaxRetries:         cfg.MaxRetries,
-			MaxRetryBackoff:    time.Duration(cfg.ForSingle.MaxRetryBackoff) * time.Second,
-			DialTimeout:        time.Duration(cfg.DialTimeout) * time.Second,
-			ReadTimeout:        time.Duration(cfg.ReadTimeout) * time.Second,
-			WriteTimeout:       time.Duration(cfg.WriteTimeout) * time.Second,
+			MaxRetryBackoff:    cfg.ForSingle.MaxRetryBackoff.option(),
+			DialTimeout:        cfg.DialTimeout.option(),
+			ReadTimeout:        cfg.ReadTimeout.option(),
+			WriteTimeout:       cfg.WriteTimeout.option(),
 			PoolSize:           cfg.PoolSizePerNode,
-			PoolTimeout:        time.Duration(cfg.PoolTimeout) * time.Second,
-			IdleTimeout:        time.Duration(cfg.IdleTimeout) * time.Second,
-			IdleCheckFrequency: time.Duration(cfg.IdleCheckFrequency) * time.Second,
+			PoolTimeout:        cfg.PoolTimeout.option(),
+			IdleTimeout:        cfg.IdleTimeout.option(),
+			IdleCheckFrequency: cfg.IdleCheckFrequency.option(),
 		})
 
 	case TypeCluster:
@@ -164,27 +212,124 @@ func NewClient(cfg *Config) (*Client, error) {
 			MaxRedirects:       cfg.ForCluster.MaxRedirects,
 			ReadOnly:           cfg.ReadOnly,
 			RouteByLatency:     cfg.ForCluster.RouteByLatency,
+			Username:           cfg.Username,
 			Password:           cfg.Password,
+			TLSConfig:          tlsConfig,
 			MaxRetries:         cfg.MaxRetries,
-			DialTimeout:        time.Duration(cfg.DialTimeout) * time.Second,
-			ReadTimeout:        time.Duration(cfg.ReadTimeout) * time.Second,
-			WriteTimeout:       time.Duration(cfg.WriteTimeout) * time.Second,
+			DialTimeout:        cfg.DialTimeout.option(),
+			ReadTimeout:        cfg.ReadTimeout.option(),
+			WriteTimeout:       cfg.WriteTimeout.option(),
 			PoolSize:           cfg.PoolSizePerNode,
-			PoolTimeout:        time.Duration(cfg.PoolTimeout) * time.Second,
-			IdleTimeout:        time.Duration(cfg.IdleTimeout) * time.Second,
-			IdleCheckFrequency: time.Duration(cfg.IdleCheckFrequency) * time.Second,
+			PoolTimeout:        cfg.PoolTimeout.option(),
+			IdleTimeout:        cfg.IdleTimeout.option(),
+			IdleCheckFrequency: cfg.IdleCheckFrequency.option(),
 		})
 
-	default:
-		return nil, fmt.Errorf("redis.Config.DeployType: optional enumeration list: %s, %s", TypeSingle, TypeCluster)
+	case TypeSentinel:
+		c.Cmdable = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:         cfg.ForSentinel.MasterName,
+			SentinelAddrs:      cfg.ForSentinel.SentinelAddrs,
+			SentinelUsername:   cfg.ForSentinel.SentinelUsername,
+			SentinelPassword:   cfg.ForSentinel.SentinelPassword,
+			DB:                 cfg.ForSentinel.DB,
+			Username:           cfg.Username,
+			Password:           cfg.Password,
+			TLSConfig:          tlsConfig,
+			MaxRetries:         cfg.MaxRetries,
+			DialTimeout:        cfg.DialTimeout.option(),
+			ReadTimeout:        cfg.ReadTimeout.option(),
+			WriteTimeout:       cfg.WriteTimeout.option(),
+			PoolSize:           cfg.PoolSizePerNode,
+			PoolTimeout:        cfg.PoolTimeout.option(),
+			IdleTimeout:        cfg.IdleTimeout.option(),
+			IdleCheckFrequency: cfg.IdleCheckFrequency.option(),
+		})
 	}
 
-	if _, err := c.Ping().Result(); err != nil {
+	err = retry.Do(context.Background(), &cfg.Retry, "redis", func() error {
+		_, err := c.Ping().Result()
+		return err
+	})
+	if err != nil {
+		c.closeCmdable()
 		return nil, err
 	}
+	c.health.Set(true)
+	c.health.Start("redis", cfg.Retry.HealthCheckPeriod(), func() error {
+		// the pool dials a new connection if the old ones are broken
+		return c.Ping().Err()
+	})
 	return c, nil
 }
 
+// Healthy returns whether the client is connected and passed the last health check.
+func (c *Client) Healthy() bool {
+	return c.health.Healthy()
+}
+
+// WaitReady blocks until the client is healthy or ctx is done.
+func (c *Client) WaitReady(ctx context.Context) error {
+	return c.health.WaitReady(ctx)
+}
+
+// Close stops the health checker and closes the client.
+// NOTE:
+//  Closing a closed client does nothing.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	c.health.Stop()
+	c.health.Set(false)
+	return c.closeCmdable()
+}
+
+// WaitLocks blocks until all the in-flight LockCallback and LockDo return or ctx is done.
+func (c *Client) WaitLocks(ctx context.Context) error {
+	c.mu.Lock()
+	idle := c.locksIdle
+	c.mu.Unlock()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) lockEnter() {
+	c.mu.Lock()
+	if c.locks == 0 {
+		c.locksIdle = make(chan struct{})
+	}
+	c.locks++
+	c.mu.Unlock()
+}
+
+func (c *Client) lockLeave() {
+	c.mu.Lock()
+	c.locks--
+	if c.locks == 0 {
+		close(c.locksIdle)
+		c.locksIdle = nil
+	}
+	c.mu.Unlock()
+}
+
+func (c *Client) closeCmdable() error {
+	if closer, ok := c.Cmdable.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 // Config returns config.
 func (c *Client) Config() *Config {
 	return c.cfg
@@ -195,7 +340,14 @@ func (c *Client) IsCluster() bool {
 	return c.cfg.DeployType == TypeCluster
 }
 
+// IsSentinel returns whether it is a sentinel (failover) client.
+func (c *Client) IsSentinel() bool {
+	return c.cfg.DeployType == TypeSentinel
+}
+
 // ToSingle tries to convert it to *redis.Client.
+// NOTE:
+//  The sentinel (failover) client is a *redis.Client too, connected to the current master.
 func (c *Client) ToSingle() (*redis.Client, bool) {
 	cli, ok := c.Cmdable.(*redis.Client)
 	return cli, ok
@@ -208,24 +360,17 @@ func (c *Client) ToCluster() (*redis.ClusterClient, bool) {
 }
 
 // LockCallback 使用分布式锁执行回调函数
-// 注意：每10毫秒尝试1次上锁，且上锁后默认锁定1分钟
+// 注意：加锁失败时按退避重试，maxLock为锁的过期时间（默认1分钟），持有期间由watchdog自动续期；
+// 解锁时仅删除自己持有的锁，需要返回错误或超时控制时使用LockDo
 func (c *Client) LockCallback(lockKey string, callback func(), maxLock ...time.Duration) error {
-	var d = time.Minute
+	var opts LockOptions
 	if len(maxLock) > 0 {
-		d = maxLock[0]
+		opts.TTL = maxLock[0]
 	}
-	// lock
-	for lockOk, err := c.SetNX(lockKey, "", d).Result(); !lockOk; lockOk, err = c.SetNX(lockKey, "", d).Result() {
-		if err != nil && !IsRedisNil(err) {
-			return err
-		}
-		time.Sleep(time.Millisecond * 10)
-	}
-	// unlock
-	defer c.Del(lockKey)
-	// do
-	callback()
-	return nil
+	return c.LockDo(context.Background(), lockKey, func(context.Context) error {
+		callback()
+		return nil
+	}, &opts)
 }
 
 // Redis nil reply, .e.g. when key does not exist.
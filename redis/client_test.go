@@ -1,10 +1,13 @@
 package redis
 
 import (
+	"context"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/go-redis/redis/v7"
+	"gopkg.in/yaml.v3"
 )
 
 func TestClient(t *testing.T) {
@@ -35,3 +38,84 @@ func TestClient(t *testing.T) {
 	}
 	t.Logf("[after 2s] c.Get().Result() is null ?: %v", err == redis.Nil)
 }
+
+func TestWaitLocks(t *testing.T) {
+	c := &Client{cfg: NewConfig()}
+	if err := c.WaitLocks(context.Background()); err != nil {
+		t.Fatal("WaitLocks() without locks:", err)
+	}
+	c.lockEnter()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.WaitLocks(ctx); err != context.DeadlineExceeded {
+		t.Fatal("WaitLocks() with an in-flight lock:", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.lockLeave()
+	}()
+	if err := c.WaitLocks(context.Background()); err != nil {
+		t.Fatal("WaitLocks() after unlock:", err)
+	}
+}
+
+func TestSentinelConfig(t *testing.T) {
+	cfg := &Config{
+		DeployType: TypeSentinel,
+		ForSentinel: SentinelConfig{
+			MasterName:       "mymaster",
+			SentinelAddrs:    []string{"127.0.0.1:26379", "127.0.0.1:26380"},
+			SentinelPassword: "secret",
+		},
+		Password: "pass",
+	}
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Config
+	if err = yaml.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.DeployType != cfg.DeployType || !reflect.DeepEqual(got.ForSentinel, cfg.ForSentinel) {
+		t.Fatalf("yaml round trip:\n%s\ngot %+v", b, got)
+	}
+
+	if _, err = NewClient(&Config{DeployType: TypeSentinel}); err == nil {
+		t.Fatal("NewClient() without master_name and sentinel_addrs: no error")
+	}
+}
+
+func TestSentinel(t *testing.T) {
+	master := newFakeServer(t)
+	sentinel := newFakeServer(t)
+	sentinel.master = master.ln.Addr().String()
+
+	c, err := NewClient(&Config{
+		DeployType: TypeSentinel,
+		ForSentinel: SentinelConfig{
+			MasterName:    "mymaster",
+			SentinelAddrs: []string{sentinel.ln.Addr().String()},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.IsCluster() || !c.IsSentinel() {
+		t.Fatalf("IsCluster() = %v, IsSentinel() = %v", c.IsCluster(), c.IsSentinel())
+	}
+	if _, ok := c.ToSingle(); !ok {
+		t.Fatal("ToSingle() of the sentinel client: not ok")
+	}
+	if err = c.Set("a_key", "a_value", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := master.value("a_key"); v != "a_value" {
+		t.Fatalf("value on the master = %q", v)
+	}
+	var called bool
+	if err = c.LockCallback("lock_a", func() { called = true }); err != nil || !called {
+		t.Fatalf("LockCallback() = %v, called %v", err, called)
+	}
+}
@@ -0,0 +1,160 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Duration a duration of the yaml config, either a duration string like '300ms', '5s',
+// or an integer of seconds for compatibility.
+// NOTE:
+//  In go code it is a time.Duration, e.g. Duration(300 * time.Millisecond);
+//  A negative value is -1 to go-redis, which disables the option where it is supported.
+type Duration time.Duration
+
+// UnmarshalYAML implements the yaml.Unmarshaler of yaml.v2 and yaml.v3.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*d = Duration(time.Duration(n) * time.Second)
+		return nil
+	}
+	x, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("redis: invalid duration %q, expect an integer of seconds or a duration like '300ms'", s)
+	}
+	*d = Duration(x)
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler, the duration is written as a string like '300ms'.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// String returns the duration string like '300ms'.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Duration returns the time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// option returns the go-redis option value, -1 if it is negative.
+func (d Duration) option() time.Duration {
+	if d < 0 {
+		return -1
+	}
+	return time.Duration(d)
+}
+
+// TLSConfig redis TLS client config, TLS is enabled if it is set.
+type TLSConfig struct {
+	// The PEM file of the CA certificates to verify the server,
+	// default is the system CA certificates.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// The PEM files of the client certificate and key, for mutual TLS.
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// The server name to verify, default is the host of the address.
+	ServerName string `yaml:"server_name,omitempty"`
+	// Skips the verification of the server certificate, only for testing.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// build returns the *tls.Config, nil if t is nil.
+func (t *TLSConfig) build() (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		b, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("redis.Config.TLS.CAFile: %s", err.Error())
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("redis.Config.TLS.CAFile: no PEM certificate in %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("redis.Config.TLS.CertFile: %s", err.Error())
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Validate checks the config, returns a descriptive error of the first invalid field.
+func (cfg *Config) Validate() error {
+	switch cfg.DeployType {
+	case TypeSingle:
+		if cfg.ForSingle.Addr == "" {
+			return fmt.Errorf("redis.Config.ForSingle.Addr: required when deploy_type is %s", TypeSingle)
+		}
+		if cfg.ForSingle.DB < 0 {
+			return fmt.Errorf("redis.Config.ForSingle.DB: %d, must not be negative", cfg.ForSingle.DB)
+		}
+	case TypeCluster:
+		if len(cfg.ForCluster.Addrs) == 0 {
+			return fmt.Errorf("redis.Config.ForCluster.Addrs: required when deploy_type is %s", TypeCluster)
+		}
+	case TypeSentinel:
+		if cfg.ForSentinel.MasterName == "" || len(cfg.ForSentinel.SentinelAddrs) == 0 {
+			return fmt.Errorf("redis.Config.ForSentinel: master_name and sentinel_addrs are required when deploy_type is %s", TypeSentinel)
+		}
+		if cfg.ForSentinel.DB < 0 {
+			return fmt.Errorf("redis.Config.ForSentinel.DB: %d, must not be negative", cfg.ForSentinel.DB)
+		}
+	default:
+		return fmt.Errorf("redis.Config.DeployType: optional enumeration list: %s, %s, %s", TypeSingle, TypeCluster, TypeSentinel)
+	}
+	if cfg.Username != "" && cfg.Password == "" {
+		return fmt.Errorf("redis.Config.Username: %q requires a password", cfg.Username)
+	}
+	if cfg.MaxRetries < -1 {
+		return fmt.Errorf("redis.Config.MaxRetries: %d, must be -1 (disabled) or above", cfg.MaxRetries)
+	}
+	if cfg.PoolSizePerNode < 0 {
+		return fmt.Errorf("redis.Config.PoolSizePerNode: %d, must not be negative", cfg.PoolSizePerNode)
+	}
+	// The floors catch the go code still setting integer seconds, e.g. IdleTimeout: 300 is 300ns.
+	for _, d := range []struct {
+		name  string
+		value Duration
+		floor time.Duration
+	}{
+		{"ForSingle.MaxRetryBackoff", cfg.ForSingle.MaxRetryBackoff, time.Millisecond},
+		{"DialTimeout", cfg.DialTimeout, time.Millisecond},
+		{"ReadTimeout", cfg.ReadTimeout, time.Millisecond},
+		{"WriteTimeout", cfg.WriteTimeout, time.Millisecond},
+		{"PoolTimeout", cfg.PoolTimeout, time.Millisecond},
+		{"IdleTimeout", cfg.IdleTimeout, time.Second},
+		{"IdleCheckFrequency", cfg.IdleCheckFrequency, time.Second},
+	} {
+		if d.value > 0 && d.value.Duration() < d.floor {
+			return fmt.Errorf("redis.Config.%s: %s is less than %s, it is a time.Duration, not seconds: use Duration(%d * time.Second)",
+				d.name, d.value, d.floor, int64(d.value))
+		}
+	}
+	if t := cfg.TLS; t != nil && (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("redis.Config.TLS: cert_file and key_file must be set together")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConfigDuration(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`
+deploy_type: single
+for_single:
+  addr: 127.0.0.1:6379
+  max_retry_backoff: -1
+dial_timeout: 5
+read_timeout: 300ms
+write_timeout: "1"
+idle_timeout: 1m30s
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, x := range map[string][2]time.Duration{
+		"max_retry_backoff": {cfg.ForSingle.MaxRetryBackoff.Duration(), -time.Second},
+		"dial_timeout":      {cfg.DialTimeout.Duration(), 5 * time.Second},
+		"read_timeout":      {cfg.ReadTimeout.Duration(), 300 * time.Millisecond},
+		"write_timeout":     {cfg.WriteTimeout.Duration(), time.Second},
+		"idle_timeout":      {cfg.IdleTimeout.Duration(), 90 * time.Second},
+	} {
+		if x[0] != x[1] {
+			t.Errorf("%s = %s, want %s", name, x[0], x[1])
+		}
+	}
+	if cfg.ForSingle.MaxRetryBackoff.option() != -1 {
+		t.Errorf("the option of a negative duration = %s", cfg.ForSingle.MaxRetryBackoff.option())
+	}
+
+	b, err := yaml.Marshal(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Config
+	if err = yaml.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ReadTimeout != cfg.ReadTimeout || got.IdleTimeout != cfg.IdleTimeout || got.ForSingle.MaxRetryBackoff != cfg.ForSingle.MaxRetryBackoff {
+		t.Fatalf("yaml round trip:\n%s", b)
+	}
+
+	if err = yaml.Unmarshal([]byte("read_timeout: 3x"), &got); err == nil {
+		t.Fatal("invalid duration: no error")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, c := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{DeployType: "master"}, "DeployType"},
+		{Config{DeployType: TypeSingle}, "ForSingle.Addr"},
+		{Config{DeployType: TypeSingle, ForSingle: SingleConfig{Addr: ":6379", DB: -1}}, "ForSingle.DB"},
+		{Config{DeployType: TypeCluster}, "ForCluster.Addrs"},
+		{Config{DeployType: TypeSentinel, ForSentinel: SentinelConfig{MasterName: "mymaster"}}, "ForSentinel"},
+		{Config{DeployType: TypeSingle, ForSingle: SingleConfig{Addr: ":6379"}, Username: "app"}, "Username"},
+		{Config{DeployType: TypeSingle, ForSingle: SingleConfig{Addr: ":6379"}, ReadTimeout: 3}, "ReadTimeout"},
+		{Config{DeployType: TypeSingle, ForSingle: SingleConfig{Addr: ":6379"}, IdleTimeout: 300}, "IdleTimeout"},
+		{Config{DeployType: TypeSingle, ForSingle: SingleConfig{Addr: ":6379"}, IdleCheckFrequency: Duration(500 * time.Millisecond)}, "IdleCheckFrequency"},
+		{Config{DeployType: TypeSingle, ForSingle: SingleConfig{Addr: ":6379"}, ReadTimeout: Duration(time.Millisecond), IdleTimeout: Duration(time.Second)}, ""},
+		{Config{DeployType: TypeSingle, ForSingle: SingleConfig{Addr: ":6379"}, TLS: &TLSConfig{CertFile: "cert.pem"}}, "TLS"},
+		{Config{DeployType: TypeSingle, ForSingle: SingleConfig{Addr: ":6379"}, ReadTimeout: -1}, ""},
+	} {
+		err := c.cfg.Validate()
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "redis.Config."+c.want) {
+			t.Errorf("Validate() = %v, want an error of %s", err, c.want)
+		}
+	}
+
+	_, err := NewClient(&Config{
+		DeployType: TypeSingle,
+		ForSingle:  SingleConfig{Addr: ":6379"},
+		TLS:        &TLSConfig{CAFile: "not_exist.pem"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "redis.Config.TLS.CAFile") {
+		t.Fatalf("NewClient() with a missing CA file = %v", err)
+	}
+}
+
+func TestConfigDBAndUsername(t *testing.T) {
+	m, _ := newMiniClient(t)
+	m.RequireUserAuth("app", "secret")
+	c, err := NewClient(&Config{
+		DeployType: TypeSingle,
+		ForSingle:  SingleConfig{Addr: m.Addr(), DB: 2},
+		Username:   "app",
+		Password:   "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.Set("a_key", "a_value", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.DB(2).Get("a_key"); v != "a_value" {
+		t.Fatalf("value in db 2 = %q", v)
+	}
+}
@@ -0,0 +1,268 @@
+package redis
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer a local redis stand-in speaking RESP, with the string commands and the scripts of this package.
+type fakeServer struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	down    bool   // replies errors to all commands
+	master  string // the master address replied to SENTINEL get-master-addr-by-name
+	scripts map[string]func(s *fakeServer, keys, args []string) interface{}
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		ln:      ln,
+		values:  make(map[string]string),
+		expires: make(map[string]time.Time),
+		scripts: map[string]func(s *fakeServer, keys, args []string) interface{}{
+			unlockScript.Hash(): func(s *fakeServer, keys, args []string) interface{} {
+				if v, ok := s.get(keys[0]); ok && v == args[0] {
+					s.del(keys[0])
+					return int64(1)
+				}
+				return int64(0)
+			},
+			refreshScript.Hash(): func(s *fakeServer, keys, args []string) interface{} {
+				if v, ok := s.get(keys[0]); ok && v == args[0] {
+					ms, _ := strconv.ParseInt(args[1], 10, 64)
+					s.expires[keys[0]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+					return int64(1)
+				}
+				return int64(0)
+			},
+		},
+	}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// client returns a *Client connected to the server.
+func (s *fakeServer) client(t *testing.T) *Client {
+	c, err := NewClient(&Config{
+		DeployType: TypeSingle,
+		ForSingle:  SingleConfig{Addr: s.ln.Addr().String()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func (s *fakeServer) setDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+// value returns the value of the key, locked.
+func (s *fakeServer) value(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key)
+}
+
+// setValue sets the value of the key without expiration, locked.
+func (s *fakeServer) setValue(key, value string) {
+	s.mu.Lock()
+	s.values[key] = value
+	delete(s.expires, key)
+	s.mu.Unlock()
+}
+
+func (s *fakeServer) get(key string) (string, bool) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		s.del(key)
+	}
+	v, ok := s.values[key]
+	return v, ok
+}
+
+func (s *fakeServer) del(key string) bool {
+	_, ok := s.values[key]
+	delete(s.values, key)
+	delete(s.expires, key)
+	return ok
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		reply := s.exec(cmd)
+		s.mu.Unlock()
+		writeReply(w, reply)
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec executes the command, the reply is nil, string (status), []byte (bulk), int64, error or []interface{}.
+func (s *fakeServer) exec(cmd []string) interface{} {
+	if s.down {
+		return fmt.Errorf("LOADING server is down")
+	}
+	switch strings.ToUpper(cmd[0]) {
+	case "PING":
+		return "PONG"
+	case "GET":
+		if v, ok := s.get(cmd[1]); ok {
+			return []byte(v)
+		}
+		return nil
+	case "SET":
+		var nx bool
+		var ttl time.Duration
+		for i := 3; i < len(cmd); i++ {
+			switch strings.ToUpper(cmd[i]) {
+			case "NX":
+				nx = true
+			case "PX", "EX":
+				n, _ := strconv.ParseInt(cmd[i+1], 10, 64)
+				ttl = time.Duration(n) * time.Millisecond
+				if strings.ToUpper(cmd[i]) == "EX" {
+					ttl = time.Duration(n) * time.Second
+				}
+				i++
+			}
+		}
+		if _, ok := s.get(cmd[1]); ok && nx {
+			return nil
+		}
+		s.values[cmd[1]] = cmd[2]
+		delete(s.expires, cmd[1])
+		if ttl > 0 {
+			s.expires[cmd[1]] = time.Now().Add(ttl)
+		}
+		return "OK"
+	case "DEL":
+		var n int64
+		for _, key := range cmd[1:] {
+			s.get(key)
+			if s.del(key) {
+				n++
+			}
+		}
+		return n
+	case "PTTL":
+		if _, ok := s.get(cmd[1]); !ok {
+			return int64(-2)
+		}
+		if at, ok := s.expires[cmd[1]]; ok {
+			return int64(time.Until(at) / time.Millisecond)
+		}
+		return int64(-1)
+	case "SENTINEL":
+		switch strings.ToLower(cmd[1]) {
+		case "get-master-addr-by-name":
+			host, port, err := net.SplitHostPort(s.master)
+			if err != nil {
+				return nil
+			}
+			return []interface{}{[]byte(host), []byte(port)}
+		case "sentinels":
+			return []interface{}{}
+		}
+	case "SUBSCRIBE":
+		return []interface{}{[]byte("subscribe"), []byte(cmd[1]), int64(1)}
+	case "EVALSHA", "EVAL":
+		hash := cmd[1]
+		if strings.ToUpper(cmd[0]) == "EVAL" {
+			hash = fmt.Sprintf("%x", sha1.Sum([]byte(cmd[1])))
+		}
+		script, ok := s.scripts[hash]
+		if !ok {
+			return fmt.Errorf("NOSCRIPT No matching script")
+		}
+		n, _ := strconv.Atoi(cmd[2])
+		return script(s, cmd[3:3+n], cmd[3+n:])
+	}
+	return fmt.Errorf("ERR unknown command '%s'", cmd[0])
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	cmd := make([]string, n)
+	for i := range cmd {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(b[:size])
+	}
+	return cmd, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch x := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		w.WriteString("+" + x + "\r\n")
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(x), x)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", x)
+	case error:
+		w.WriteString("-" + x.Error() + "\r\n")
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(x))
+		for _, v := range x {
+			writeReply(w, v)
+		}
+	}
+}
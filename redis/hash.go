@@ -0,0 +1,383 @@
+package redis
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/gutil"
+	"github.com/swxctx/xmodel/sqlx/reflectx"
+)
+
+// hashMapper maps the struct fields to the hash fields, the same as the mysql package.
+var hashMapper = reflectx.NewMapperFunc("json", gutil.SnakeString)
+
+// hashField a struct field stored as a hash field.
+type hashField struct {
+	name  string
+	index []int
+}
+
+// hashFields returns the top-level fields of the struct type, including the fields of the embedded structs.
+// NOTE:
+//  The nested structs are not flattened, they are stored as JSON.
+func hashFields(t reflect.Type) []hashField {
+	var fields []hashField
+	for _, fi := range hashMapper.TypeMap(t).Index {
+		if fi.Embedded || fi.Name == "" || strings.Contains(fi.Path, ".") {
+			continue
+		}
+		fields = append(fields, hashField{name: fi.Name, index: fi.Index})
+	}
+	return fields
+}
+
+// structValue returns the struct value of the struct pointer.
+func structValue(structPtr interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(structPtr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("redis: expect a non-nil struct pointer, got %T", structPtr)
+	}
+	return v.Elem(), nil
+}
+
+// selectFields returns the fields of names, or all the fields if names is empty.
+// NOTE:
+//  A name is the hash field name like 'user_name', or the go field name like 'UserName'.
+func selectFields(fields []hashField, names []string) ([]hashField, error) {
+	if len(names) == 0 {
+		return fields, nil
+	}
+	selected := make([]hashField, 0, len(names))
+	for _, name := range names {
+		var found bool
+		for _, f := range fields {
+			if f.name == name || f.name == gutil.SnakeString(name) {
+				selected = append(selected, f)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("redis: unknown hash field %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// fieldReadOnly returns the field of the struct traversal, an invalid value if it is in a nil embedded struct pointer.
+func fieldReadOnly(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// encodeField returns the hash field value of v, ok is false if v is nil or NULL.
+// NOTE:
+//  The strings, numbers and bools are stored as plain text, so that HINCRBY works;
+//  The driver.Valuer (e.g. sql.NullString) are stored as their values, and encoding.TextMarshaler (e.g. time.Time) as the text;
+//  The other types are stored as JSON.
+func encodeField(v reflect.Value) (value string, ok bool, err error) {
+	if !v.IsValid() {
+		return "", false, nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false, nil
+		}
+		v = v.Elem()
+	}
+	if valuer, is := v.Interface().(driver.Valuer); is {
+		x, err := valuer.Value()
+		if err != nil || x == nil {
+			return "", false, err
+		}
+		v = reflect.ValueOf(x)
+	}
+	if m, is := v.Interface().(encoding.TextMarshaler); is {
+		b, err := m.MarshalText()
+		return string(b), err == nil, err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), true, nil
+		}
+	}
+	b, err := json.Marshal(v.Interface())
+	return string(b), err == nil, err
+}
+
+// decodeField sets v from the hash field value, sets v to zero if it is absent.
+func decodeField(v reflect.Value, value string, present bool) error {
+	if !present {
+		if scanner, ok := v.Addr().Interface().(sql.Scanner); ok {
+			return scanner.Scan(nil)
+		}
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeField(elem.Elem(), value, true); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	switch x := v.Addr().Interface().(type) {
+	case sql.Scanner:
+		return x.Scan(value)
+	case encoding.TextUnmarshaler:
+		return x.UnmarshalText([]byte(value))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err == nil {
+			v.SetInt(n)
+		}
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err == nil {
+			v.SetUint(n)
+		}
+		return err
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err == nil {
+			v.SetFloat(f)
+		}
+		return err
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err == nil {
+			v.SetBool(b)
+		}
+		return err
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(value))
+			return nil
+		}
+	}
+	return json.Unmarshal([]byte(value), v.Addr().Interface())
+}
+
+// hsetStruct queues the commands to write the struct into the hash key.
+func hsetStruct(pipe redis.Pipeliner, key string, structPtr interface{}) error {
+	v, err := structValue(structPtr)
+	if err != nil {
+		return err
+	}
+	var (
+		values []interface{}
+		absent []string
+	)
+	for _, f := range hashFields(v.Type()) {
+		value, ok, err := encodeField(fieldReadOnly(v, f.index))
+		if err != nil {
+			return fmt.Errorf("redis: encode hash field %q: %s", f.name, err.Error())
+		}
+		if ok {
+			values = append(values, f.name, value)
+		} else {
+			absent = append(absent, f.name)
+		}
+	}
+	if len(absent) > 0 {
+		pipe.HDel(key, absent...)
+	}
+	if len(values) > 0 {
+		pipe.HSet(key, values...)
+	}
+	return nil
+}
+
+// hgetStruct queues the command to read the fields of the hash key, returns the function to decode the reply into dest.
+func hgetStruct(pipe redis.Pipeliner, key string, t reflect.Type, names []string) (func(dest reflect.Value) (bool, error), error) {
+	fields, err := selectFields(hashFields(t), names)
+	if err != nil {
+		return nil, err
+	}
+	hashNames := make([]string, len(fields))
+	for i, f := range fields {
+		hashNames[i] = f.name
+	}
+	cmd := pipe.HMGet(key, hashNames...)
+	return func(dest reflect.Value) (bool, error) {
+		values, err := cmd.Result()
+		if err != nil {
+			return false, err
+		}
+		var found bool
+		for i, f := range fields {
+			value, present := values[i].(string)
+			found = found || present
+			if err = decodeField(reflectx.FieldByIndexes(dest, f.index), value, present); err != nil {
+				return false, fmt.Errorf("redis: decode hash field %q: %s", f.name, err.Error())
+			}
+		}
+		return found, nil
+	}, nil
+}
+
+// HSetStruct writes the fields of the struct into the hash key atomically.
+// NOTE:
+//  The hash field names are the same as the mysql columns, the json tag or the snake_case field name;
+//  The nil pointer and NULL fields are deleted from the hash;
+//  The nested structs, slices and maps are stored as JSON.
+func (c *Client) HSetStruct(key string, structPtr interface{}) error {
+	var err error
+	_, perr := c.TxPipelined(func(pipe redis.Pipeliner) error {
+		err = hsetStruct(pipe, key, structPtr)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return perr
+}
+
+// HMSetStruct writes the structs into the hash keys in one pipeline, structs[i] is written into keys[i].
+// NOTE:
+//  structs is a slice of struct pointers, e.g. []*User.
+func (c *Client) HMSetStruct(keys []string, structs interface{}) error {
+	v := reflect.ValueOf(structs)
+	if v.Kind() != reflect.Slice || v.Len() != len(keys) {
+		return fmt.Errorf("redis: expect a slice of %d struct pointers, got %T", len(keys), structs)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	var err error
+	_, perr := c.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			if err = hsetStruct(pipe, key, v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return perr
+}
+
+// HGetStruct reads the hash key into the struct, only the given fields if any.
+// NOTE:
+//  The absent fields are set to zero, or nil for the pointers;
+//  Returns redis.Nil if none of the fields exist, e.g. the key does not exist.
+func (c *Client) HGetStruct(key string, structPtr interface{}, fields ...string) error {
+	v, err := structValue(structPtr)
+	if err != nil {
+		return err
+	}
+	pipe := c.Pipeline()
+	defer pipe.Close()
+	decode, err := hgetStruct(pipe, key, v.Type(), fields)
+	if err != nil {
+		return err
+	}
+	if _, err = pipe.Exec(); err != nil {
+		return err
+	}
+	found, err := decode(v)
+	if err == nil && !found {
+		err = redis.Nil
+	}
+	return err
+}
+
+// HMGetStruct reads the hash keys in one pipeline into the slice pointer, only the given fields if any.
+// NOTE:
+//  slicePtr is a pointer to a slice of struct pointers or structs, e.g. *[]*User;
+//  The slice has an element per key, the element of a non-existent key is nil (or zero for structs).
+func (c *Client) HMGetStruct(keys []string, slicePtr interface{}, fields ...string) error {
+	sv := reflect.ValueOf(slicePtr)
+	if sv.Kind() != reflect.Ptr || sv.IsNil() || sv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("redis: expect a pointer to a slice, got %T", slicePtr)
+	}
+	var (
+		slice    = sv.Elem()
+		elemType = slice.Type().Elem()
+		isPtr    = elemType.Kind() == reflect.Ptr
+		t        = reflectx.Deref(elemType)
+	)
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("redis: expect a pointer to a slice of structs, got %T", slicePtr)
+	}
+	result := reflect.MakeSlice(slice.Type(), len(keys), len(keys))
+	if len(keys) > 0 {
+		pipe := c.Pipeline()
+		defer pipe.Close()
+		decodes := make([]func(dest reflect.Value) (bool, error), len(keys))
+		for i, key := range keys {
+			decode, err := hgetStruct(pipe, key, t, fields)
+			if err != nil {
+				return err
+			}
+			decodes[i] = decode
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return err
+		}
+		for i, decode := range decodes {
+			dest := reflect.New(t)
+			found, err := decode(dest.Elem())
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			if isPtr {
+				result.Index(i).Set(dest)
+			} else {
+				result.Index(i).Set(dest.Elem())
+			}
+		}
+	}
+	slice.Set(result)
+	return nil
+}
+
+// HIncrField increments the integer field of the hash key by incr, returns the new value.
+// NOTE:
+//  field is the hash field name like 'view_count', or the go field name like 'ViewCount'.
+func (c *Client) HIncrField(key, field string, incr int64) (int64, error) {
+	return c.HIncrBy(key, gutil.SnakeString(field), incr).Result()
+}
+
+// HIncrFloatField increments the float field of the hash key by incr, returns the new value.
+func (c *Client) HIncrFloatField(key, field string, incr float64) (float64, error) {
+	return c.HIncrByFloat(key, gutil.SnakeString(field), incr).Result()
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type hashBase struct {
+	Id        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type hashAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type hashUser struct {
+	hashBase
+	UserName  string
+	Nickname  *string        `json:"nick"`
+	Score     float64        `json:"score"`
+	ViewCount int            `json:"view_count"`
+	Vip       bool           `json:"vip"`
+	Email     sql.NullString `json:"email"`
+	Address   *hashAddress   `json:"address"`
+	Tags      []string       `json:"tags"`
+	Ignored   string         `json:"-"`
+}
+
+func TestHashStruct(t *testing.T) {
+	m, c := newMiniClient(t)
+	nick := "tom"
+	u := &hashUser{
+		hashBase:  hashBase{Id: 1, CreatedAt: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+		UserName:  "tom_smith",
+		Nickname:  &nick,
+		Score:     9.5,
+		ViewCount: 3,
+		Vip:       true,
+		Address:   &hashAddress{City: "Paris", Zip: "75001"},
+		Tags:      []string{"a", "b"},
+		Ignored:   "ignored",
+	}
+	if err := c.HSetStruct("user:1", u); err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string]string{
+		"id":         "1",
+		"created_at": "2024-05-01T08:00:00Z",
+		"user_name":  "tom_smith",
+		"nick":       "tom",
+		"score":      "9.5",
+		"view_count": "3",
+		"vip":        "true",
+		"address":    `{"city":"Paris","zip":"75001"}`,
+		"tags":       `["a","b"]`,
+	} {
+		if got := m.HGet("user:1", field); got != want {
+			t.Errorf("field %s = %q, want %q", field, got, want)
+		}
+	}
+	if keys, _ := m.HKeys("user:1"); len(keys) != 9 {
+		t.Fatalf("hash fields = %v", keys)
+	}
+
+	var got hashUser
+	if err := c.HGetStruct("user:1", &got); err != nil {
+		t.Fatal(err)
+	}
+	u.Ignored = ""
+	if !reflect.DeepEqual(&got, u) {
+		t.Fatalf("HGetStruct() = %+v, want %+v", got, *u)
+	}
+
+	// partial update and read
+	if n, err := c.HIncrField("user:1", "ViewCount", 2); err != nil || n != 5 {
+		t.Fatalf("HIncrField() = %d, %v", n, err)
+	}
+	var part hashUser
+	if err := c.HGetStruct("user:1", &part, "view_count", "UserName"); err != nil {
+		t.Fatal(err)
+	}
+	if part.ViewCount != 5 || part.UserName != "tom_smith" || part.Id != 0 {
+		t.Fatalf("HGetStruct() of fields = %+v", part)
+	}
+	if err := c.HGetStruct("user:1", &part, "unknown"); err == nil {
+		t.Fatal("HGetStruct() of an unknown field: no error")
+	}
+
+	// the nil and NULL fields are deleted
+	got.Nickname = nil
+	got.Email = sql.NullString{String: "tom@example.com", Valid: true}
+	if err := c.HSetStruct("user:1", &got); err != nil {
+		t.Fatal(err)
+	}
+	if m.HGet("user:1", "email") != "tom@example.com" {
+		t.Fatalf("email = %q", m.HGet("user:1", "email"))
+	}
+	got.Email.Valid = false
+	if err := c.HSetStruct("user:1", &got); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := m.HKeys("user:1"); len(keys) != 8 || m.HGet("user:1", "nick") != "" || m.HGet("user:1", "email") != "" {
+		t.Fatalf("the nil fields are not deleted: %v", keys)
+	}
+
+	if err := c.HGetStruct("user:2", &part); err != Nil {
+		t.Fatalf("HGetStruct() of a non-existent key = %v", err)
+	}
+}
+
+func TestHMStruct(t *testing.T) {
+	_, c := newMiniClient(t)
+	users := []*hashUser{{UserName: "a"}, {UserName: "b", Email: sql.NullString{String: "b@example.com", Valid: true}}}
+	if err := c.HMSetStruct([]string{"user:a", "user:b"}, users); err != nil {
+		t.Fatal(err)
+	}
+	var got []*hashUser
+	if err := c.HMGetStruct([]string{"user:a", "user:none", "user:b"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].UserName != "a" || got[1] != nil || got[2].Email.String != "b@example.com" {
+		t.Fatalf("HMGetStruct() = %+v", got)
+	}
+	var values []hashUser
+	if err := c.HMGetStruct([]string{"user:b"}, &values, "user_name"); err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values[0].UserName != "b" || values[0].Email.Valid {
+		t.Fatalf("HMGetStruct() of fields = %+v", values)
+	}
+}
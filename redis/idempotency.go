@@ -0,0 +1,182 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/retry"
+)
+
+// defaults of IdempotencyOptions
+const (
+	defaultIdempotencyTTL      = 24 * time.Hour
+	defaultIdempotencyClaimTTL = 30 * time.Second
+	defaultIdempotencyWait     = 10 * time.Second
+)
+
+// the prefixes of the value of an idempotency key
+const (
+	idempotencyPending = "pending:"
+	idempotencyDone    = "done:"
+)
+
+// ErrIdempotencyInProgress error: the request of the idempotency key is still in progress after waiting
+var ErrIdempotencyInProgress = errors.New("redis: idempotency key in progress")
+
+// IdempotencyOptions the options of the idempotency key.
+type IdempotencyOptions struct {
+	// TTL the expiration of the stored response.
+	// Default is 24 hours.
+	TTL time.Duration
+	// ClaimTTL the expiration of the in-progress claim, the watchdog extends it every ClaimTTL/3 while the handler runs.
+	// Default is 30 seconds.
+	ClaimTTL time.Duration
+	// Wait the maximum time a duplicate waits for the in-progress request, then it returns ErrIdempotencyInProgress.
+	// Default is 10 seconds, negative not to wait.
+	Wait time.Duration
+	// Retry the backoff between the checks of the in-progress request, MaxWait and HealthCheckInterval are not used.
+	// Default is from 10ms to 500ms.
+	Retry retry.Policy
+}
+
+func (o *IdempotencyOptions) ttl() time.Duration {
+	if o == nil || o.TTL <= 0 {
+		return defaultIdempotencyTTL
+	}
+	return o.TTL
+}
+
+func (o *IdempotencyOptions) claimTTL() time.Duration {
+	if o == nil || o.ClaimTTL <= 0 {
+		return defaultIdempotencyClaimTTL
+	}
+	return o.ClaimTTL
+}
+
+func (o *IdempotencyOptions) wait() time.Duration {
+	if o == nil || o.Wait == 0 {
+		return defaultIdempotencyWait
+	}
+	return o.Wait
+}
+
+func (o *IdempotencyOptions) backoff(attempt int) time.Duration {
+	var p retry.Policy
+	if o != nil {
+		p = o.Retry
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultLockInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultLockMaxBackoff
+	}
+	return p.Backoff(attempt)
+}
+
+// IdempotentHandler handles the request of an idempotency key, returns the serialized response.
+type IdempotentHandler func(ctx context.Context) ([]byte, error)
+
+// Idempotent calls handler once for key, and returns the stored response to the duplicate requests.
+// NOTE:
+//  The key is claimed by SETNX with an in-progress marker, extended by a watchdog while handler runs;
+//  The response is stored for TTL if handler returns nil, otherwise the claim is released, and a duplicate may retry;
+//  A duplicate of an in-progress request waits for its response up to Wait, or claims the key if it is released;
+//  replayed is true if the response is the stored one;
+//  The ctx of handler is canceled if the claim is lost, e.g. the key is deleted by others;
+//  If the process crashes after the side effects of handler but before the response is stored,
+//  the request is handled again after ClaimTTL, so make the side effects idempotent as well, e.g. by a unique key;
+//  opts may be nil for the defaults.
+func (c *Client) Idempotent(ctx context.Context, key string, handler IdempotentHandler, opts *IdempotencyOptions) (response []byte, replayed bool, err error) {
+	deadline := time.Now().Add(opts.wait())
+	for attempt := 1; ; attempt++ {
+		token, err := newLockToken()
+		if err != nil {
+			return nil, false, err
+		}
+		claim := idempotencyPending + token
+		ok, err := c.SetNX(key, claim, opts.claimTTL()).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			response, err = c.handleIdempotent(ctx, key, claim, handler, opts)
+			return response, false, err
+		}
+		value, err := c.Get(key).Result()
+		if err == Nil {
+			// released by a failed request
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if strings.HasPrefix(value, idempotencyDone) {
+			return []byte(value[len(idempotencyDone):]), true, nil
+		}
+		backoff := opts.backoff(attempt)
+		if opts.wait() < 0 || time.Now().Add(backoff).After(deadline) {
+			return nil, false, ErrIdempotencyInProgress
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// handleIdempotent calls handler with the claim held, stores the response or releases the claim.
+func (c *Client) handleIdempotent(ctx context.Context, key, claim string, handler IdempotentHandler, opts *IdempotencyOptions) ([]byte, error) {
+	var (
+		handlerCtx, cancel = context.WithCancel(ctx)
+		stop               = make(chan struct{})
+		handled            bool
+	)
+	defer func() {
+		close(stop)
+		cancel()
+		if handled {
+			return
+		}
+		// handler failed or panicked
+		if rerr := unlockScript.Run(c, []string{key}, claim).Err(); rerr != nil {
+			xlog.Warnf("[XModel] redis idempotency %s: release: %s", key, rerr.Error())
+		}
+	}()
+	go runWatchdog("idempotency "+key, opts.claimTTL(), stop, func(ttl time.Duration) error {
+		n, err := refreshScript.Run(c, []string{key}, claim, ttl.Milliseconds()).Int64()
+		if err == nil && n == 0 {
+			err = ErrLockNotHeld
+		}
+		return err
+	}, cancel)
+
+	response, err := handler(handlerCtx)
+	if err != nil {
+		return nil, err
+	}
+	handled = true
+	n, serr := idempotencyStoreScript.Run(c, []string{key}, claim, idempotencyDone+string(response), opts.ttl().Milliseconds()).Int64()
+	if serr != nil || n == 0 {
+		// handler has done, a duplicate may be handled again after the claim expires
+		if serr == nil {
+			serr = ErrLockNotHeld
+		}
+		xlog.Warnf("[XModel] redis idempotency %s: store the response: %s", key, serr.Error())
+	}
+	return response, nil
+}
+
+// idempotencyStoreScript replaces the claim ARGV[1] with the response ARGV[2] for ARGV[3] milliseconds.
+var idempotencyStoreScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then
+	redis.call("set", KEYS[1], ARGV[2], "px", ARGV[3])
+	return 1
+end
+return 0`)
@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+	_, c := newMiniClient(t)
+	ctx := context.Background()
+	opts := &IdempotencyOptions{TTL: time.Hour, ClaimTTL: time.Second, Wait: 2 * time.Second}
+	var calls int32
+	handler := func(response string, err error) IdempotentHandler {
+		return func(ctx context.Context) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			return []byte(response), err
+		}
+	}
+
+	// the stored response is replayed
+	if r, replayed, err := c.Idempotent(ctx, "idem:1", handler("ok", nil), opts); err != nil || replayed || string(r) != "ok" {
+		t.Fatalf("Idempotent() = %q, %v, %v", r, replayed, err)
+	}
+	if r, replayed, err := c.Idempotent(ctx, "idem:1", handler("again", nil), opts); err != nil || !replayed || string(r) != "ok" {
+		t.Fatalf("Idempotent() of a duplicate = %q, %v, %v", r, replayed, err)
+	}
+	if ttl := c.PTTL("idem:1").Val(); ttl <= time.Second || ttl > time.Hour {
+		t.Fatalf("PTTL() of the response = %s", ttl)
+	}
+
+	// the claim is released on failure
+	failure := errors.New("failure")
+	if _, _, err := c.Idempotent(ctx, "idem:2", handler("", failure), opts); err != failure {
+		t.Fatalf("Idempotent() of a failed handler = %v", err)
+	}
+	func() {
+		defer func() { recover() }()
+		c.Idempotent(ctx, "idem:2", func(ctx context.Context) ([]byte, error) { panic("handler") }, opts)
+	}()
+	if r, replayed, err := c.Idempotent(ctx, "idem:2", handler("retried", nil), opts); err != nil || replayed || string(r) != "retried" {
+		t.Fatalf("Idempotent() after the failures = %q, %v, %v", r, replayed, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("handler is called %d times", n)
+	}
+
+	// the concurrent duplicates wait for the response
+	var (
+		started = make(chan struct{})
+		finish  = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r, replayed, err := c.Idempotent(ctx, "idem:3", func(ctx context.Context) ([]byte, error) {
+			close(started)
+			<-finish
+			return []byte("slow"), nil
+		}, opts)
+		if err != nil || replayed || string(r) != "slow" {
+			t.Errorf("Idempotent() = %q, %v, %v", r, replayed, err)
+		}
+	}()
+	<-started
+	if _, _, err := c.Idempotent(ctx, "idem:3", handler("", nil), &IdempotencyOptions{Wait: -1}); err != ErrIdempotencyInProgress {
+		t.Fatalf("Idempotent() without waiting = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, replayed, err := c.Idempotent(ctx, "idem:3", handler("duplicate", nil), opts)
+			if err != nil || !replayed || string(r) != "slow" {
+				t.Errorf("Idempotent() of a concurrent duplicate = %q, %v, %v", r, replayed, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(finish)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("handler is called %d times", n)
+	}
+}
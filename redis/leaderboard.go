@@ -0,0 +1,449 @@
+package redis
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// LeaderboardPeriod the period of a leaderboard, a new board is started every period.
+type LeaderboardPeriod int
+
+// leaderboard periods
+const (
+	// PeriodNone an all-time board
+	PeriodNone LeaderboardPeriod = iota
+	// PeriodDaily a board per day, e.g. 'module:name:20240501'
+	PeriodDaily
+	// PeriodWeekly a board per ISO week from Monday, e.g. 'module:name:2024W18'
+	PeriodWeekly
+	// PeriodMonthly a board per month, e.g. 'module:name:202405'
+	PeriodMonthly
+)
+
+const (
+	// leaderboardMergeBits the guard bits of the tie-break, up to 2^5 boards can be merged without overflow
+	leaderboardMergeBits = 5
+	// leaderboardAllTimeSpan the span of the tie-break of an all-time board from leaderboardEpoch
+	leaderboardAllTimeSpan = 100 * 365 * 24 * time.Hour
+)
+
+// leaderboardEpoch the start of the tie-break of an all-time board
+var leaderboardEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// LeaderboardOptions the options of a leaderboard.
+type LeaderboardOptions struct {
+	// Period the period of the boards, default is an all-time board.
+	Period LeaderboardPeriod
+	// Retention the time a period board is kept after the period ends.
+	// Default is the length of the period.
+	Retention time.Duration
+	// Location the time zone of the periods, default is time.Local.
+	Location *time.Location
+	// Ascending the lower score ranks higher, e.g. the time of a race.
+	Ascending bool
+	// TieBreak the time resolution of the tie-break, the member reaching a score earlier ranks higher.
+	// If 0, the members of the same score are ordered by name.
+	// NOTE:
+	//  The tie-break is encoded with the score into the float of the sorted set, a coarser resolution allows larger scores,
+	//  see MaxScore.
+	TieBreak time.Duration
+	// TopCacheSize, TopCacheTTL if both > 0, Top(n) for n <= TopCacheSize is cached in memory for TopCacheTTL.
+	TopCacheSize int64
+	TopCacheTTL  time.Duration
+}
+
+// LeaderboardEntry a member of a leaderboard.
+type LeaderboardEntry struct {
+	Member string
+	Score  int64
+	// Rank the 1-based rank.
+	Rank int64
+}
+
+// Leaderboard a leaderboard on sorted sets, of integer scores.
+// NOTE:
+//  The score stored in redis is score*2^shift+tie, where the tie-break is in the low bits;
+//  The methods access the board of the current period, or the period of At(t).
+type Leaderboard struct {
+	c      *Client
+	module *Module
+	name   string
+	opts   LeaderboardOptions
+	shift  uint // the bits of the tie-break and the guard bits, 0 if no tie-break
+	tie    uint // the bits of the tie-break
+	at     time.Time
+	now    func() time.Time
+	cache  *topCache
+}
+
+// topCache the in-memory cache of the top entries.
+type topCache struct {
+	mu      sync.Mutex
+	key     string
+	entries []LeaderboardEntry
+	expire  time.Time
+}
+
+// NewLeaderboard creates a leaderboard named name in the module.
+// NOTE:
+//  opts may be nil for the defaults.
+func NewLeaderboard(c *Client, m *Module, name string, opts *LeaderboardOptions) *Leaderboard {
+	lb := &Leaderboard{
+		c:      c,
+		module: m,
+		name:   name,
+		now:    time.Now,
+		cache:  new(topCache),
+	}
+	if opts != nil {
+		lb.opts = *opts
+	}
+	if lb.opts.Location == nil {
+		lb.opts.Location = time.Local
+	}
+	if lb.opts.Retention <= 0 {
+		lb.opts.Retention = lb.span()
+	}
+	if lb.opts.TieBreak > 0 {
+		lb.tie = uint(bits.Len64(uint64(lb.span() / lb.opts.TieBreak)))
+		lb.shift = lb.tie + leaderboardMergeBits
+	}
+	return lb
+}
+
+// At returns the leaderboard of the period of t, e.g. the board of yesterday.
+func (lb *Leaderboard) At(t time.Time) *Leaderboard {
+	at := *lb
+	at.at = t
+	return &at
+}
+
+// MaxScore returns the maximum absolute score, limited by the tie-break bits in the float of the sorted set.
+func (lb *Leaderboard) MaxScore() int64 {
+	return 1<<(53-lb.shift) - 1
+}
+
+// span returns the length of a period, or the span of the all-time tie-break.
+func (lb *Leaderboard) span() time.Duration {
+	switch lb.opts.Period {
+	case PeriodDaily:
+		return 24 * time.Hour
+	case PeriodWeekly:
+		return 7 * 24 * time.Hour
+	case PeriodMonthly:
+		return 31 * 24 * time.Hour
+	}
+	return leaderboardAllTimeSpan
+}
+
+// period returns the start and the end of the period of t, and the key suffix.
+func (lb *Leaderboard) period(t time.Time) (start, end time.Time, suffix string) {
+	t = t.In(lb.opts.Location)
+	y, m, d := t.Date()
+	switch lb.opts.Period {
+	case PeriodDaily:
+		start = time.Date(y, m, d, 0, 0, 0, 0, lb.opts.Location)
+		return start, start.AddDate(0, 0, 1), ":" + start.Format("20060102")
+	case PeriodWeekly:
+		start = time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, lb.opts.Location)
+		year, week := start.ISOWeek()
+		return start, start.AddDate(0, 0, 7), fmt.Sprintf(":%dW%02d", year, week)
+	case PeriodMonthly:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, lb.opts.Location)
+		return start, start.AddDate(0, 1, 0), ":" + start.Format("200601")
+	}
+	return leaderboardEpoch, time.Time{}, ""
+}
+
+// time returns the time of the board.
+func (lb *Leaderboard) time() time.Time {
+	if lb.at.IsZero() {
+		return lb.now()
+	}
+	return lb.at
+}
+
+// Key returns the redis key of the board.
+func (lb *Leaderboard) Key() string {
+	_, _, suffix := lb.period(lb.time())
+	return lb.module.Key(lb.name + suffix)
+}
+
+// tieBreak returns the tie-break of now, the earlier the better.
+func (lb *Leaderboard) tieBreak(now time.Time) int64 {
+	if lb.shift == 0 {
+		return 0
+	}
+	start, _, _ := lb.period(lb.time())
+	var (
+		max  = int64(1)<<lb.tie - 1
+		tick = int64(now.Sub(start) / lb.opts.TieBreak)
+	)
+	if tick < 0 {
+		tick = 0
+	} else if tick > max {
+		tick = max
+	}
+	if lb.opts.Ascending {
+		return tick
+	}
+	return max - tick
+}
+
+// expireAt returns the expiration of the board in milliseconds, 0 for an all-time board.
+func (lb *Leaderboard) expireAt() int64 {
+	if lb.opts.Period == PeriodNone {
+		return 0
+	}
+	_, end, _ := lb.period(lb.time())
+	return end.Add(lb.opts.Retention).UnixNano() / int64(time.Millisecond)
+}
+
+// decode returns the score of the stored score.
+func (lb *Leaderboard) decode(stored float64) int64 {
+	return int64(math.Floor(math.Ldexp(stored, -int(lb.shift))))
+}
+
+// update runs leaderboardScript, returns whether the score is changed and the new score.
+func (lb *Leaderboard) update(mode, member string, score int64) (bool, int64, error) {
+	if score > lb.MaxScore() || score < -lb.MaxScore() {
+		return false, 0, fmt.Errorf("redis: leaderboard score %d out of range, the max is %d", score, lb.MaxScore())
+	}
+	ascending := 0
+	if lb.opts.Ascending {
+		ascending = 1
+	}
+	reply, err := leaderboardScript.Run(lb.c, []string{lb.Key()},
+		mode, member, score, math.Ldexp(1, int(lb.shift)), lb.tieBreak(lb.now()), lb.expireAt(), lb.MaxScore(), ascending,
+	).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("redis: unexpected leaderboard reply: %v", reply)
+	}
+	changed, _ := values[0].(int64)
+	s, _ := values[1].(string)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("redis: unexpected leaderboard reply: %v", reply)
+	}
+	lb.clearCache()
+	return changed == 1, n, nil
+}
+
+// Set sets the score of member.
+func (lb *Leaderboard) Set(member string, score int64) error {
+	_, _, err := lb.update("set", member, score)
+	return err
+}
+
+// Incr increments the score of member by delta, returns the new score.
+func (lb *Leaderboard) Incr(member string, delta int64) (int64, error) {
+	_, score, err := lb.update("incr", member, delta)
+	return score, err
+}
+
+// SetBest sets the score of member if it is better than the current one, returns whether it is set and the best score.
+func (lb *Leaderboard) SetBest(member string, score int64) (bool, int64, error) {
+	return lb.update("best", member, score)
+}
+
+// Remove removes the members.
+func (lb *Leaderboard) Remove(members ...string) error {
+	ms := make([]interface{}, len(members))
+	for i, m := range members {
+		ms[i] = m
+	}
+	err := lb.c.ZRem(lb.Key(), ms...).Err()
+	lb.clearCache()
+	return err
+}
+
+// Count returns the number of the members.
+func (lb *Leaderboard) Count() (int64, error) {
+	return lb.c.ZCard(lb.Key()).Result()
+}
+
+// Rank returns the entry of member, returns Nil if it is not on the board.
+func (lb *Leaderboard) Rank(member string) (*LeaderboardEntry, error) {
+	key := lb.Key()
+	pipe := lb.c.Pipeline()
+	defer pipe.Close()
+	var (
+		score = pipe.ZScore(key, member)
+		rank  *redis.IntCmd
+	)
+	if lb.opts.Ascending {
+		rank = pipe.ZRank(key, member)
+	} else {
+		rank = pipe.ZRevRank(key, member)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+	return &LeaderboardEntry{
+		Member: member,
+		Score:  lb.decode(score.Val()),
+		Rank:   rank.Val() + 1,
+	}, nil
+}
+
+// Range returns the entries from the 0-based offset, count entries at most.
+func (lb *Leaderboard) Range(offset, count int64) ([]LeaderboardEntry, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	var (
+		zs  []redis.Z
+		err error
+	)
+	if lb.opts.Ascending {
+		zs, err = lb.c.ZRangeWithScores(lb.Key(), offset, offset+count-1).Result()
+	} else {
+		zs, err = lb.c.ZRevRangeWithScores(lb.Key(), offset, offset+count-1).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LeaderboardEntry, len(zs))
+	for i, z := range zs {
+		member, _ := z.Member.(string)
+		entries[i] = LeaderboardEntry{
+			Member: member,
+			Score:  lb.decode(z.Score),
+			Rank:   offset + int64(i) + 1,
+		}
+	}
+	return entries, nil
+}
+
+// Page returns the entries of the 1-based page of size entries.
+func (lb *Leaderboard) Page(page, size int64) ([]LeaderboardEntry, error) {
+	if page < 1 {
+		page = 1
+	}
+	return lb.Range((page-1)*size, size)
+}
+
+// Top returns the top n entries, cached if TopCacheSize and TopCacheTTL are set.
+// NOTE:
+//  The cache is cleared by the writes of this process, the writes of the others are seen after TopCacheTTL.
+func (lb *Leaderboard) Top(n int64) ([]LeaderboardEntry, error) {
+	if n > lb.opts.TopCacheSize || lb.opts.TopCacheTTL <= 0 {
+		return lb.Range(0, n)
+	}
+	key := lb.Key()
+	lb.cache.mu.Lock()
+	if lb.cache.key == key && lb.now().Before(lb.cache.expire) {
+		entries := lb.cache.entries
+		lb.cache.mu.Unlock()
+		if int64(len(entries)) > n {
+			entries = entries[:n]
+		}
+		return entries, nil
+	}
+	lb.cache.mu.Unlock()
+
+	entries, err := lb.Range(0, lb.opts.TopCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	lb.cache.mu.Lock()
+	lb.cache.key = key
+	lb.cache.entries = entries
+	lb.cache.expire = lb.now().Add(lb.opts.TopCacheTTL)
+	lb.cache.mu.Unlock()
+	if int64(len(entries)) > n {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+func (lb *Leaderboard) clearCache() {
+	lb.cache.mu.Lock()
+	lb.cache.key = ""
+	lb.cache.entries = nil
+	lb.cache.mu.Unlock()
+}
+
+// Around returns the entries of member and up to n entries above and below it, returns Nil if it is not on the board.
+func (lb *Leaderboard) Around(member string, n int64) ([]LeaderboardEntry, error) {
+	e, err := lb.Rank(member)
+	if err != nil {
+		return nil, err
+	}
+	start := e.Rank - 1 - n
+	if start < 0 {
+		start = 0
+	}
+	return lb.Range(start, e.Rank+n-start)
+}
+
+// Merge replaces the board with the sum of the scores of the sources by ZUNIONSTORE, e.g. a weekly board of the daily boards.
+// NOTE:
+//  The sources may have different tie-breaks, they are scaled to the tie-break of the board;
+//  Up to 32 boards are merged exactly, the ties of the merged board are broken by the sum of the tie-breaks;
+//  In cluster mode, the keys need one hash tag, e.g. the boards named '{score}daily' and '{score}weekly'.
+func (lb *Leaderboard) Merge(sources ...*Leaderboard) error {
+	if len(sources) > 1<<leaderboardMergeBits {
+		return fmt.Errorf("redis: merge %d leaderboards, the max is %d", len(sources), 1<<leaderboardMergeBits)
+	}
+	var (
+		key     = lb.Key()
+		keys    = make([]string, len(sources))
+		weights = make([]float64, len(sources))
+	)
+	for i, src := range sources {
+		if src.opts.Ascending != lb.opts.Ascending {
+			return fmt.Errorf("redis: merge leaderboards of different orders")
+		}
+		keys[i] = src.Key()
+		weights[i] = math.Ldexp(1, int(lb.shift)-int(src.shift))
+	}
+	pipe := lb.c.TxPipeline()
+	defer pipe.Close()
+	pipe.ZUnionStore(key, &redis.ZStore{Keys: keys, Weights: weights, Aggregate: "SUM"})
+	if at := lb.expireAt(); at > 0 {
+		pipe.PExpireAt(key, time.Unix(0, at*int64(time.Millisecond)))
+	}
+	_, err := pipe.Exec()
+	lb.clearCache()
+	return err
+}
+
+// leaderboardScript updates the score of a member, returns {changed, score}.
+// ARGV: mode (set, incr, best), member, score, 2^shift, tie, expire_at, max_score, ascending
+var leaderboardScript = redis.NewScript(`
+local key, mode, member = KEYS[1], ARGV[1], ARGV[2]
+local value, shift, tie = tonumber(ARGV[3]), tonumber(ARGV[4]), tonumber(ARGV[5])
+local expire_at, max, ascending = tonumber(ARGV[6]), tonumber(ARGV[7]), ARGV[8] == "1"
+local old = redis.call("ZSCORE", key, member)
+local score
+if old then
+	score = math.floor(tonumber(old) / shift)
+end
+local new = value
+if mode == "incr" then
+	new = (score or 0) + value
+elseif mode == "best" and score then
+	if (ascending and value >= score) or (not ascending and value <= score) then
+		return {0, string.format("%.0f", score)}
+	end
+end
+if math.abs(new) > max then
+	return redis.error_reply("leaderboard score out of range")
+end
+redis.call("ZADD", key, string.format("%.0f", new * shift + tie), member)
+if expire_at > 0 then
+	redis.call("PEXPIREAT", key, string.format("%.0f", expire_at))
+end
+return {1, string.format("%.0f", new)}
+`)
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaderboard(t *testing.T) {
+	mr, c := newMiniClient(t)
+	var (
+		m   = NewModule("test")
+		loc = time.UTC
+		now = time.Date(2024, 5, 1, 10, 0, 0, 0, loc)
+	)
+	mr.SetTime(now)
+	daily := NewLeaderboard(c, m, "scores", &LeaderboardOptions{
+		Period:       PeriodDaily,
+		Location:     loc,
+		TieBreak:     time.Second,
+		TopCacheSize: 3,
+		TopCacheTTL:  time.Minute,
+	})
+	daily.now = func() time.Time { return now }
+	if daily.Key() != "test:scores:20240501" {
+		t.Fatalf("Key() = %s", daily.Key())
+	}
+
+	// the member reaching a score earlier ranks higher
+	for _, e := range []struct {
+		member string
+		score  int64
+	}{{"b", 10}, {"a", 10}, {"d", 3}, {"e", 1}} {
+		if err := daily.Set(e.member, e.score); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	if _, err := daily.Incr("c", 4); err != nil {
+		t.Fatal(err)
+	}
+	if score, err := daily.Incr("c", 6); err != nil || score != 10 {
+		t.Fatalf("Incr() = %d, %v", score, err)
+	}
+	top, err := daily.Top(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 3 || top[0] != (LeaderboardEntry{"b", 10, 1}) || top[1].Member != "a" || top[2] != (LeaderboardEntry{"c", 10, 3}) {
+		t.Fatalf("Top() = %+v", top)
+	}
+	if e, err := daily.Rank("d"); err != nil || *e != (LeaderboardEntry{"d", 3, 4}) {
+		t.Fatalf("Rank() = %+v, %v", e, err)
+	}
+	if _, err = daily.Rank("x"); err != Nil {
+		t.Fatalf("Rank() of an absent member = %v", err)
+	}
+	if page, err := daily.Page(2, 2); err != nil || len(page) != 2 || page[0].Member != "c" || page[1].Rank != 4 {
+		t.Fatalf("Page() = %+v, %v", page, err)
+	}
+	if around, err := daily.Around("c", 1); err != nil || len(around) != 3 || around[0].Member != "a" || around[2].Member != "d" {
+		t.Fatalf("Around() = %+v, %v", around, err)
+	}
+	if around, err := daily.Around("b", 2); err != nil || len(around) != 3 || around[0].Rank != 1 {
+		t.Fatalf("Around() of the first = %+v, %v", around, err)
+	}
+
+	// the top cache is served until the writes of the process
+	if err = c.ZAdd(daily.Key(), &Z{Score: 1 << 40, Member: "z"}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if top, _ = daily.Top(2); top[0].Member != "b" {
+		t.Fatalf("Top() is not cached: %+v", top)
+	}
+	if err = daily.Remove("z"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, best, err := daily.SetBest("e", 0); err != nil || ok || best != 1 {
+		t.Fatalf("SetBest() of a worse score = %v, %d, %v", ok, best, err)
+	}
+	if ok, best, err := daily.SetBest("e", 20); err != nil || !ok || best != 20 {
+		t.Fatalf("SetBest() = %v, %d, %v", ok, best, err)
+	}
+	if top, _ = daily.Top(1); top[0].Member != "e" {
+		t.Fatalf("Top() after SetBest() = %+v", top)
+	}
+	if n, err := daily.Count(); err != nil || n != 5 {
+		t.Fatalf("Count() = %d, %v", n, err)
+	}
+	if ttl := c.TTL(daily.Key()).Val(); ttl <= 0 {
+		t.Fatalf("TTL() = %s", ttl)
+	}
+	if err = daily.Set("a", daily.MaxScore()+1); err == nil {
+		t.Fatal("Set() out of range")
+	}
+
+	// the weekly board of the daily boards
+	tomorrow := daily.At(now.AddDate(0, 0, 1))
+	if tomorrow.Key() != "test:scores:20240502" {
+		t.Fatalf("At().Key() = %s", tomorrow.Key())
+	}
+	if err = tomorrow.Set("d", 30); err != nil {
+		t.Fatal(err)
+	}
+	weekly := NewLeaderboard(c, m, "weekly", &LeaderboardOptions{Period: PeriodWeekly, Location: loc, TieBreak: time.Minute})
+	weekly.now = daily.now
+	if weekly.Key() != "test:weekly:2024W18" {
+		t.Fatalf("Key() = %s", weekly.Key())
+	}
+	if err = weekly.Merge(daily, tomorrow); err != nil {
+		t.Fatal(err)
+	}
+	if top, err = weekly.Top(2); err != nil || top[0] != (LeaderboardEntry{"d", 33, 1}) || top[1] != (LeaderboardEntry{"e", 20, 2}) {
+		t.Fatalf("Top() of the merged board = %+v, %v", top, err)
+	}
+}
+
+func TestLeaderboardAscending(t *testing.T) {
+	_, c := newMiniClient(t)
+	lb := NewLeaderboard(c, NewModule("test"), "race", &LeaderboardOptions{Ascending: true, TieBreak: time.Hour})
+	if lb.Key() != "test:race" || lb.MaxScore() != 1<<28-1 {
+		t.Fatalf("Key() = %s, MaxScore() = %d", lb.Key(), lb.MaxScore())
+	}
+	for member, score := range map[string]int64{"a": 300, "b": 100, "c": -5} {
+		if err := lb.Set(member, score); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, _, err := lb.SetBest("a", 50); err != nil || !ok {
+		t.Fatalf("SetBest() = %v, %v", ok, err)
+	}
+	top, err := lb.Top(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 3 || top[0] != (LeaderboardEntry{"c", -5, 1}) || top[1] != (LeaderboardEntry{"a", 50, 2}) {
+		t.Fatalf("Top() = %+v", top)
+	}
+	if ttl := c.TTL(lb.Key()).Val(); ttl >= 0 {
+		t.Fatalf("TTL() of an all-time board = %s", ttl)
+	}
+}
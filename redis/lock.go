@@ -0,0 +1,273 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/retry"
+)
+
+// defaults of LockOptions
+const (
+	defaultLockTTL            = time.Minute
+	defaultLockInitialBackoff = 10  // milliseconds
+	defaultLockMaxBackoff     = 500 // milliseconds
+)
+
+var (
+	// ErrNotObtained error: the lock is held by another owner
+	ErrNotObtained = errors.New("redis: lock not obtained")
+	// ErrLockNotHeld error: the lock is released, expired or held by another owner
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+// LockOptions the options of the distributed lock.
+type LockOptions struct {
+	// TTL the expiration of the lock key, the watchdog extends it every TTL/3 while the lock is held.
+	// Default is 1 minute.
+	TTL time.Duration
+	// NoWatchdog disables the watchdog, the lock expires after TTL.
+	NoWatchdog bool
+	// Retry the backoff between the attempts to obtain the lock, MaxWait and HealthCheckInterval are not used.
+	// Default is from 10ms to 500ms.
+	Retry retry.Policy
+}
+
+func (o *LockOptions) ttl() time.Duration {
+	if o == nil || o.TTL <= 0 {
+		return defaultLockTTL
+	}
+	return o.TTL
+}
+
+func (o *LockOptions) backoff(attempt int) time.Duration {
+	var p retry.Policy
+	if o != nil {
+		p = o.Retry
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultLockInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultLockMaxBackoff
+	}
+	return p.Backoff(attempt)
+}
+
+// the scripts to change the lock only if it is held by the token
+var (
+	unlockScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+	refreshScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Lock a distributed lock held by a random owner token.
+type Lock struct {
+	c        *Client
+	key      string
+	token    string
+	ttl      time.Duration
+	mu       sync.Mutex
+	released bool
+	stop     chan struct{} // closed by Unlock
+	stopped  chan struct{} // closed when the watchdog exits
+	lost     chan struct{} // closed when the watchdog finds the lock not held
+	lostOnce sync.Once
+}
+
+// TryLock tries to obtain the lock once, returns ErrNotObtained if it is held by another owner.
+// NOTE:
+//  opts may be nil for the defaults.
+func (c *Client) TryLock(key string, opts *LockOptions) (*Lock, error) {
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+	ttl := opts.ttl()
+	ok, err := c.SetNX(key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotObtained
+	}
+	l := &Lock{
+		c:       c,
+		key:     key,
+		token:   token,
+		ttl:     ttl,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+	if opts != nil && opts.NoWatchdog {
+		close(l.stopped)
+	} else {
+		go l.watchdog()
+	}
+	return l, nil
+}
+
+// Lock obtains the lock, retries with backoff until it is obtained or ctx is done.
+// NOTE:
+//  opts may be nil for the defaults;
+//  Returns ctx.Err() if ctx is done before the lock is obtained.
+func (c *Client) Lock(ctx context.Context, key string, opts *LockOptions) (*Lock, error) {
+	for attempt := 1; ; attempt++ {
+		l, err := c.TryLock(key, opts)
+		if err != ErrNotObtained {
+			return l, err
+		}
+		timer := time.NewTimer(opts.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// LockDo obtains the lock, calls callback and releases the lock.
+// NOTE:
+//  The ctx of callback is canceled if the lock is lost, e.g. the key is deleted by others;
+//  Returns the error of callback, or ErrLockNotHeld if the lock is lost before released.
+func (c *Client) LockDo(ctx context.Context, key string, callback func(ctx context.Context) error, opts *LockOptions) error {
+	c.lockEnter()
+	defer c.lockLeave()
+	l, err := c.Lock(ctx, key, opts)
+	if err != nil {
+		return err
+	}
+	return doLocked(ctx, l, callback)
+}
+
+// heldLock the lock held by the caller.
+type heldLock interface {
+	Lost() <-chan struct{}
+	Unlock() error
+}
+
+// doLocked calls callback with a ctx canceled if the lock is lost, and releases the lock.
+func doLocked(ctx context.Context, l heldLock, callback func(ctx context.Context) error) error {
+	callbackCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.Lost():
+			cancel()
+		case <-callbackCtx.Done():
+		}
+	}()
+	err := callback(callbackCtx)
+	if uerr := l.Unlock(); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// Key returns the key of the lock.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the random owner token of the lock.
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Lost returns a channel that is closed when the watchdog finds the lock not held.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Refresh extends the expiration of the lock to ttl, returns ErrLockNotHeld if the lock is not held.
+func (l *Lock) Refresh(ttl time.Duration) error {
+	n, err := refreshScript.Run(l.c, []string{l.key}, l.token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Unlock stops the watchdog and deletes the lock if it is still held by the token.
+// NOTE:
+//  Returns ErrLockNotHeld if the lock is already released, expired or held by another owner.
+func (l *Lock) Unlock() error {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return ErrLockNotHeld
+	}
+	l.released = true
+	close(l.stop)
+	l.mu.Unlock()
+	<-l.stopped
+
+	n, err := unlockScript.Run(l.c, []string{l.key}, l.token).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// watchdog extends the expiration every ttl/3 until the lock is released or lost.
+func (l *Lock) watchdog() {
+	defer close(l.stopped)
+	runWatchdog("lock "+l.key, l.ttl, l.stop, l.Refresh, func() {
+		l.lostOnce.Do(func() { close(l.lost) })
+	})
+}
+
+// runWatchdog calls refresh every ttl/3 until stop is closed, or calls lost and returns
+// if refresh returns ErrLockNotHeld.
+func runWatchdog(name string, ttl time.Duration, stop <-chan struct{}, refresh func(ttl time.Duration) error, lost func()) {
+	interval := ttl / 3
+	if interval <= 0 {
+		interval = ttl
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		switch err := refresh(ttl); err {
+		case nil:
+		case ErrLockNotHeld:
+			lost()
+			return
+		default:
+			// retry at the next tick, the lock is still held until ttl
+			xlog.Warnf("[XModel] redis %s: refresh: %s", name, err.Error())
+		}
+	}
+}
+
+// newLockToken returns a random owner token.
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	s := newFakeServer(t)
+	c := s.client(t)
+
+	l, err := c.TryLock("lock_a", &LockOptions{TTL: 60 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.value("lock_a"); v != l.Token() || v == "" {
+		t.Fatalf("lock value = %q, token %q", v, l.Token())
+	}
+	if _, err = c.TryLock("lock_a", nil); err != ErrNotObtained {
+		t.Fatalf("TryLock() of the held lock = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err = c.Lock(ctx, "lock_a", nil); err != context.DeadlineExceeded {
+		t.Fatalf("Lock() with timeout = %v", err)
+	}
+
+	// the watchdog keeps the lock after the ttl
+	time.Sleep(150 * time.Millisecond)
+	if v, _ := s.value("lock_a"); v != l.Token() {
+		t.Fatalf("lock value after ttl = %q", v)
+	}
+	if err = l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.value("lock_a"); ok {
+		t.Fatal("the lock is not deleted")
+	}
+	if err = l.Unlock(); err != ErrLockNotHeld {
+		t.Fatalf("Unlock() twice = %v", err)
+	}
+
+	// never delete the lock of another owner
+	l, err = c.TryLock("lock_b", &LockOptions{TTL: 20 * time.Millisecond, NoWatchdog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	s.setValue("lock_b", "other")
+	if err = l.Unlock(); err != ErrLockNotHeld {
+		t.Fatalf("Unlock() of the expired lock = %v", err)
+	}
+	if v, _ := s.value("lock_b"); v != "other" {
+		t.Fatalf("the lock of another owner is deleted: %q", v)
+	}
+}
+
+func TestLockDo(t *testing.T) {
+	s := newFakeServer(t)
+	c := s.client(t)
+
+	errCallback := errors.New("callback error")
+	if err := c.LockDo(context.Background(), "lock_a", func(context.Context) error {
+		return errCallback
+	}, nil); err != errCallback {
+		t.Fatalf("LockDo() = %v", err)
+	}
+	if _, ok := s.value("lock_a"); ok {
+		t.Fatal("the lock is not released after the callback error")
+	}
+
+	// waits for the holder
+	l, err := c.TryLock("lock_a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		l.Unlock()
+	}()
+	var called bool
+	if err = c.LockCallback("lock_a", func() { called = true }); err != nil || !called {
+		t.Fatalf("LockCallback() = %v, called %v", err, called)
+	}
+
+	// the lock is lost
+	err = c.LockDo(context.Background(), "lock_c", func(ctx context.Context) error {
+		s.setValue("lock_c", "other")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+			return errors.New("ctx is not canceled")
+		}
+	}, &LockOptions{TTL: 30 * time.Millisecond})
+	if err != ErrLockNotHeld {
+		t.Fatalf("LockDo() of the lost lock = %v", err)
+	}
+}
@@ -0,0 +1,518 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/xlog"
+	"github.com/swxctx/xmodel/retry"
+)
+
+// defaults of QueueOptions
+const (
+	defaultQueueWorkers        = 1
+	defaultQueueVisibility     = time.Minute
+	defaultQueueMaxAttempts    = 3
+	defaultQueuePollInterval   = time.Second
+	defaultQueueInitialBackoff = 1000  // milliseconds
+	defaultQueueMaxBackoff     = 60000 // milliseconds
+	queueScheduleBatch         = 1000
+)
+
+var (
+	// ErrJobExists error: a job of the same id is in the queue
+	ErrJobExists = errors.New("redis: job exists")
+	// ErrJobNotFound error: the job is not in the queue
+	ErrJobNotFound = errors.New("redis: job not found")
+)
+
+// QueueOptions the options of the job queue.
+type QueueOptions struct {
+	// Workers the number of the jobs processed concurrently by Run.
+	// Default is 1.
+	Workers int
+	// Visibility the time a job is hidden from the other workers after it is taken,
+	// extended every Visibility/3 while the handler runs. The job is requeued if its worker stops extending it.
+	// Default is 1 minute.
+	Visibility time.Duration
+	// MaxAttempts the default maximum number of attempts of a job, the job is moved to the dead-letter list after it.
+	// Default is 3.
+	MaxAttempts int
+	// Retry the backoff before the next attempt of a failed job, MaxWait and HealthCheckInterval are not used.
+	// Default is from 1s to 1m.
+	Retry retry.Policy
+	// PollInterval the interval to promote the delayed jobs and requeue the stuck jobs,
+	// and the maximum time to block waiting for a job, which is rounded up to seconds by redis.
+	// Default is 1 second.
+	PollInterval time.Duration
+}
+
+// EnqueueOptions the options of a job.
+type EnqueueOptions struct {
+	// ID the job id, e.g. for deduplication, default is random.
+	ID string
+	// Delay the time before the job is ready.
+	Delay time.Duration
+	// MaxAttempts the maximum number of attempts, default is QueueOptions.MaxAttempts.
+	MaxAttempts int
+}
+
+// Job a job of the queue.
+type Job struct {
+	ID      string
+	Payload []byte
+	// Attempts the number of the attempts, including the current one.
+	Attempts    int
+	MaxAttempts int
+	EnqueuedAt  time.Time
+	// LastError the error of the last failed attempt.
+	LastError string
+}
+
+// jobData the immutable data of a job, stored as JSON.
+type jobData struct {
+	Payload     []byte `json:"payload"`
+	MaxAttempts int    `json:"max_attempts"`
+	EnqueuedAt  int64  `json:"enqueued_at"` // milliseconds
+}
+
+// JobHandler processes a job, the job is retried if it returns an error.
+// NOTE:
+//  ctx is canceled if the job is requeued, e.g. its visibility can not be extended.
+type JobHandler func(ctx context.Context, job *Job) error
+
+// Queue a reliable delayed job queue, a job is processed at least once.
+// NOTE:
+//  The keys are 'module:{name}:<part>', the hash tag keeps them in one cluster slot;
+//  ready: list of the ready jobs, taken by BRPOPLPUSH into processing;
+//  delayed: sorted set of the delayed and retrying jobs, scored by the ready time;
+//  processing: list of the jobs being processed, deadline: sorted set of their visibility deadlines;
+//  jobs, attempts, errors: hashes of the job data, the attempts and the last errors;
+//  The attempts is also the claim token: a worker only extends, acks or fails the job while
+//  it has the deadline and the attempts of its claim, so a worker whose job was requeued and
+//  taken by another one does not touch it;
+//  dead: list of the jobs exceeding the max attempts.
+type Queue struct {
+	c    *Client
+	name string
+	keys []string // ready, delayed, processing, deadline, jobs, attempts, errors, dead
+	opts QueueOptions
+}
+
+// NewQueue creates a job queue named name in the module.
+// NOTE:
+//  opts may be nil for the defaults.
+func NewQueue(c *Client, m *Module, name string, opts *QueueOptions) *Queue {
+	q := &Queue{c: c, name: name}
+	if opts != nil {
+		q.opts = *opts
+	}
+	if q.opts.Workers <= 0 {
+		q.opts.Workers = defaultQueueWorkers
+	}
+	if q.opts.Visibility <= 0 {
+		q.opts.Visibility = defaultQueueVisibility
+	}
+	if q.opts.MaxAttempts <= 0 {
+		q.opts.MaxAttempts = defaultQueueMaxAttempts
+	}
+	if q.opts.PollInterval <= 0 {
+		q.opts.PollInterval = defaultQueuePollInterval
+	}
+	if q.opts.Retry.InitialBackoff <= 0 {
+		q.opts.Retry.InitialBackoff = defaultQueueInitialBackoff
+	}
+	if q.opts.Retry.MaxBackoff <= 0 {
+		q.opts.Retry.MaxBackoff = defaultQueueMaxBackoff
+	}
+	for _, part := range []string{"ready", "delayed", "processing", "deadline", "jobs", "attempts", "errors", "dead"} {
+		q.keys = append(q.keys, m.Key("{"+name+"}:"+part))
+	}
+	return q
+}
+
+// Enqueue adds a job of payload, returns the job id.
+// NOTE:
+//  opts may be nil for the defaults;
+//  Returns ErrJobExists if opts.ID is in the queue.
+func (q *Queue) Enqueue(payload []byte, opts *EnqueueOptions) (string, error) {
+	var o EnqueueOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.ID == "" {
+		id, err := newLockToken()
+		if err != nil {
+			return "", err
+		}
+		o.ID = id
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = q.opts.MaxAttempts
+	}
+	data, err := json.Marshal(&jobData{
+		Payload:     payload,
+		MaxAttempts: o.MaxAttempts,
+		EnqueuedAt:  time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		return "", err
+	}
+	n, err := enqueueScript.Run(q.c, q.keys, o.ID, data, o.Delay.Milliseconds()).Int64()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrJobExists
+	}
+	return o.ID, nil
+}
+
+// QueueStats the numbers of the jobs in each state.
+type QueueStats struct {
+	Ready, Delayed, Processing, Dead int64
+}
+
+// Stats returns the numbers of the jobs in each state.
+func (q *Queue) Stats() (*QueueStats, error) {
+	pipe := q.c.Pipeline()
+	defer pipe.Close()
+	var (
+		ready      = pipe.LLen(q.keys[0])
+		delayed    = pipe.ZCard(q.keys[1])
+		processing = pipe.LLen(q.keys[2])
+		dead       = pipe.LLen(q.keys[7])
+	)
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+	return &QueueStats{
+		Ready:      ready.Val(),
+		Delayed:    delayed.Val(),
+		Processing: processing.Val(),
+		Dead:       dead.Val(),
+	}, nil
+}
+
+// DeadJobs returns up to count jobs of the dead-letter list, the latest first.
+func (q *Queue) DeadJobs(count int64) ([]*Job, error) {
+	ids, err := q.c.LRange(q.keys[7], 0, count-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := q.job(id)
+		if err == Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// RetryDead moves the job from the dead-letter list to the ready list, with its attempts reset.
+func (q *Queue) RetryDead(id string) error {
+	n, err := retryDeadScript.Run(q.c, q.keys, id).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Run processes the jobs with handler by QueueOptions.Workers workers, until ctx is done.
+// NOTE:
+//  After ctx is done, no job is taken, Run returns after the running handlers return;
+//  A worker blocking for a job notices ctx within PollInterval (at least 1s).
+func (q *Queue) Run(ctx context.Context, handler JobHandler) {
+	var wg sync.WaitGroup
+	wg.Add(1 + q.opts.Workers)
+	go func() {
+		defer wg.Done()
+		q.schedule(ctx)
+	}()
+	for i := 0; i < q.opts.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			q.work(ctx, handler)
+		}()
+	}
+	wg.Wait()
+}
+
+// schedule promotes the due delayed jobs and requeues the stuck jobs every PollInterval.
+func (q *Queue) schedule(ctx context.Context) {
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := scheduleScript.Run(q.c, q.keys, q.opts.Visibility.Milliseconds(), queueScheduleBatch).Err(); err != nil {
+			xlog.Warnf("[XModel] redis queue %s: schedule: %s", q.name, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// work takes and processes the jobs until ctx is done.
+func (q *Queue) work(ctx context.Context, handler JobHandler) {
+	// redis blocks in seconds, and 0 blocks forever
+	block := (q.opts.PollInterval + time.Second - 1).Truncate(time.Second)
+	for ctx.Err() == nil {
+		id, err := q.c.BRPopLPush(q.keys[0], q.keys[2], block).Result()
+		if err == Nil {
+			continue
+		}
+		if err != nil {
+			xlog.Warnf("[XModel] redis queue %s: take: %s", q.name, err.Error())
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.opts.PollInterval):
+			}
+			continue
+		}
+		if err = q.process(id, handler); err != nil {
+			xlog.Warnf("[XModel] redis queue %s: job %s: %s", q.name, id, err.Error())
+		}
+	}
+}
+
+// process runs handler on the taken job, then acks or fails it.
+func (q *Queue) process(id string, handler JobHandler) error {
+	attempts, err := claimScript.Run(q.c, q.keys, id, q.opts.Visibility.Milliseconds()).Int()
+	if err != nil || attempts == 0 {
+		// the job is deleted, or requeued by schedule
+		return err
+	}
+	job, err := q.job(id)
+	if err != nil {
+		return err
+	}
+	job.Attempts = attempts
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		stop    = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	go func() {
+		defer close(stopped)
+		runWatchdog("queue "+q.name+" job "+id, q.opts.Visibility, stop, func(ttl time.Duration) error {
+			n, err := extendScript.Run(q.c, q.keys, id, ttl.Milliseconds(), attempts).Int64()
+			if err == nil && n == 0 {
+				err = ErrLockNotHeld
+			}
+			return err
+		}, cancel)
+	}()
+	err = runJob(ctx, handler, job)
+	close(stop)
+	<-stopped
+	if ctx.Err() != nil {
+		return fmt.Errorf("the visibility deadline is lost, the job is requeued")
+	}
+
+	var n int64
+	if err == nil {
+		n, err = ackScript.Run(q.c, q.keys, id, attempts).Int64()
+	} else {
+		n, err = failScript.Run(q.c, q.keys, id, attempts, err.Error(), q.opts.Retry.Backoff(attempts).Milliseconds()).Int64()
+	}
+	if err == nil && n == 0 {
+		return fmt.Errorf("the claim is lost, the job is requeued")
+	}
+	return err
+}
+
+// runJob calls handler, recovers the panic as an error.
+func runJob(ctx context.Context, handler JobHandler, job *Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// job returns the job of id, returns Nil if it does not exist.
+func (q *Queue) job(id string) (*Job, error) {
+	pipe := q.c.Pipeline()
+	defer pipe.Close()
+	var (
+		data     = pipe.HGet(q.keys[4], id)
+		attempts = pipe.HGet(q.keys[5], id)
+		lastErr  = pipe.HGet(q.keys[6], id)
+	)
+	if _, err := pipe.Exec(); err != nil && err != Nil {
+		return nil, err
+	}
+	b, err := data.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var d jobData
+	if err = json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	n, _ := attempts.Int()
+	return &Job{
+		ID:          id,
+		Payload:     d.Payload,
+		Attempts:    n,
+		MaxAttempts: d.MaxAttempts,
+		EnqueuedAt:  time.Unix(0, d.EnqueuedAt*int64(time.Millisecond)),
+		LastError:   lastErr.Val(),
+	}, nil
+}
+
+// queueScriptHeader the keys and the server time in milliseconds of the queue scripts.
+const queueScriptHeader = `redis.replicate_commands()
+local ready, delayed, processing, deadline = KEYS[1], KEYS[2], KEYS[3], KEYS[4]
+local jobs, attempts, errors, dead = KEYS[5], KEYS[6], KEYS[7], KEYS[8]
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local function int(x)
+	return string.format("%.0f", x)
+end
+-- moves the job out of the processing, to the dead-letter list if it exceeds the max attempts, or to the target
+local function retry(id, to)
+	local data = redis.call("HGET", jobs, id)
+	if not data then
+		redis.call("HDEL", attempts, id)
+		redis.call("HDEL", errors, id)
+		return
+	end
+	local n = tonumber(redis.call("HGET", attempts, id) or "0")
+	if n >= cjson.decode(data).max_attempts then
+		redis.call("LPUSH", dead, id)
+	else
+		to(id)
+	end
+end
+-- whether the job is still claimed by the attempt
+local function claimed(id, attempt)
+	return redis.call("ZSCORE", deadline, id) and redis.call("HGET", attempts, id) == attempt
+end
+`
+
+// the queue scripts
+var (
+	// ARGV: id, data, delay
+	enqueueScript = redis.NewScript(queueScriptHeader + `
+local id, delay = ARGV[1], tonumber(ARGV[3])
+if redis.call("HSETNX", jobs, id, ARGV[2]) == 0 then
+	return 0
+end
+if delay > 0 then
+	redis.call("ZADD", delayed, int(now + delay), id)
+else
+	redis.call("LPUSH", ready, id)
+end
+return 1
+`)
+
+	// ARGV: id, visibility; returns the attempts, 0 if the job is not taken
+	claimScript = redis.NewScript(queueScriptHeader + `
+local id = ARGV[1]
+if redis.call("HEXISTS", jobs, id) == 0 then
+	redis.call("LREM", processing, 1, id)
+	return 0
+end
+redis.call("ZADD", deadline, int(now + tonumber(ARGV[2])), id)
+return redis.call("HINCRBY", attempts, id, 1)
+`)
+
+	// ARGV: id, visibility, attempts
+	extendScript = redis.NewScript(queueScriptHeader + `
+if not claimed(ARGV[1], ARGV[3]) then
+	return 0
+end
+redis.call("ZADD", deadline, int(now + tonumber(ARGV[2])), ARGV[1])
+return 1
+`)
+
+	// ARGV: id, attempts
+	ackScript = redis.NewScript(queueScriptHeader + `
+local id = ARGV[1]
+if not claimed(id, ARGV[2]) then
+	return 0
+end
+redis.call("ZREM", deadline, id)
+if redis.call("LREM", processing, 1, id) == 0 then
+	return 0
+end
+redis.call("HDEL", jobs, id)
+redis.call("HDEL", attempts, id)
+redis.call("HDEL", errors, id)
+return 1
+`)
+
+	// ARGV: id, attempts, error, backoff
+	failScript = redis.NewScript(queueScriptHeader + `
+local id = ARGV[1]
+if not claimed(id, ARGV[2]) then
+	return 0
+end
+redis.call("ZREM", deadline, id)
+if redis.call("LREM", processing, 1, id) == 0 then
+	return 0
+end
+redis.call("HSET", errors, id, ARGV[3])
+retry(id, function(id)
+	redis.call("ZADD", delayed, int(now + tonumber(ARGV[4])), id)
+end)
+return 1
+`)
+
+	// ARGV: visibility, batch
+	scheduleScript = redis.NewScript(queueScriptHeader + `
+local visibility, batch = tonumber(ARGV[1]), tonumber(ARGV[2])
+local due = redis.call("ZRANGEBYSCORE", delayed, "-inf", int(now), "LIMIT", 0, batch)
+for _, id in ipairs(due) do
+	redis.call("ZREM", delayed, id)
+	redis.call("LPUSH", ready, id)
+end
+-- the worker stopped between BRPOPLPUSH and the claim
+for _, id in ipairs(redis.call("LRANGE", processing, 0, -1)) do
+	if not redis.call("ZSCORE", deadline, id) then
+		redis.call("ZADD", deadline, int(now + visibility), id)
+	end
+end
+local expired = redis.call("ZRANGEBYSCORE", deadline, "-inf", int(now), "LIMIT", 0, batch)
+for _, id in ipairs(expired) do
+	redis.call("ZREM", deadline, id)
+	if redis.call("LREM", processing, 1, id) > 0 then
+		redis.call("HSET", errors, id, "visibility timeout")
+		retry(id, function(id)
+			redis.call("LPUSH", ready, id)
+		end)
+	end
+end
+return {#due, #expired}
+`)
+
+	// ARGV: id
+	retryDeadScript = redis.NewScript(queueScriptHeader + `
+local id = ARGV[1]
+if redis.call("LREM", dead, 1, id) == 0 then
+	return 0
+end
+redis.call("HDEL", attempts, id)
+redis.call("LPUSH", ready, id)
+return 1
+`)
+)
@@ -0,0 +1,155 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/xmodel/retry"
+)
+
+func TestQueue(t *testing.T) {
+	_, c := newMiniClient(t)
+	q := NewQueue(c, NewModule("test"), "jobs", &QueueOptions{
+		Workers:      2,
+		Visibility:   100 * time.Millisecond,
+		PollInterval: 20 * time.Millisecond,
+		Retry:        retry.Policy{InitialBackoff: 10, Jitter: -1},
+	})
+
+	// a worker stopped after taking the job
+	if _, err := q.Enqueue([]byte("stuck"), &EnqueueOptions{ID: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RPopLPush(q.keys[0], q.keys[2]).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue([]byte("now"), &EnqueueOptions{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue([]byte("later"), &EnqueueOptions{ID: "b", Delay: 200 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue([]byte("fail"), &EnqueueOptions{ID: "c", MaxAttempts: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(nil, &EnqueueOptions{ID: "a"}); err != ErrJobExists {
+		t.Fatalf("Enqueue() of an existing id = %v", err)
+	}
+
+	var (
+		mu   sync.Mutex
+		done = make(map[string]time.Time)
+	)
+	start := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		q.Run(ctx, func(ctx context.Context, job *Job) error {
+			if job.ID == "c" {
+				return errors.New("always fails")
+			}
+			mu.Lock()
+			done[job.ID] = time.Now()
+			mu.Unlock()
+			return nil
+		})
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s, err := q.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		n := len(done)
+		mu.Unlock()
+		if n == 3 && s.Dead == 1 && s.Ready+s.Delayed+s.Processing == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats %+v, done %v", s, done)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	if d := done["b"].Sub(start); d < 200*time.Millisecond {
+		t.Fatalf("the delayed job is done after %s", d)
+	}
+	if d := done["d"].Sub(start); d < 100*time.Millisecond {
+		t.Fatalf("the stuck job is requeued after %s", d)
+	}
+	jobs, err := q.DeadJobs(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != "c" || jobs[0].Attempts != 2 || jobs[0].LastError != "always fails" || string(jobs[0].Payload) != "fail" {
+		t.Fatalf("DeadJobs() = %+v", jobs)
+	}
+	if err = q.RetryDead("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.RetryDead("c"); err != ErrJobNotFound {
+		t.Fatalf("RetryDead() of a job not dead = %v", err)
+	}
+	if s, _ := q.Stats(); s.Ready != 1 || s.Dead != 0 {
+		t.Fatalf("stats after RetryDead() = %+v", s)
+	}
+	if job, _ := q.job("c"); job.Attempts != 0 {
+		t.Fatalf("attempts after RetryDead() = %d", job.Attempts)
+	}
+}
+
+func TestQueueStaleClaim(t *testing.T) {
+	_, c := newMiniClient(t)
+	q := NewQueue(c, NewModule("test"), "stale", &QueueOptions{Visibility: 10 * time.Millisecond})
+	if _, err := q.Enqueue([]byte("x"), &EnqueueOptions{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	claim := func() int64 {
+		if err := c.RPopLPush(q.keys[0], q.keys[2]).Err(); err != nil {
+			t.Fatal(err)
+		}
+		n, err := claimScript.Run(c, q.keys, "a", q.opts.Visibility.Milliseconds()).Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// the first worker stalls, its job is requeued and taken by the second one
+	stale := claim()
+	time.Sleep(20 * time.Millisecond)
+	if err := scheduleScript.Run(c, q.keys, q.opts.Visibility.Milliseconds(), queueScheduleBatch).Err(); err != nil {
+		t.Fatal(err)
+	}
+	current := claim()
+	if stale != 1 || current != 2 {
+		t.Fatalf("the claims = %d, %d", stale, current)
+	}
+
+	for name, cmd := range map[string]func() *redis.Cmd{
+		"extend": func() *redis.Cmd { return extendScript.Run(c, q.keys, "a", time.Minute.Milliseconds(), stale) },
+		"fail":   func() *redis.Cmd { return failScript.Run(c, q.keys, "a", stale, "stale", 0) },
+		"ack":    func() *redis.Cmd { return ackScript.Run(c, q.keys, "a", stale) },
+	} {
+		if n, err := cmd().Int64(); err != nil || n != 0 {
+			t.Fatalf("%s of the stale claim = %d, %v", name, n, err)
+		}
+	}
+	if s, _ := q.Stats(); s.Processing != 1 || s.Ready+s.Delayed+s.Dead != 0 {
+		t.Fatalf("stats after the stale claim = %+v", s)
+	}
+	if n, err := ackScript.Run(c, q.keys, "a", current).Int64(); err != nil || n != 1 {
+		t.Fatalf("ack of the current claim = %d, %v", n, err)
+	}
+	if s, _ := q.Stats(); s.Processing+s.Ready+s.Delayed+s.Dead != 0 {
+		t.Fatalf("stats after the ack = %+v", s)
+	}
+}
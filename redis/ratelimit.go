@@ -0,0 +1,301 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// RateLimit the quota of a rate limiter: Limit events per Period.
+type RateLimit struct {
+	Limit  int64
+	Period time.Duration
+	// Burst the maximum number of events at once, only for the token bucket and GCRA.
+	// Default is Limit.
+	Burst int64
+}
+
+// PerSecond returns a RateLimit of n events per second.
+func PerSecond(n int64) RateLimit {
+	return RateLimit{Limit: n, Period: time.Second}
+}
+
+// PerMinute returns a RateLimit of n events per minute.
+func PerMinute(n int64) RateLimit {
+	return RateLimit{Limit: n, Period: time.Minute}
+}
+
+// RateResult the result of a rate limiter request.
+type RateResult struct {
+	// Allowed whether the events are allowed, after waiting RetryAfter if they are reserved.
+	Allowed bool
+	// Remaining the number of events still allowed now.
+	Remaining int64
+	// RetryAfter if allowed, the time to wait before the reserved events, 0 for Allow/AllowN;
+	// otherwise the time to wait before retrying, -1 if the events exceed the capacity.
+	RetryAfter time.Duration
+	// ResetAfter the time until the quota is fully restored.
+	ResetAfter time.Duration
+}
+
+// RateLimiter a distributed rate limiter, implemented as an atomic Lua script.
+// NOTE:
+//  The time is read from the redis server, so the clocks of the clients do not matter;
+//  The key of id is 'module:{id}', the hash tag keeps the keys of the same id in one cluster slot.
+type RateLimiter struct {
+	c      *Client
+	module *Module
+	limit  RateLimit
+	script *redis.Script
+}
+
+// NewFixedWindowLimiter creates a rate limiter allowing limit.Limit events per fixed window of limit.Period.
+// NOTE:
+//  Up to 2*Limit events may happen around the boundary of two windows.
+func NewFixedWindowLimiter(c *Client, m *Module, limit RateLimit) *RateLimiter {
+	return newRateLimiter(c, m, limit, fixedWindowScript)
+}
+
+// NewSlidingWindowLimiter creates a rate limiter allowing limit.Limit events in any sliding window of limit.Period,
+// by logging the time of every event.
+// NOTE:
+//  It uses O(Limit) memory per id.
+func NewSlidingWindowLimiter(c *Client, m *Module, limit RateLimit) *RateLimiter {
+	return newRateLimiter(c, m, limit, slidingWindowScript)
+}
+
+// NewTokenBucketLimiter creates a token bucket rate limiter of limit.Burst tokens, refilled at limit.Limit per limit.Period.
+func NewTokenBucketLimiter(c *Client, m *Module, limit RateLimit) *RateLimiter {
+	return newRateLimiter(c, m, limit, tokenBucketScript)
+}
+
+// NewGCRALimiter creates a generic cell rate algorithm limiter, allowing limit.Limit events per limit.Period
+// evenly spaced, and limit.Burst events at once.
+// NOTE:
+//  It stores only one timestamp per id.
+func NewGCRALimiter(c *Client, m *Module, limit RateLimit) *RateLimiter {
+	return newRateLimiter(c, m, limit, gcraScript)
+}
+
+func newRateLimiter(c *Client, m *Module, limit RateLimit, script *redis.Script) *RateLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Limit
+	}
+	return &RateLimiter{
+		c:      c,
+		module: m,
+		limit:  limit,
+		script: script,
+	}
+}
+
+// Key returns the redis key of id.
+func (l *RateLimiter) Key(id string) string {
+	return l.module.Key("{" + id + "}")
+}
+
+// Allow reports whether one event of id is allowed now.
+func (l *RateLimiter) Allow(id string) (*RateResult, error) {
+	return l.AllowN(id, 1)
+}
+
+// AllowN reports whether n events of id are allowed now, and takes the quota if allowed.
+func (l *RateLimiter) AllowN(id string, n int64) (*RateResult, error) {
+	return l.Reserve(id, n, 0)
+}
+
+// Reserve takes the quota of n events of id, which may be available in the future, within maxWait.
+// NOTE:
+//  If allowed, the caller must wait RetryAfter before the events;
+//  If not allowed, no quota is taken.
+func (l *RateLimiter) Reserve(id string, n int64, maxWait time.Duration) (*RateResult, error) {
+	if l.limit.Limit <= 0 || l.limit.Period < time.Microsecond {
+		return nil, fmt.Errorf("redis: invalid rate limit: %d per %s", l.limit.Limit, l.limit.Period)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("redis: invalid number of events: %d", n)
+	}
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := l.script.Run(l.c, []string{l.Key(id)},
+		l.limit.Limit, l.limit.Period.Microseconds(), l.limit.Burst, n, maxWait.Microseconds(), token,
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return nil, fmt.Errorf("redis: unexpected rate limiter reply: %v", values)
+	}
+	var ints [4]int64
+	for i, v := range values {
+		x, ok := v.(int64)
+		if !ok {
+			return nil, fmt.Errorf("redis: unexpected rate limiter reply: %v", values)
+		}
+		ints[i] = x
+	}
+	r := &RateResult{
+		Allowed:    ints[0] == 1,
+		Remaining:  ints[1],
+		RetryAfter: time.Duration(ints[2]) * time.Microsecond,
+		ResetAfter: time.Duration(ints[3]) * time.Microsecond,
+	}
+	if ints[2] < 0 {
+		r.RetryAfter = -1
+	}
+	return r, nil
+}
+
+// Reset deletes the state of id, restores its full quota.
+func (l *RateLimiter) Reset(id string) error {
+	return l.c.Del(l.Key(id)).Err()
+}
+
+// rateScriptHeader the arguments and the server time in microseconds of the rate limiter scripts.
+// NOTE:
+//  The numbers passed to redis.call are formatted by '%.0f', the default format loses precision.
+const rateScriptHeader = `redis.replicate_commands()
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local max_wait = tonumber(ARGV[5])
+local token = ARGV[6]
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local function int(x)
+	return string.format("%.0f", x)
+end
+local function expire(us)
+	redis.call("PEXPIRE", key, int(math.max(1, math.ceil(us / 1000))))
+end
+`
+
+// the rate limiter scripts, return {allowed, remaining, retry_after, reset_after} in microseconds
+var (
+	// state: hash {w: the current window, c: the events counted from the window, including the reserved ones}
+	fixedWindowScript = redis.NewScript(rateScriptHeader + `
+local window = math.floor(now / period)
+local start = window * period
+local state = redis.call("HMGET", key, "w", "c")
+local count = 0
+if state[1] then
+	count = math.max(0, tonumber(state[2]) - (window - tonumber(state[1])) * limit)
+end
+local function reset_after(c)
+	if c == 0 then
+		return 0
+	end
+	return start + (math.floor((c - 1) / limit) + 1) * period - now
+end
+if n > limit then
+	return {0, math.max(0, limit - count), -1, reset_after(count)}
+end
+local wait = 0
+local k = math.floor((count + n - 1) / limit)
+if k > 0 then
+	wait = start + k * period - now
+end
+if wait > max_wait then
+	return {0, math.max(0, limit - count), wait, reset_after(count)}
+end
+count = count + n
+redis.call("HSET", key, "w", int(window), "c", int(count))
+expire(reset_after(count))
+return {1, math.max(0, limit - count), wait, reset_after(count)}
+`)
+
+	// state: sorted set of the events scored by their time, including the reserved ones
+	slidingWindowScript = redis.NewScript(rateScriptHeader + `
+redis.call("ZREMRANGEBYSCORE", key, "-inf", int(now - period))
+local entries = redis.call("ZRANGE", key, 0, -1, "WITHSCORES")
+local scores = {}
+for i = 2, #entries, 2 do
+	scores[#scores + 1] = tonumber(entries[i])
+end
+local total = #scores
+local function reset_after(last)
+	if last == 0 then
+		return 0
+	end
+	return scores[last] + period - now
+end
+if n > limit then
+	return {0, math.max(0, limit - total), -1, reset_after(total)}
+end
+for i = total + 1, total + n do
+	local score = now
+	if i > limit then
+		score = math.max(now, scores[i - limit] + period)
+	end
+	scores[i] = score
+end
+local wait = scores[total + n] - now
+if wait > max_wait then
+	return {0, math.max(0, limit - total), wait, reset_after(total)}
+end
+for i = total + 1, total + n do
+	redis.call("ZADD", key, int(scores[i]), token .. ":" .. (i - total))
+end
+expire(reset_after(total + n))
+return {1, math.max(0, limit - total - n), wait, reset_after(total + n)}
+`)
+
+	// state: hash {tokens: the tokens at ts, negative if reserved, ts: the time of the last request}
+	tokenBucketScript = redis.NewScript(rateScriptHeader + `
+local rate = limit / period
+local state = redis.call("HMGET", key, "tokens", "ts")
+local tokens = burst
+if state[1] then
+	tokens = math.min(burst, tonumber(state[1]) + (now - tonumber(state[2])) * rate)
+end
+local function reset_after(x)
+	return math.ceil((burst - x) / rate)
+end
+if n > burst then
+	return {0, math.max(0, math.floor(tokens)), -1, reset_after(tokens)}
+end
+local left = tokens - n
+local wait = 0
+if left < 0 then
+	wait = math.ceil(-left / rate)
+end
+if wait > max_wait then
+	return {0, math.max(0, math.floor(tokens)), wait, reset_after(tokens)}
+end
+redis.call("HSET", key, "tokens", string.format("%.17g", left), "ts", int(now))
+expire(reset_after(left))
+return {1, math.max(0, math.floor(left)), wait, reset_after(left)}
+`)
+
+	// state: the theoretical arrival time of the next event
+	gcraScript = redis.NewScript(rateScriptHeader + `
+local emission = period / limit
+local tolerance = emission * burst
+local tat = redis.call("GET", key)
+if tat then
+	tat = math.max(now, tonumber(tat))
+else
+	tat = now
+end
+local function remaining(x)
+	return math.max(0, math.floor((tolerance - (x - now)) / emission + 1e-9))
+end
+if n > burst then
+	return {0, remaining(tat), -1, math.ceil(tat - now)}
+end
+local new_tat = tat + emission * n
+local wait = math.max(0, math.ceil(new_tat - tolerance - now))
+if wait > max_wait then
+	return {0, remaining(tat), wait, math.ceil(tat - now)}
+end
+redis.call("SET", key, int(new_tat))
+expire(new_tat - now)
+return {1, remaining(new_tat), wait, math.ceil(new_tat - now)}
+`)
+)
@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newMiniClient returns a *Client connected to a miniredis server.
+func newMiniClient(t *testing.T) (*miniredis.Miniredis, *Client) {
+	m := miniredis.RunT(t)
+	c, err := NewClient(&Config{
+		DeployType: TypeSingle,
+		ForSingle:  SingleConfig{Addr: m.Addr()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return m, c
+}
+
+type rateCase struct {
+	advance time.Duration // the time to advance before the request
+	n       int64
+	maxWait time.Duration
+	want    RateResult
+}
+
+func testRateLimiter(t *testing.T, m *miniredis.Miniredis, l *RateLimiter, cases []rateCase) {
+	t.Helper()
+	now := time.Unix(1700000000, 0)
+	for i, c := range cases {
+		now = now.Add(c.advance)
+		m.SetTime(now)
+		r, err := l.Reserve("u1", c.n, c.maxWait)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if *r != c.want {
+			t.Fatalf("case %d: Reserve(%d, %s) = %+v, want %+v", i, c.n, c.maxWait, *r, c.want)
+		}
+	}
+}
+
+func TestFixedWindowLimiter(t *testing.T) {
+	m, c := newMiniClient(t)
+	l := NewFixedWindowLimiter(c, NewModule("rate"), RateLimit{Limit: 3, Period: time.Second})
+	testRateLimiter(t, m, l, []rateCase{
+		{0, 2, 0, RateResult{true, 1, 0, time.Second}},
+		{100 * time.Millisecond, 1, 0, RateResult{true, 0, 0, 900 * time.Millisecond}},
+		{0, 1, 0, RateResult{false, 0, 900 * time.Millisecond, 900 * time.Millisecond}},
+		{0, 4, 0, RateResult{false, 0, -1, 900 * time.Millisecond}},
+		// reserved in the next window
+		{0, 2, time.Second, RateResult{true, 0, 900 * time.Millisecond, 1900 * time.Millisecond}},
+		{time.Second, 1, 0, RateResult{true, 0, 0, 900 * time.Millisecond}},
+		{time.Second, 3, 0, RateResult{true, 0, 0, 900 * time.Millisecond}},
+	})
+	if key := l.Key("u1"); key != "rate:{u1}" {
+		t.Fatalf("Key() = %s", key)
+	}
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	m, c := newMiniClient(t)
+	l := NewSlidingWindowLimiter(c, NewModule("rate"), RateLimit{Limit: 3, Period: time.Second})
+	testRateLimiter(t, m, l, []rateCase{
+		{0, 2, 0, RateResult{true, 1, 0, time.Second}},
+		{600 * time.Millisecond, 1, 0, RateResult{true, 0, 0, time.Second}},
+		{0, 1, 0, RateResult{false, 0, 400 * time.Millisecond, time.Second}},
+		// the first two events slide out
+		{400 * time.Millisecond, 2, 0, RateResult{true, 0, 0, time.Second}},
+		{0, 2, time.Second, RateResult{true, 0, time.Second, 2 * time.Second}},
+		{0, 1, 0, RateResult{false, 0, time.Second, 2 * time.Second}},
+	})
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	m, c := newMiniClient(t)
+	l := NewTokenBucketLimiter(c, NewModule("rate"), RateLimit{Limit: 10, Period: time.Second, Burst: 5})
+	testRateLimiter(t, m, l, []rateCase{
+		{0, 5, 0, RateResult{true, 0, 0, 500 * time.Millisecond}},
+		{0, 1, 0, RateResult{false, 0, 100 * time.Millisecond, 500 * time.Millisecond}},
+		{200 * time.Millisecond, 2, 0, RateResult{true, 0, 0, 500 * time.Millisecond}},
+		{0, 6, 0, RateResult{false, 0, -1, 500 * time.Millisecond}},
+		{0, 3, time.Second, RateResult{true, 0, 300 * time.Millisecond, 800 * time.Millisecond}},
+		{time.Second, 1, 0, RateResult{true, 4, 0, 100 * time.Millisecond}},
+	})
+}
+
+func TestGCRALimiter(t *testing.T) {
+	m, c := newMiniClient(t)
+	l := NewGCRALimiter(c, NewModule("rate"), RateLimit{Limit: 10, Period: time.Second, Burst: 2})
+	testRateLimiter(t, m, l, []rateCase{
+		{0, 1, 0, RateResult{true, 1, 0, 100 * time.Millisecond}},
+		{0, 1, 0, RateResult{true, 0, 0, 200 * time.Millisecond}},
+		{0, 1, 0, RateResult{false, 0, 100 * time.Millisecond, 200 * time.Millisecond}},
+		{50 * time.Millisecond, 1, 0, RateResult{false, 0, 50 * time.Millisecond, 150 * time.Millisecond}},
+		{0, 3, 0, RateResult{false, 0, -1, 150 * time.Millisecond}},
+		{0, 1, 100 * time.Millisecond, RateResult{true, 0, 50 * time.Millisecond, 250 * time.Millisecond}},
+		{time.Second, 2, 0, RateResult{true, 0, 0, 200 * time.Millisecond}},
+	})
+	if err := l.Reset("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := l.Allow("u1"); err != nil || !r.Allowed || r.Remaining != 1 {
+		t.Fatalf("Allow() after Reset() = %+v, %v", r, err)
+	}
+}
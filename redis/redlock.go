@@ -0,0 +1,261 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultDriftFactor the default clock drift factor of Redlock
+const defaultDriftFactor = 0.01
+
+// Redlock a distributed lock on several independent redis masters, see https://redis.io/docs/latest/develop/use/patterns/distributed-locks/.
+// NOTE:
+//  The lock is obtained if it is set on the majority of the masters within its validity time;
+//  The masters should be independent, not the replicas or cluster nodes of each other.
+type Redlock struct {
+	clients []*Client
+	// DriftFactor the clock drift of the masters relative to the TTL, default is 0.01.
+	// The validity time is TTL minus the acquisition time minus TTL*DriftFactor+2ms.
+	DriftFactor float64
+}
+
+// NewRedlock creates a Redlock of the independent masters, an odd number like 3 or 5 is recommended.
+func NewRedlock(clients ...*Client) *Redlock {
+	return &Redlock{
+		clients:     clients,
+		DriftFactor: defaultDriftFactor,
+	}
+}
+
+// quorum returns the number of the masters required.
+func (r *Redlock) quorum() int {
+	return len(r.clients)/2 + 1
+}
+
+// drift returns the clock drift of ttl.
+func (r *Redlock) drift(ttl time.Duration) time.Duration {
+	return time.Duration(float64(ttl)*r.DriftFactor) + 2*time.Millisecond
+}
+
+// each calls fn on every master concurrently, returns the number of the masters where fn returns true,
+// and the first error.
+func (r *Redlock) each(fn func(c *Client) (bool, error)) (int, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		n        int
+		firstErr error
+	)
+	for _, c := range r.clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			ok, err := fn(c)
+			mu.Lock()
+			if ok {
+				n++
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	return n, firstErr
+}
+
+// RedlockLock a Redlock held by a random owner token.
+type RedlockLock struct {
+	r        *Redlock
+	key      string
+	token    string
+	ttl      time.Duration
+	validity time.Time
+	mu       sync.Mutex
+	released bool
+	stop     chan struct{} // closed by Unlock
+	stopped  chan struct{} // closed when the watchdog exits
+	lost     chan struct{} // closed when the watchdog finds the lock not held
+}
+
+// TryLock tries to obtain the lock once, returns ErrNotObtained if it is not set on the majority
+// of the masters within its validity time.
+// NOTE:
+//  opts may be nil for the defaults;
+//  The lock is released on all the masters if it is not obtained.
+func (r *Redlock) TryLock(key string, opts *LockOptions) (*RedlockLock, error) {
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ttl   = opts.ttl()
+		start = time.Now()
+	)
+	n, _ := r.each(func(c *Client) (bool, error) {
+		return c.SetNX(key, token, ttl).Result()
+	})
+	validity := ttl - time.Since(start) - r.drift(ttl)
+	l := &RedlockLock{
+		r:        r,
+		key:      key,
+		token:    token,
+		ttl:      ttl,
+		validity: start.Add(ttl - r.drift(ttl)),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	if n < r.quorum() || validity <= 0 {
+		l.release()
+		return nil, ErrNotObtained
+	}
+	if opts != nil && opts.NoWatchdog {
+		close(l.stopped)
+	} else {
+		go l.watchdog()
+	}
+	return l, nil
+}
+
+// Lock obtains the lock, retries with backoff until it is obtained or ctx is done.
+// NOTE:
+//  opts may be nil for the defaults;
+//  Returns ctx.Err() if ctx is done before the lock is obtained.
+func (r *Redlock) Lock(ctx context.Context, key string, opts *LockOptions) (*RedlockLock, error) {
+	for attempt := 1; ; attempt++ {
+		l, err := r.TryLock(key, opts)
+		if err != ErrNotObtained {
+			return l, err
+		}
+		timer := time.NewTimer(opts.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// LockDo obtains the lock, calls callback and releases the lock.
+// NOTE:
+//  The ctx of callback is canceled if the lock is lost;
+//  Returns the error of callback, or ErrLockNotHeld if the lock is lost before released.
+func (r *Redlock) LockDo(ctx context.Context, key string, callback func(ctx context.Context) error, opts *LockOptions) error {
+	for _, c := range r.clients {
+		c.lockEnter()
+		defer c.lockLeave()
+	}
+	l, err := r.Lock(ctx, key, opts)
+	if err != nil {
+		return err
+	}
+	return doLocked(ctx, l, callback)
+}
+
+// LockCallback obtains the lock, calls callback and releases the lock, the same as *Client.LockCallback.
+// NOTE:
+//  maxLock is the TTL of the lock, default 1 minute, extended by the watchdog while callback runs.
+func (r *Redlock) LockCallback(lockKey string, callback func(), maxLock ...time.Duration) error {
+	var opts LockOptions
+	if len(maxLock) > 0 {
+		opts.TTL = maxLock[0]
+	}
+	return r.LockDo(context.Background(), lockKey, func(context.Context) error {
+		callback()
+		return nil
+	}, &opts)
+}
+
+// Key returns the key of the lock.
+func (l *RedlockLock) Key() string {
+	return l.key
+}
+
+// Token returns the random owner token of the lock.
+func (l *RedlockLock) Token() string {
+	return l.token
+}
+
+// Validity returns the time until which the lock is held, without the refreshes after it.
+func (l *RedlockLock) Validity() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.validity
+}
+
+// Lost returns a channel that is closed when the watchdog finds the lock not held.
+func (l *RedlockLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Refresh extends the expiration of the lock to ttl on all the masters,
+// returns ErrLockNotHeld if it is not extended on the majority of the masters within the validity time.
+func (l *RedlockLock) Refresh(ttl time.Duration) error {
+	var (
+		start   = time.Now()
+		mu      sync.Mutex
+		notHeld int // the number of the masters replied that the lock is not held
+	)
+	n, err := l.r.each(func(c *Client) (bool, error) {
+		n, err := refreshScript.Run(c, []string{l.key}, l.token, ttl.Milliseconds()).Int64()
+		if err == nil && n == 0 {
+			mu.Lock()
+			notHeld++
+			mu.Unlock()
+		}
+		return n == 1, err
+	})
+	if n >= l.r.quorum() && time.Since(start)+l.r.drift(ttl) < ttl {
+		l.mu.Lock()
+		l.validity = start.Add(ttl - l.r.drift(ttl))
+		l.mu.Unlock()
+		return nil
+	}
+	if err != nil && notHeld < l.r.quorum() && time.Now().Before(l.Validity()) {
+		// some masters are unreachable, the lock is still valid
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+// Unlock stops the watchdog and deletes the lock on all the masters where it is still held by the token.
+// NOTE:
+//  Returns ErrLockNotHeld if the lock is already released, or it is not deleted on the majority of the masters.
+func (l *RedlockLock) Unlock() error {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return ErrLockNotHeld
+	}
+	l.released = true
+	close(l.stop)
+	l.mu.Unlock()
+	<-l.stopped
+
+	n, err := l.release()
+	if n >= l.r.quorum() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+// release deletes the lock on all the masters, returns the number of the masters where it is deleted.
+func (l *RedlockLock) release() (int, error) {
+	return l.r.each(func(c *Client) (bool, error) {
+		n, err := unlockScript.Run(c, []string{l.key}, l.token).Int64()
+		return n == 1, err
+	})
+}
+
+// watchdog extends the expiration every ttl/3 until the lock is released or lost.
+func (l *RedlockLock) watchdog() {
+	defer close(l.stopped)
+	runWatchdog("redlock "+l.key, l.ttl, l.stop, l.Refresh, func() { close(l.lost) })
+}
@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRedlock(t *testing.T) {
+	var (
+		servers = make([]*fakeServer, 3)
+		clients = make([]*Client, 3)
+	)
+	for i := range servers {
+		servers[i] = newFakeServer(t)
+		clients[i] = servers[i].client(t)
+	}
+	r := NewRedlock(clients...)
+	held := func(key, token string) (n int) {
+		for _, s := range servers {
+			if v, ok := s.value(key); ok && v == token {
+				n++
+			}
+		}
+		return n
+	}
+
+	// the majority is enough
+	servers[2].setDown(true)
+	l, err := r.TryLock("lock_a", &LockOptions{TTL: 60 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := held("lock_a", l.Token()); n != 2 || time.Until(l.Validity()) <= 0 {
+		t.Fatalf("held on %d masters, validity %s", n, l.Validity())
+	}
+	if _, err = r.TryLock("lock_a", nil); err != ErrNotObtained {
+		t.Fatalf("TryLock() of the held lock = %v", err)
+	}
+	// the watchdog keeps the lock after the ttl
+	time.Sleep(150 * time.Millisecond)
+	if n := held("lock_a", l.Token()); n != 2 {
+		t.Fatalf("held on %d masters after ttl", n)
+	}
+	servers[2].setDown(false)
+	if err = l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if n := held("lock_a", l.Token()); n != 0 {
+		t.Fatalf("held on %d masters after Unlock()", n)
+	}
+
+	// the minority is released
+	servers[1].setDown(true)
+	servers[2].setDown(true)
+	if _, err = r.TryLock("lock_b", nil); err != ErrNotObtained {
+		t.Fatalf("TryLock() on the minority = %v", err)
+	}
+	if _, ok := servers[0].value("lock_b"); ok {
+		t.Fatal("the lock on the minority is not released")
+	}
+	servers[1].setDown(false)
+	servers[2].setDown(false)
+
+	// held by another owner on the majority
+	servers[0].setValue("lock_c", "other")
+	servers[1].setValue("lock_c", "other")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err = r.Lock(ctx, "lock_c", nil); err != context.DeadlineExceeded {
+		t.Fatalf("Lock() of the lock held by another owner = %v", err)
+	}
+	if v, _ := servers[0].value("lock_c"); v != "other" {
+		t.Fatalf("the lock of another owner is changed: %q", v)
+	}
+	if _, ok := servers[2].value("lock_c"); ok {
+		t.Fatal("the lock on the minority is not released")
+	}
+
+	// the clock drift exceeds the ttl
+	if _, err = r.TryLock("lock_d", &LockOptions{TTL: time.Millisecond}); err != ErrNotObtained {
+		t.Fatalf("TryLock() without validity time = %v", err)
+	}
+
+	// the lock is lost on the majority
+	err = r.LockDo(context.Background(), "lock_e", func(ctx context.Context) error {
+		servers[0].setValue("lock_e", "other")
+		servers[1].setValue("lock_e", "other")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+			t.Error("ctx is not canceled")
+			return nil
+		}
+	}, &LockOptions{TTL: 30 * time.Millisecond})
+	if err != ErrLockNotHeld {
+		t.Fatalf("LockDo() of the lost lock = %v", err)
+	}
+
+	var called bool
+	if err = r.LockCallback("lock_f", func() { called = true }); err != nil || !called {
+		t.Fatalf("LockCallback() = %v, called %v", err, called)
+	}
+	for _, s := range servers {
+		if _, ok := s.value("lock_f"); ok {
+			t.Fatal("the lock is not released after LockCallback()")
+		}
+	}
+}
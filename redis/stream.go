@@ -0,0 +1,279 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/swxctx/xlog"
+)
+
+// defaults of StreamGroupOptions
+const (
+	defaultStreamBatchSize    = 10
+	defaultStreamBlock        = time.Second
+	defaultStreamClaimMinIdle = time.Minute
+)
+
+// XMessage a message of a stream.
+type XMessage = redis.XMessage
+
+// Stream a redis stream, trimmed to about MaxLen messages.
+type Stream struct {
+	c      *Client
+	key    string
+	maxLen int64
+}
+
+// NewStream creates a stream named name in the module.
+// NOTE:
+//  If maxLen > 0, the stream is trimmed by 'MAXLEN ~ maxLen' on every Add, it may keep a few more messages.
+func NewStream(c *Client, m *Module, name string, maxLen int64) *Stream {
+	return &Stream{
+		c:      c,
+		key:    m.Key(name),
+		maxLen: maxLen,
+	}
+}
+
+// Key returns the redis key of the stream.
+func (s *Stream) Key() string {
+	return s.key
+}
+
+// Add appends a message of values to the stream, returns the message id.
+func (s *Stream) Add(values map[string]interface{}) (string, error) {
+	return s.c.XAdd(&redis.XAddArgs{
+		Stream:       s.key,
+		MaxLenApprox: s.maxLen,
+		Values:       values,
+	}).Result()
+}
+
+// StreamGroupOptions the options of a stream consumer group.
+type StreamGroupOptions struct {
+	// Consumer the consumer name, unique in the group.
+	// Default is 'hostname-pid-random'.
+	Consumer string
+	// Start the id from which the group is created if it does not exist, '$' for the new messages, '0' for all.
+	// Default is '$'.
+	Start string
+	// BatchSize the maximum number of messages per handler call.
+	// Default is 10.
+	BatchSize int64
+	// Block the maximum time to wait for new messages, the claim is checked in between.
+	// Default is 1 second.
+	Block time.Duration
+	// ClaimMinIdle the pending messages not acked for ClaimMinIdle are claimed from their consumers,
+	// e.g. the consumers stopped or the handler failed, they are checked every ClaimMinIdle/2.
+	// Default is 1 minute.
+	ClaimMinIdle time.Duration
+	// MaxDeliveries if > 0, a message is delivered at most MaxDeliveries times, then it is acked and dropped with a warning.
+	MaxDeliveries int64
+}
+
+// StreamHandler processes a batch of messages, they are acked if it returns nil.
+// NOTE:
+//  All the messages of a failed batch are redelivered after ClaimMinIdle, and count towards MaxDeliveries.
+type StreamHandler func(ctx context.Context, msgs []XMessage) error
+
+// StreamGroup a consumer of a stream consumer group.
+type StreamGroup struct {
+	s     *Stream
+	group string
+	opts  StreamGroupOptions
+}
+
+// NewStreamGroup creates a consumer of the consumer group of the stream.
+// NOTE:
+//  opts may be nil for the defaults.
+func NewStreamGroup(s *Stream, group string, opts *StreamGroupOptions) (*StreamGroup, error) {
+	g := &StreamGroup{s: s, group: group}
+	if opts != nil {
+		g.opts = *opts
+	}
+	if g.opts.Consumer == "" {
+		host, _ := os.Hostname()
+		token, err := newLockToken()
+		if err != nil {
+			return nil, err
+		}
+		g.opts.Consumer = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), token[:8])
+	}
+	if g.opts.Start == "" {
+		g.opts.Start = "$"
+	}
+	if g.opts.BatchSize <= 0 {
+		g.opts.BatchSize = defaultStreamBatchSize
+	}
+	if g.opts.Block <= 0 {
+		g.opts.Block = defaultStreamBlock
+	}
+	if g.opts.ClaimMinIdle <= 0 {
+		g.opts.ClaimMinIdle = defaultStreamClaimMinIdle
+	}
+	return g, nil
+}
+
+// Consumer returns the consumer name.
+func (g *StreamGroup) Consumer() string {
+	return g.opts.Consumer
+}
+
+// Run creates the group if it does not exist, then processes the messages with handler until ctx is done.
+// NOTE:
+//  The new messages are read by XREADGROUP, the idle pending messages are claimed by XPENDING/XCLAIM;
+//  After ctx is done, Run returns after the running handler returns, the ctx of handler is not canceled;
+//  Returns the error of creating the group.
+func (g *StreamGroup) Run(ctx context.Context, handler StreamHandler) error {
+	err := g.s.c.XGroupCreateMkStream(g.s.key, g.group, g.opts.Start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	var (
+		handlerCtx = context.WithoutCancel(ctx)
+		nextClaim  time.Time
+	)
+	for ctx.Err() == nil {
+		if time.Now().After(nextClaim) {
+			msgs, err := g.claim()
+			if err != nil {
+				xlog.Warnf("[XModel] redis stream %s group %s: claim: %s", g.s.key, g.group, err.Error())
+			}
+			if len(msgs) > 0 {
+				g.process(handlerCtx, handler, msgs)
+				continue
+			}
+			nextClaim = time.Now().Add(g.opts.ClaimMinIdle / 2)
+		}
+
+		streams, err := g.s.c.XReadGroup(&redis.XReadGroupArgs{
+			Group:    g.group,
+			Consumer: g.opts.Consumer,
+			Streams:  []string{g.s.key, ">"},
+			Count:    g.opts.BatchSize,
+			Block:    g.opts.Block,
+		}).Result()
+		if err == Nil {
+			continue
+		}
+		if err != nil {
+			xlog.Warnf("[XModel] redis stream %s group %s: read: %s", g.s.key, g.group, err.Error())
+			select {
+			case <-ctx.Done():
+			case <-time.After(g.opts.Block):
+			}
+			continue
+		}
+		for _, stream := range streams {
+			g.process(handlerCtx, handler, stream.Messages)
+		}
+	}
+	return nil
+}
+
+// claim claims up to BatchSize pending messages idle for ClaimMinIdle, acks the messages delivered too many times.
+func (g *StreamGroup) claim() ([]XMessage, error) {
+	var (
+		ids   []string
+		drops []string
+		start = "-"
+	)
+	for int64(len(ids)) < g.opts.BatchSize {
+		pending, err := g.s.c.XPendingExt(&redis.XPendingExtArgs{
+			Stream: g.s.key,
+			Group:  g.group,
+			Start:  start,
+			End:    "+",
+			Count:  g.opts.BatchSize,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pending {
+			if p.Idle < g.opts.ClaimMinIdle {
+				continue
+			}
+			if g.opts.MaxDeliveries > 0 && p.RetryCount >= g.opts.MaxDeliveries {
+				drops = append(drops, p.ID)
+				continue
+			}
+			ids = append(ids, p.ID)
+		}
+		if int64(len(pending)) < g.opts.BatchSize {
+			break
+		}
+		start = nextStreamID(pending[len(pending)-1].ID)
+	}
+	if len(drops) > 0 {
+		xlog.Warnf("[XModel] redis stream %s group %s: drop the messages delivered %d times: %v", g.s.key, g.group, g.opts.MaxDeliveries, drops)
+		if err := g.s.c.XAck(g.s.key, g.group, drops...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if int64(len(ids)) > g.opts.BatchSize {
+		ids = ids[:g.opts.BatchSize]
+	}
+	return g.s.c.XClaim(&redis.XClaimArgs{
+		Stream:   g.s.key,
+		Group:    g.group,
+		Consumer: g.opts.Consumer,
+		MinIdle:  g.opts.ClaimMinIdle,
+		Messages: ids,
+	}).Result()
+}
+
+// process calls handler with the messages, acks them if it returns nil.
+// NOTE:
+//  The deleted messages (nil values) are acked without calling handler.
+func (g *StreamGroup) process(ctx context.Context, handler StreamHandler, msgs []XMessage) {
+	var (
+		valid = msgs[:0:0]
+		ids   = make([]string, 0, len(msgs))
+	)
+	for _, msg := range msgs {
+		ids = append(ids, msg.ID)
+		if msg.Values != nil {
+			valid = append(valid, msg)
+		}
+	}
+	if len(valid) > 0 {
+		if err := runStreamHandler(ctx, handler, valid); err != nil {
+			xlog.Warnf("[XModel] redis stream %s group %s: handle %d messages: %s", g.s.key, g.group, len(valid), err.Error())
+			return
+		}
+	}
+	if err := g.s.c.XAck(g.s.key, g.group, ids...).Err(); err != nil {
+		xlog.Warnf("[XModel] redis stream %s group %s: ack: %s", g.s.key, g.group, err.Error())
+	}
+}
+
+// runStreamHandler calls handler, recovers the panic as an error.
+func runStreamHandler(ctx context.Context, handler StreamHandler, msgs []XMessage) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handler(ctx, msgs)
+}
+
+// nextStreamID returns the smallest id after id, e.g. '1-1' after '1-0'.
+func nextStreamID(id string) string {
+	i := strings.IndexByte(id, '-')
+	if i < 0 {
+		return id
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return id
+	}
+	return id[:i+1] + strconv.FormatUint(seq+1, 10)
+}
@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func TestStreamGroup(t *testing.T) {
+	_, c := newMiniClient(t)
+	s := NewStream(c, NewModule("test"), "events", 0)
+	for _, v := range []string{"a", "b", "c", "poison", "d"} {
+		if _, err := s.Add(map[string]interface{}{"v": v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := NewStreamGroup(s, "g1", &StreamGroupOptions{
+		Start:         "0",
+		BatchSize:     1,
+		Block:         20 * time.Millisecond,
+		ClaimMinIdle:  50 * time.Millisecond,
+		MaxDeliveries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.XGroupCreate(s.Key(), "g1", "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	// a consumer stopped after reading 'a'
+	if err = c.XReadGroup(&redis.XReadGroupArgs{Group: "g1", Consumer: "dead", Streams: []string{s.Key(), ">"}, Count: 1, Block: -1}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		handled = make(map[string]int)
+		batches int
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- g.Run(ctx, func(ctx context.Context, msgs []XMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			batches++
+			if len(msgs) != 1 {
+				t.Errorf("batch of %d messages", len(msgs))
+			}
+			for _, msg := range msgs {
+				if msg.Values["v"] == "poison" {
+					handled["poison"]++
+					return errors.New("poison")
+				}
+			}
+			for _, msg := range msgs {
+				handled[msg.Values["v"].(string)]++
+			}
+			return nil
+		})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := c.XPending(s.Key(), "g1").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		n := len(handled)
+		mu.Unlock()
+		if n == 5 && pending.Count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handled %v, pending %+v", handled, pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// a new message after the claim
+	if _, err = s.Add(map[string]interface{}{"v": "e"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		mu.Lock()
+		_, ok := handled["e"]
+		mu.Unlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the new message is not handled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err = <-stopped; err != nil {
+		t.Fatal(err)
+	}
+
+	// 'a' is claimed from the stopped consumer, 'poison' is dropped after 2 deliveries
+	mu.Lock()
+	defer mu.Unlock()
+	if handled["a"] != 1 || handled["b"] != 1 || handled["poison"] != 2 || handled["e"] != 1 || batches != 7 {
+		t.Fatalf("handled %v, %d batches", handled, batches)
+	}
+}
+
+func TestStreamTrim(t *testing.T) {
+	_, c := newMiniClient(t)
+	s := NewStream(c, NewModule("test"), "events", 3)
+	for i := 0; i < 10; i++ {
+		if _, err := s.Add(map[string]interface{}{"i": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := c.XLen(s.Key()).Result(); err != nil || n < 3 || n > 10 {
+		t.Fatalf("XLen() = %d, %v", n, err)
+	}
+	if nextStreamID("1526919030474-55") != "1526919030474-56" {
+		t.Fatal(nextStreamID("1526919030474-55"))
+	}
+}
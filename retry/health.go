@@ -0,0 +1,114 @@
+package retry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/swxctx/xlog"
+)
+
+// Health the health state of a connection, with an optional background checker.
+// NOTE:
+//  The zero value is unhealthy and ready to use;
+//  Must not be copied after first use.
+type Health struct {
+	mu      sync.Mutex
+	healthy bool
+	ready   chan struct{} // closed while healthy
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Healthy returns whether the connection is healthy.
+func (h *Health) Healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.healthy
+}
+
+// WaitReady blocks until the connection is healthy or ctx is done.
+func (h *Health) WaitReady(ctx context.Context) error {
+	h.mu.Lock()
+	ready := h.readyChan()
+	h.mu.Unlock()
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Set marks the connection healthy or unhealthy, returns whether the state is changed.
+func (h *Health) Set(healthy bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.healthy == healthy {
+		return false
+	}
+	ready := h.readyChan()
+	h.healthy = healthy
+	if healthy {
+		close(ready)
+	} else {
+		h.ready = make(chan struct{})
+	}
+	return true
+}
+
+func (h *Health) readyChan() chan struct{} {
+	if h.ready == nil {
+		h.ready = make(chan struct{})
+		if h.healthy {
+			close(h.ready)
+		}
+	}
+	return h.ready
+}
+
+// Start starts the background checker, which calls check every interval and sets the state by its result.
+// NOTE:
+//  check should ping the server, and reconnect if necessary;
+//  Restarts the checker if it is running; does nothing if interval <= 0.
+func (h *Health) Start(name string, interval time.Duration, check func() error) {
+	if interval <= 0 {
+		return
+	}
+	h.Stop()
+	stop, done := make(chan struct{}), make(chan struct{})
+	h.mu.Lock()
+	h.stop, h.done = stop, done
+	h.mu.Unlock()
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			if err := check(); err != nil {
+				if h.Set(false) {
+					xlog.Errorf("[XModel] %s is unhealthy: %s", name, err.Error())
+				}
+			} else if h.Set(true) {
+				xlog.Infof("[XModel] %s is healthy again", name)
+			}
+		}
+	}()
+}
+
+// Stop stops the background checker and waits for it to exit.
+func (h *Health) Stop() {
+	h.mu.Lock()
+	stop, done := h.stop, h.done
+	h.stop, h.done = nil, nil
+	h.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
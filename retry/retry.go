@@ -0,0 +1,121 @@
+// Package retry connection retry policy and health state.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/swxctx/xlog"
+)
+
+// defaults of Policy
+const (
+	defaultInitialBackoff = 100   // milliseconds
+	defaultMaxBackoff     = 10000 // milliseconds
+	defaultMultiplier     = 2
+	defaultJitter         = 0.2
+)
+
+// Policy the retry policy of connecting to a server
+type Policy struct {
+	// the maximum seconds to keep retrying to connect.
+	// If d <= 0, connect only once.
+	MaxWait int64 `yaml:"max_wait" json:"max_wait"`
+	// the milliseconds to wait before the first retry.
+	// If d <= 0, the default is 100.
+	InitialBackoff int64 `yaml:"initial_backoff" json:"initial_backoff"`
+	// the maximum milliseconds to wait between two attempts.
+	// If d <= 0, the default is 10000.
+	MaxBackoff int64 `yaml:"max_backoff" json:"max_backoff"`
+	// the factor by which the backoff grows after every attempt.
+	// If f < 1, the default is 2.
+	Multiplier float64 `yaml:"multiplier" json:"multiplier"`
+	// the randomization factor of the backoff, the backoff b is randomized in [b*(1-f), b*(1+f)].
+	// If f == 0, the default is 0.2; if f < 0, no randomization.
+	Jitter float64 `yaml:"jitter" json:"jitter"`
+	// the seconds between two checks of the background health checker.
+	// If d <= 0, the health checker is disabled.
+	HealthCheckInterval int64 `yaml:"health_check_interval" json:"health_check_interval"`
+
+	// OnAttempt is called after every failed attempt, with the backoff before the next attempt.
+	// If nil, logs a warning.
+	OnAttempt func(name string, attempt int, err error, backoff time.Duration) `yaml:"-" json:"-"`
+}
+
+// Backoff returns the randomized wait before the attempt+1 (attempt starts from 1).
+func (p *Policy) Backoff(attempt int) time.Duration {
+	var (
+		initial    = p.InitialBackoff
+		max        = p.MaxBackoff
+		multiplier = p.Multiplier
+		jitter     = p.Jitter
+	)
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+	if jitter == 0 {
+		jitter = defaultJitter
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	b := float64(initial)
+	for i := 1; i < attempt && b < float64(max); i++ {
+		b *= multiplier
+	}
+	if b > float64(max) {
+		b = float64(max)
+	}
+	if jitter > 0 {
+		b += b * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(b * float64(time.Millisecond))
+}
+
+// HealthCheckPeriod returns the interval of the background health checker, 0 if disabled.
+func (p *Policy) HealthCheckPeriod() time.Duration {
+	if p == nil || p.HealthCheckInterval <= 0 {
+		return 0
+	}
+	return time.Duration(p.HealthCheckInterval) * time.Second
+}
+
+// Do calls fn until it succeeds, p.MaxWait is exhausted or ctx is done.
+// NOTE:
+//  name is used in the logs and the error, e.g. 'mysql';
+//  If p is nil or p.MaxWait <= 0, calls fn only once and returns its error as is.
+func Do(ctx context.Context, p *Policy, name string, fn func() error) error {
+	err := fn()
+	if err == nil || p == nil || p.MaxWait <= 0 {
+		return err
+	}
+	deadline := time.Now().Add(time.Duration(p.MaxWait) * time.Second)
+	for attempt := 1; ; attempt++ {
+		backoff := p.Backoff(attempt)
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("%s: give up after %d attempts: %w", name, attempt, err)
+		}
+		if p.OnAttempt != nil {
+			p.OnAttempt(name, attempt, err, backoff)
+		} else {
+			xlog.Warnf("[XModel] connect %s: attempt %d failed: %s, retry in %s", name, attempt, err.Error(), backoff)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s: %s, last error: %w", name, ctx.Err().Error(), err)
+		case <-timer.C:
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := &Policy{InitialBackoff: 100, MaxBackoff: 1000, Multiplier: 2, Jitter: -1}
+	for attempt, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("Backoff(2) with jitter = %s, want in [100ms, 300ms]", got)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	errDown := errors.New("down")
+	var attempts []int
+	p := &Policy{
+		MaxWait:        1,
+		InitialBackoff: 1,
+		OnAttempt: func(name string, attempt int, err error, backoff time.Duration) {
+			attempts = append(attempts, attempt)
+		},
+	}
+	n := 0
+	err := Do(context.Background(), p, "test", func() error {
+		if n++; n < 3 {
+			return errDown
+		}
+		return nil
+	})
+	if err != nil || n != 3 || len(attempts) != 2 {
+		t.Fatalf("Do() = %v, calls %d, hooks %v", err, n, attempts)
+	}
+
+	// no retry
+	n = 0
+	err = Do(context.Background(), &Policy{}, "test", func() error { n++; return errDown })
+	if err != errDown || n != 1 {
+		t.Fatalf("Do() without retry = %v, calls %d", err, n)
+	}
+
+	// give up
+	p = &Policy{MaxWait: 1, InitialBackoff: 300, Jitter: -1, OnAttempt: func(string, int, error, time.Duration) {}}
+	err = Do(context.Background(), p, "test", func() error { return errDown })
+	if !errors.Is(err, errDown) {
+		t.Fatalf("Do() give up = %v, want wrapping %v", err, errDown)
+	}
+
+	// canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p = &Policy{MaxWait: 10, InitialBackoff: 1000, OnAttempt: func(string, int, error, time.Duration) {}}
+	start := time.Now()
+	err = Do(ctx, p, "test", func() error { return errDown })
+	if !errors.Is(err, errDown) || time.Since(start) > time.Second {
+		t.Fatalf("Do() canceled = %v after %s", err, time.Since(start))
+	}
+}
+
+func TestHealth(t *testing.T) {
+	var h Health
+	if h.Healthy() {
+		t.Fatal("zero Health is healthy")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.WaitReady(ctx); err == nil {
+		t.Fatal("WaitReady() of unhealthy returns nil")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		h.Set(true)
+	}()
+	if err := h.WaitReady(context.Background()); err != nil || !h.Healthy() {
+		t.Fatalf("WaitReady() = %v, healthy %v", err, h.Healthy())
+	}
+
+	checked := make(chan struct{}, 1)
+	h.Start("test", time.Millisecond, func() error {
+		select {
+		case checked <- struct{}{}:
+		default:
+		}
+		return errors.New("down")
+	})
+	<-checked
+	h.Stop()
+	if h.Healthy() {
+		t.Fatal("Healthy() after failed check")
+	}
+}
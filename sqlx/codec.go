@@ -0,0 +1,163 @@
+package sqlx
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/swxctx/xmodel/sqlx/reflectx"
+)
+
+// EncryptTag the struct tag selecting the registered FieldCodec of a field, e.g. `encrypt:"aes"`.
+const EncryptTag = "encrypt"
+
+// FieldCodec encodes the value of a tagged string or []byte field before it is bound to a query,
+// and decodes the column value scanned into the field, e.g. encryption.
+type FieldCodec interface {
+	// Encode encodes the plain value, it is not called for the empty value.
+	Encode(plain []byte) ([]byte, error)
+	// Decode decodes the encoded value, it is not called for the empty value.
+	Decode(data []byte) ([]byte, error)
+	// Deterministic returns whether equal values are always encoded equally,
+	// only such fields can be used as lookup keys.
+	Deterministic() bool
+}
+
+var (
+	fieldCodecs sync.Map // key: tag value, value: FieldCodec
+	codecTypes  sync.Map // key: reflect.Type, value: bool, whether the struct has tagged fields
+)
+
+// RegisterFieldCodec registers the codec of the fields tagged `encrypt:"<name>"`.
+func RegisterFieldCodec(name string, codec FieldCodec) {
+	fieldCodecs.Store(name, codec)
+}
+
+// FieldCodecOf returns the registered codec of the struct field, nil if the field is not tagged.
+func FieldCodecOf(field reflect.StructField) (FieldCodec, error) {
+	name, ok := field.Tag.Lookup(EncryptTag)
+	if !ok {
+		return nil, nil
+	}
+	codec, ok := fieldCodecs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("field %s: unregistered codec %s:%q", field.Name, EncryptTag, name)
+	}
+	switch k := field.Type.Kind(); {
+	case k == reflect.String:
+	case k == reflect.Slice && field.Type.Elem().Kind() == reflect.Uint8:
+	default:
+		return nil, fmt.Errorf("field %s: codec %s:%q only supports string and []byte, not %s", field.Name, EncryptTag, name, field.Type)
+	}
+	return codec.(FieldCodec), nil
+}
+
+// EncodeField returns the encoded value of the string or []byte field v, in the same type.
+func EncodeField(codec FieldCodec, v reflect.Value) (interface{}, error) {
+	var plain []byte
+	if v.Kind() == reflect.String {
+		plain = []byte(v.String())
+	} else {
+		plain = v.Bytes()
+	}
+	if len(plain) == 0 {
+		return v.Interface(), nil
+	}
+	data, err := codec.Encode(plain)
+	if err != nil {
+		return nil, err
+	}
+	if v.Kind() == reflect.String {
+		return string(data), nil
+	}
+	return data, nil
+}
+
+// DecodeField decodes data into the string or []byte field v.
+func DecodeField(codec FieldCodec, v reflect.Value, data []byte) error {
+	var plain []byte
+	if len(data) > 0 {
+		var err error
+		plain, err = codec.Decode(data)
+		if err != nil {
+			return err
+		}
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(string(plain))
+	} else {
+		v.SetBytes(plain)
+	}
+	return nil
+}
+
+// hasCodecFields returns whether the struct type t has any field tagged by EncryptTag.
+func hasCodecFields(m *reflectx.Mapper, t reflect.Type) bool {
+	if has, ok := codecTypes.Load(t); ok {
+		return has.(bool)
+	}
+	var has bool
+	for _, fi := range m.TypeMap(t).Index {
+		if _, ok := fi.Field.Tag.Lookup(EncryptTag); ok {
+			has = true
+			break
+		}
+	}
+	codecTypes.Store(t, has)
+	return has
+}
+
+// codecsByNames returns the codecs of the fields of struct type t by column names,
+// nil if t has no tagged field.
+func codecsByNames(m *reflectx.Mapper, t reflect.Type, names []string) ([]FieldCodec, error) {
+	t = reflectx.Deref(t)
+	if t.Kind() != reflect.Struct || !hasCodecFields(m, t) {
+		return nil, nil
+	}
+	var (
+		tm     = m.TypeMap(t)
+		codecs = make([]FieldCodec, len(names))
+	)
+	for i, name := range names {
+		fi, ok := tm.Names[name]
+		if !ok {
+			continue
+		}
+		codec, err := FieldCodecOf(fi.Field)
+		if err != nil {
+			return nil, err
+		}
+		codecs[i] = codec
+	}
+	return codecs, nil
+}
+
+// wrapCodecScanners replaces the field pointers in values with the decoding scanners.
+func wrapCodecScanners(codecs []FieldCodec, values []interface{}) {
+	for i, codec := range codecs {
+		if codec != nil {
+			values[i] = &codecScanner{codec: codec, dest: reflect.ValueOf(values[i]).Elem()}
+		}
+	}
+}
+
+// codecScanner scans the encoded column value and decodes it into dest.
+type codecScanner struct {
+	codec FieldCodec
+	dest  reflect.Value
+}
+
+// Scan implements the sql.Scanner interface.
+func (s *codecScanner) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("codec field: unsupported column value type %T", src)
+	}
+	return DecodeField(s.codec, s.dest, data)
+}
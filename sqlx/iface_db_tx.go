@@ -30,6 +30,7 @@ type DbOrTx interface {
 	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
 
 	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	Prepare(query string) (*sql.Stmt, error)
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 	QueryRow(query string, args ...interface{}) *sql.Row
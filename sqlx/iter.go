@@ -0,0 +1,115 @@
+package sqlx
+
+import (
+	"context"
+	"reflect"
+)
+
+// Iter is a generic streaming iterator over the result set of a query.
+// It scans one row at a time into T, which may be a struct, a pointer to struct
+// or a scannable type (the result set must have only one column).
+//
+//	it, err := sqlx.NewIter[*Person](ctx, db, "SELECT * FROM person")
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		p := it.Value()
+//	}
+//	return it.Err()
+type Iter[T any] struct {
+	rows       *Rows
+	cur        T
+	err        error
+	isPtr      bool
+	scannable  bool
+	structType reflect.Type
+}
+
+// NewIter executes the query and returns the iterator of its rows.
+// NOTE:
+//  The caller must call Close() if the iteration is stopped early.
+func NewIter[T any](ctx context.Context, q QueryerContext, query string, args ...interface{}) (*Iter[T], error) {
+	rows, err := q.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	it := &Iter[T]{rows: rows}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Ptr {
+		it.isPtr = true
+		t = t.Elem()
+	}
+	it.structType = t
+	it.scannable = isScannable(t)
+	return it, nil
+}
+
+// Next scans the next row, returns false when there are no more rows or an error occurs.
+func (it *Iter[T]) Next() bool {
+	if it.err != nil || it.rows == nil {
+		return false
+	}
+	if !it.rows.Next() {
+		it.err = it.rows.Err()
+		it.Close()
+		return false
+	}
+	var (
+		v    = reflect.New(it.structType)
+		dest = v.Interface()
+	)
+	if it.scannable {
+		it.err = it.rows.Scan(dest)
+	} else {
+		it.err = it.rows.StructScan(dest)
+	}
+	if it.err != nil {
+		it.Close()
+		return false
+	}
+	if it.isPtr {
+		it.cur = dest.(T)
+	} else {
+		it.cur = v.Elem().Interface().(T)
+	}
+	return true
+}
+
+// Value returns the current row.
+func (it *Iter[T]) Value() T {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iter[T]) Err() error {
+	return it.err
+}
+
+// Close closes the underlying rows, it is safe to call it multiple times.
+func (it *Iter[T]) Close() error {
+	if it.rows == nil {
+		return nil
+	}
+	err := it.rows.Close()
+	it.rows = nil
+	return err
+}
+
+// Each streams the rows of the query into fn one by one.
+// NOTE:
+//  Stops and returns the error if fn returns an error.
+func Each[T any](ctx context.Context, q QueryerContext, fn func(T) error, query string, args ...interface{}) error {
+	it, err := NewIter[T](ctx, q, query, args...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		if err = fn(it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
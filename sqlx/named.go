@@ -163,12 +163,25 @@ func bindArgs(names []string, arg interface{}, m *reflectx.Mapper) ([]interface{
 		v = v.Elem()
 	}
 
-	err := m.TraversalsByNameFunc(v.Type(), names, func(i int, t []int) error {
+	codecs, err := codecsByNames(m, v.Type(), names)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.TraversalsByNameFunc(v.Type(), names, func(i int, t []int) error {
 		if len(t) == 0 {
 			return fmt.Errorf("could not find name %s in %#v", names[i], arg)
 		}
 
 		val := reflectx.FieldByIndexesReadOnly(v, t)
+		if codecs != nil && codecs[i] != nil {
+			encoded, err := EncodeField(codecs[i], val)
+			if err != nil {
+				return err
+			}
+			arglist = append(arglist, encoded)
+			return nil
+		}
 		arglist = append(arglist, val.Interface())
 
 		return nil
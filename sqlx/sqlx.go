@@ -576,6 +576,7 @@ type Rows struct {
 	// these fields cache memory use for a rows during iteration w/ structScan
 	started bool
 	fields  [][]int
+	codecs  []FieldCodec
 	values  []interface{}
 }
 
@@ -615,6 +616,10 @@ func (r *Rows) StructScan(dest interface{}) error {
 		if f, err := missingFields(r.fields); err != nil && !r.unsafe {
 			return fmt.Errorf("missing destination name %s in %T", columns[f], dest)
 		}
+		r.codecs, err = codecsByNames(m, v.Type(), columns)
+		if err != nil {
+			return err
+		}
 		r.values = make([]interface{}, len(columns))
 		r.started = true
 	}
@@ -623,6 +628,7 @@ func (r *Rows) StructScan(dest interface{}) error {
 	if err != nil {
 		return err
 	}
+	wrapCodecScanners(r.codecs, r.values)
 	// scan into the struct field pointers and append to our results
 	err = r.Scan(r.values...)
 	if err != nil {
@@ -777,12 +783,17 @@ func (r *Row) scanAny(dest interface{}, structOnly bool) error {
 	if f, err := missingFields(fields); err != nil && !r.unsafe {
 		return fmt.Errorf("missing destination name %s in %T", columns[f], dest)
 	}
+	codecs, err := codecsByNames(m, v.Type(), columns)
+	if err != nil {
+		return err
+	}
 	values := make([]interface{}, len(columns))
 
 	err = fieldsByTraversal(v, fields, values, true)
 	if err != nil {
 		return err
 	}
+	wrapCodecScanners(codecs, values)
 	// scan into the struct field pointers and append to our results
 	return r.Scan(values...)
 }
@@ -943,6 +954,10 @@ func scanAll(rows rowsi, dest interface{}, structOnly bool) error {
 		if f, err := missingFields(fields); err != nil && !isUnsafe(rows) {
 			return fmt.Errorf("missing destination name %s in %T", columns[f], dest)
 		}
+		codecs, err := codecsByNames(m, base, columns)
+		if err != nil {
+			return err
+		}
 		values = make([]interface{}, len(columns))
 
 		for rows.Next() {
@@ -954,6 +969,7 @@ func scanAll(rows rowsi, dest interface{}, structOnly bool) error {
 			if err != nil {
 				return err
 			}
+			wrapCodecScanners(codecs, values)
 
 			// scan into the struct field pointers and append to our results
 			err = rows.Scan(values...)